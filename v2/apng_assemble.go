@@ -0,0 +1,216 @@
+package pngstructure
+
+import (
+	"bytes"
+	"math"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+)
+
+var (
+	// delayDenominators are tried, finest first, when representing a delay
+	// as an fcTL fraction.
+	delayDenominators = []uint16{1000, 100, 10, 1}
+)
+
+// delayFraction returns the delay as the fcTL numerator and denominator. The
+// delay is rounded to the millisecond and coarser if it otherwise would not
+// fit.
+func delayFraction(delay time.Duration) (num, den uint16, err error) {
+	if delay < 0 {
+		return 0, 0, log.Errorf("delay must not be negative: [%s]", delay)
+	}
+
+	for _, den := range delayDenominators {
+		scaled := math.Round(delay.Seconds() * float64(den))
+		if scaled > math.MaxUint16 {
+			continue
+		}
+
+		num := uint16(scaled)
+
+		// Reduce the fraction.
+		a, b := num, den
+		for b != 0 {
+			a, b = b, a%b
+		}
+
+		if a > 1 {
+			num /= a
+			den /= a
+		}
+
+		return num, den, nil
+	}
+
+	return 0, 0, log.Errorf("delay too long to represent: [%s]", delay)
+}
+
+// AssembleAnimation builds an APNG from the given images and per-frame
+// delays. Every frame is drawn at the top-left of a canvas the size of the
+// first image and replaces what was there before (each frame is disposed to
+// the background, so nothing of a larger frame shows around a smaller one).
+// The first image is the default image and provides the ancillary chunks. All
+// images must have the same color-type, bit-depth and interlacing and must fit
+// on the canvas. Indexed images must share the same palette, and none may
+// already be animated. `numPlays` is the number of loops (zero is forever).
+func AssembleAnimation(frames []*ChunkSlice, delays []time.Duration, numPlays uint32) (cs *ChunkSlice, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if len(frames) == 0 {
+		log.Panicf("at least one frame is required")
+	} else if len(delays) != len(frames) {
+		log.Panicf("delay count does not match frame count: (%d) != (%d)", len(delays), len(frames))
+	}
+
+	cd := NewChunkDecoder()
+	ce := NewChunkEncoder()
+
+	encode := func(decoded interface{}) *Chunk {
+		c, err := ce.Encode(decoded)
+		log.PanicIf(err)
+
+		return c
+	}
+
+	ihdrs := make([]*ChunkIHDR, len(frames))
+	for i, frameCs := range frames {
+		if len(frameCs.chunks) == 0 || frameCs.chunks[0].Type != IHDRChunkType {
+			log.Panicf("frame (%d) does not start with IHDR", i)
+		}
+
+		for _, c := range frameCs.chunks {
+			if c.Type == ACTLChunkType || c.Type == FCTLChunkType || c.Type == FDATChunkType {
+				log.Panicf("frame (%d) is already animated: found %s", i, c.Type)
+			}
+		}
+
+		decoded, err := cd.Decode(frameCs.chunks[0])
+		log.PanicIf(err)
+
+		ihdrs[i] = decoded.(*ChunkIHDR)
+	}
+
+	canvas := ihdrs[0]
+	firstIndex := frames[0].Index()
+
+	for i, ihdr := range ihdrs[1:] {
+		i++
+
+		if ihdr.ColorType != canvas.ColorType || ihdr.BitDepth != canvas.BitDepth {
+			log.Panicf("frame (%d) color-type and bit-depth (%d, %d) not compatible with (%d, %d)", i, ihdr.ColorType, ihdr.BitDepth, canvas.ColorType, canvas.BitDepth)
+		} else if ihdr.InterlaceMethod != canvas.InterlaceMethod {
+			log.Panicf("frame (%d) interlace-method (%d) not compatible with (%d)", i, ihdr.InterlaceMethod, canvas.InterlaceMethod)
+		} else if ihdr.Width > canvas.Width || ihdr.Height > canvas.Height {
+			log.Panicf("frame (%d) larger than the canvas: (%d, %d) > (%d, %d)", i, ihdr.Width, ihdr.Height, canvas.Width, canvas.Height)
+		}
+
+		// There is only one palette (and tRNS) for the whole animation.
+		index := frames[i].Index()
+		for _, type_ := range []string{PLTEChunkType, TRNSChunkType} {
+			if sameChunkData(index[type_], firstIndex[type_]) == false {
+				log.Panicf("frame (%d) %s not the same as the first frame", i, type_)
+			}
+		}
+	}
+
+	// Build the animation around the chunks of the first image.
+
+	chunks := []*Chunk{
+		frames[0].chunks[0],
+		encode(&ChunkACTL{NumFrames: uint32(len(frames)), NumPlays: numPlays}),
+	}
+
+	sequenceNumber := uint32(0)
+
+	for i, frameCs := range frames {
+		num, den, err := delayFraction(delays[i])
+		log.PanicIf(err)
+
+		fctl := &ChunkFCTL{
+			SequenceNumber: sequenceNumber,
+			Width:          ihdrs[i].Width,
+			Height:         ihdrs[i].Height,
+			DelayNum:       num,
+			DelayDen:       den,
+			DisposeOp:      DisposeOpBackground,
+			BlendOp:        BlendOpSource,
+		}
+
+		sequenceNumber++
+
+		if i == 0 {
+			seenIdat := false
+			for _, c := range frameCs.chunks[1:] {
+				if c.Type == IDATChunkType && seenIdat == false {
+					chunks = append(chunks, encode(fctl))
+					seenIdat = true
+				}
+
+				if c.Type != IENDChunkType {
+					chunks = append(chunks, c)
+				}
+			}
+
+			if seenIdat == false {
+				log.Panicf("frame (%d) has no IDAT", i)
+			}
+
+			continue
+		}
+
+		chunks = append(chunks, encode(fctl))
+
+		seenIdat := false
+		for _, c := range frameCs.chunks {
+			if c.Type != IDATChunkType {
+				continue
+			}
+
+			err := c.Load()
+			log.PanicIf(err)
+
+			fdat := &ChunkFDAT{
+				SequenceNumber: sequenceNumber,
+				Data:           c.Data,
+			}
+
+			sequenceNumber++
+
+			chunks = append(chunks, encode(fdat))
+			seenIdat = true
+		}
+
+		if seenIdat == false {
+			log.Panicf("frame (%d) has no IDAT", i)
+		}
+	}
+
+	chunks = append(chunks, NewChunk(IENDChunkType, nil))
+
+	return NewChunkSlice(chunks), nil
+}
+
+// sameChunkData returns true if both lists have the same chunk data.
+func sameChunkData(a, b []*Chunk) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Load() != nil || b[i].Load() != nil {
+			return false
+		}
+
+		if bytes.Equal(a[i].Data, b[i].Data) == false {
+			return false
+		}
+	}
+
+	return true
+}
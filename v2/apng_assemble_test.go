@@ -0,0 +1,198 @@
+package pngstructure
+
+import (
+	"fmt"
+	"image"
+	"testing"
+	"time"
+
+	"image/color"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func getTestAssembledFrames() []*ChunkSlice {
+	images := getTestAnimationFrameImages()
+
+	frames := make([]*ChunkSlice, len(images))
+	for i, img := range images {
+		frames[i] = getTestImageChunkSlice(img)
+	}
+
+	return frames
+}
+
+func TestDelayFraction(t *testing.T) {
+	cases := []struct {
+		delay time.Duration
+		num   uint16
+		den   uint16
+	}{
+		{100 * time.Millisecond, 1, 10},
+		{33 * time.Millisecond, 33, 1000},
+		{0, 0, 1},
+		{90 * time.Second, 90, 1},
+		{90*time.Second + 100*time.Millisecond, 901, 10},
+	}
+
+	for _, tc := range cases {
+		num, den, err := delayFraction(tc.delay)
+		log.PanicIf(err)
+
+		if num != tc.num || den != tc.den {
+			t.Fatalf("delay [%s] not converted correctly: (%d/%d)", tc.delay, num, den)
+		}
+	}
+
+	_, _, err := delayFraction(-time.Second)
+	if err == nil {
+		t.Fatalf("expected error for negative delay")
+	}
+
+	_, _, err = delayFraction(24 * time.Hour)
+	if err == nil {
+		t.Fatalf("expected error for long delay")
+	}
+}
+
+func TestAssembleAnimation(t *testing.T) {
+	frames := getTestAssembledFrames()
+	delays := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 30 * time.Millisecond}
+
+	cs, err := AssembleAnimation(frames, delays, 3)
+	log.PanicIf(err)
+
+	animation, err := cs.Animation()
+	log.PanicIf(err)
+
+	if animation.Control.NumFrames != 3 || animation.Control.NumPlays != 3 {
+		t.Fatalf("acTL not correct: %s", animation.Control)
+	} else if animation.DefaultImageIsFrame != true {
+		t.Fatalf("default image should be a frame")
+	}
+
+	sequenceNumber := uint32(0)
+	cd := NewChunkDecoder()
+
+	for i, frame := range animation.Frames {
+		if frame.Control.Delay() != delays[i] {
+			t.Fatalf("frame (%d) delay not correct: [%s]", i, frame.Control.Delay())
+		} else if frame.Control.SequenceNumber != sequenceNumber {
+			t.Fatalf("frame (%d) fcTL sequence-number not correct: (%d)", i, frame.Control.SequenceNumber)
+		}
+
+		sequenceNumber++
+
+		for _, c := range frame.DataChunks {
+			if c.Type != FDATChunkType {
+				continue
+			}
+
+			decoded, err := cd.Decode(c)
+			log.PanicIf(err)
+
+			if decoded.(*ChunkFDAT).SequenceNumber != sequenceNumber {
+				t.Fatalf("frame (%d) fdAT sequence-number not correct", i)
+			}
+
+			sequenceNumber++
+		}
+	}
+
+	// The frames come back out unchanged.
+	extracted, err := cs.ExtractFrames(false)
+	log.PanicIf(err)
+
+	images := getTestAnimationFrameImages()
+	for i, frameCs := range extracted {
+		img := decodeTestChunkSlice(frameCs)
+
+		for y := 0; y < images[i].Bounds().Dy(); y++ {
+			for x := 0; x < images[i].Bounds().Dx(); x++ {
+				if color.NRGBAModel.Convert(img.At(x, y)) != images[i].At(x, y) {
+					t.Fatalf("frame (%d) pixel (%d, %d) not correct", i, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestAssembleAnimation_NotCompatible(t *testing.T) {
+	delays := []time.Duration{time.Second, time.Second}
+
+	// An opaque image encodes as RGB rather than RGBA.
+	opaque := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := range opaque.Pix {
+		opaque.Pix[i] = 0xff
+	}
+
+	frames := getTestAssembledFrames()
+
+	_, err := AssembleAnimation([]*ChunkSlice{frames[0], getTestImageChunkSlice(opaque)}, delays, 0)
+	if err == nil {
+		t.Fatalf("expected error for incompatible color-type")
+	}
+
+	// Larger than the canvas.
+	_, err = AssembleAnimation([]*ChunkSlice{frames[1], frames[0]}, delays, 0)
+	if err == nil {
+		t.Fatalf("expected error for frame larger than canvas")
+	}
+
+	_, err = AssembleAnimation(frames, delays, 0)
+	if err == nil {
+		t.Fatalf("expected error for delay count")
+	}
+
+	_, err = AssembleAnimation([]*ChunkSlice{frames[0], getTestAnimatedChunkSlice()}, delays, 0)
+	if err == nil {
+		t.Fatalf("expected error for animated frame")
+	}
+
+	_, err = AssembleAnimation([]*ChunkSlice{frames[0], &ChunkSlice{chunks: []*Chunk{NewChunk(IENDChunkType, nil)}}}, delays, 0)
+	if err == nil {
+		t.Fatalf("expected error for frame without IHDR")
+	}
+
+	_, err = AssembleAnimation([]*ChunkSlice{frames[0], &ChunkSlice{}}, delays, 0)
+	if err == nil {
+		t.Fatalf("expected error for empty frame")
+	}
+}
+
+func TestAssembleAnimation_SmallerFrameReplaces(t *testing.T) {
+	frames := getTestAssembledFrames()
+	delays := []time.Duration{time.Second, time.Second}
+
+	// The second frame is 4x4 and the first is 8x8.
+	cs, err := AssembleAnimation(frames[:2], delays, 0)
+	log.PanicIf(err)
+
+	composited, err := cs.ExtractFrames(true)
+	log.PanicIf(err)
+
+	img := decodeTestChunkSlice(composited[1])
+	expected := getTestAnimationFrameImages()[1].At(2, 2)
+
+	if color.NRGBAModel.Convert(img.At(6, 6)) != (color.NRGBA{}) {
+		t.Fatalf("first frame shows around the second")
+	} else if color.NRGBAModel.Convert(img.At(2, 2)) != expected {
+		t.Fatalf("second frame not drawn")
+	}
+}
+
+func ExampleAssembleAnimation() {
+	frames := getTestAssembledFrames()
+	delays := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 30 * time.Millisecond}
+
+	cs, err := AssembleAnimation(frames, delays, 0)
+	log.PanicIf(err)
+
+	animation, err := cs.Animation()
+	log.PanicIf(err)
+
+	fmt.Printf("%d frames, %s\n", len(animation.Frames), animation.Duration())
+
+	// Output:
+	// 3 frames, 330ms
+}
@@ -0,0 +1,222 @@
+package pngstructure
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/png"
+
+	"github.com/dsoprea/go-logging"
+)
+
+var (
+	// frameCopyChunkTypes are the chunks that each extracted frame inherits
+	// from the animation because they determine how the pixels are
+	// interpreted.
+	frameCopyChunkTypes = map[string]bool{
+		PLTEChunkType: true,
+		TRNSChunkType: true,
+		GAMAChunkType: true,
+		CHRMChunkType: true,
+		SRGBChunkType: true,
+		ICCPChunkType: true,
+		CICPChunkType: true,
+		SBITChunkType: true,
+		MDCVChunkType: true,
+		CLLIChunkType: true,
+	}
+
+	// paletteChunkTypes are the chunks that only apply to the original
+	// encoding and are not inherited by composited frames.
+	paletteChunkTypes = map[string]bool{
+		PLTEChunkType: true,
+		TRNSChunkType: true,
+		SBITChunkType: true,
+	}
+)
+
+// ExtractFrames returns every frame of the animation as a standalone PNG. If
+// the default image is not part of the animation, it is not included.
+//
+// If `composite` is false, each frame is exactly the frame data: the IHDR
+// takes the frame's dimensions, fdAT chunks become IDAT chunks, and the
+// palette and color chunks are copied. No pixels are decoded.
+//
+// If `composite` is true, the dispose and blend operations are applied and
+// each frame is the full canvas as a viewer would show it. These are
+// re-encoded as 8-bit or (if the animation is 16-bit) 16-bit RGB or RGBA
+// images, so only the color chunks are copied.
+func (cs *ChunkSlice) ExtractFrames(composite bool) (frames []*ChunkSlice, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	animation, err := cs.Animation()
+	log.PanicIf(err)
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(cs.chunks[0])
+	log.PanicIf(err)
+
+	ihdr := decoded.(*ChunkIHDR)
+
+	copied := make([]*Chunk, 0)
+	for _, c := range cs.chunks {
+		if frameCopyChunkTypes[c.Type] == true {
+			copied = append(copied, c)
+		}
+	}
+
+	frames = make([]*ChunkSlice, len(animation.Frames))
+	for i, frame := range animation.Frames {
+		frames[i], err = extractFrame(ihdr, copied, frame)
+		log.PanicIf(err)
+	}
+
+	if composite == false {
+		return frames, nil
+	}
+
+	frames, err = compositeFrames(ihdr, copied, animation, frames)
+	log.PanicIf(err)
+
+	return frames, nil
+}
+
+// extractFrame builds a standalone PNG from the frame's data.
+func extractFrame(ihdr *ChunkIHDR, copied []*Chunk, frame *AnimationFrame) (frameCs *ChunkSlice, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	frameIhdr := *ihdr
+	frameIhdr.Width = frame.Control.Width
+	frameIhdr.Height = frame.Control.Height
+
+	ce := NewChunkEncoder()
+
+	ihdrChunk, err := ce.Encode(&frameIhdr)
+	log.PanicIf(err)
+
+	chunks := []*Chunk{ihdrChunk}
+	chunks = append(chunks, copied...)
+
+	cd := NewChunkDecoder()
+
+	for _, c := range frame.DataChunks {
+		if c.Type == IDATChunkType {
+			chunks = append(chunks, c)
+			continue
+		}
+
+		decoded, err := cd.Decode(c)
+		log.PanicIf(err)
+
+		fdat := decoded.(*ChunkFDAT)
+		chunks = append(chunks, NewChunk(IDATChunkType, fdat.Data))
+	}
+
+	chunks = append(chunks, NewChunk(IENDChunkType, nil))
+
+	return NewChunkSlice(chunks), nil
+}
+
+// compositeFrames renders the extracted frames onto the canvas, applying the
+// blend and dispose operations, and returns a snapshot of the canvas after
+// each frame.
+func compositeFrames(ihdr *ChunkIHDR, copied []*Chunk, animation *Animation, extracted []*ChunkSlice) (frames []*ChunkSlice, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	canvasBounds := image.Rect(0, 0, int(ihdr.Width), int(ihdr.Height))
+
+	// Keep the precision of 16-bit animations.
+	newCanvas := func() draw.Image {
+		if ihdr.BitDepth == 16 {
+			return image.NewNRGBA64(canvasBounds)
+		}
+
+		return image.NewNRGBA(canvasBounds)
+	}
+
+	canvas := newCanvas()
+
+	colorChunks := make([]*Chunk, 0)
+	for _, c := range copied {
+		if paletteChunkTypes[c.Type] == false {
+			colorChunks = append(colorChunks, c)
+		}
+	}
+
+	frames = make([]*ChunkSlice, len(extracted))
+	for i, frame := range animation.Frames {
+		b := new(bytes.Buffer)
+
+		err := extracted[i].WriteTo(b)
+		log.PanicIf(err)
+
+		frameImage, err := png.Decode(b)
+		log.PanicIf(err)
+
+		fc := frame.Control
+
+		region := image.Rect(
+			int(fc.XOffset),
+			int(fc.YOffset),
+			int(fc.XOffset+fc.Width),
+			int(fc.YOffset+fc.Height))
+
+		if region.In(canvasBounds) == false {
+			log.Panicf("frame (%d) region not within canvas: %v", i, region)
+		}
+
+		var previous draw.Image
+		if fc.DisposeOp == DisposeOpPrevious {
+			previous = newCanvas()
+			draw.Draw(previous, canvasBounds, canvas, image.Point{}, draw.Src)
+		}
+
+		op := draw.Src
+		if fc.BlendOp == BlendOpOver {
+			op = draw.Over
+		}
+
+		draw.Draw(canvas, region, frameImage, frameImage.Bounds().Min, op)
+
+		b = new(bytes.Buffer)
+
+		err = png.Encode(b, canvas)
+		log.PanicIf(err)
+
+		pmp := NewPngMediaParser()
+
+		intfc, err := pmp.ParseBytes(b.Bytes())
+		log.PanicIf(err)
+
+		frameCs := intfc.(*ChunkSlice)
+		for _, c := range colorChunks {
+			frameCs.insertChunk(c, IDATChunkType)
+		}
+
+		frames[i] = frameCs
+
+		// Since the canvas starts out transparent, restoring the previous
+		// canvas after the first frame is the same as disposing to the
+		// background, as the specification requires.
+		if fc.DisposeOp == DisposeOpBackground {
+			draw.Draw(canvas, region, image.Transparent, image.Point{}, draw.Src)
+		} else if fc.DisposeOp == DisposeOpPrevious {
+			canvas = previous
+		}
+	}
+
+	return frames, nil
+}
@@ -0,0 +1,260 @@
+package pngstructure
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"testing"
+	"time"
+
+	"image/color"
+	"image/draw"
+	"image/png"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func decodeTestChunkSlice(cs *ChunkSlice) image.Image {
+	b := new(bytes.Buffer)
+
+	err := cs.WriteTo(b)
+	log.PanicIf(err)
+
+	img, err := png.Decode(b)
+	log.PanicIf(err)
+
+	return img
+}
+
+func TestChunkSlice_ExtractFrames(t *testing.T) {
+	cs := getTestAnimatedChunkSlice()
+
+	frames, err := cs.ExtractFrames(false)
+	log.PanicIf(err)
+
+	expected := getTestAnimationFrameImages()
+	if len(frames) != len(expected) {
+		t.Fatalf("frame count not correct: (%d)", len(frames))
+	}
+
+	for i, frameCs := range frames {
+		for _, c := range frameCs.Chunks() {
+			if c.Type == FDATChunkType || c.Type == FCTLChunkType || c.Type == ACTLChunkType {
+				t.Fatalf("frame (%d) has animation chunk: %s", i, c)
+			}
+		}
+
+		img := decodeTestChunkSlice(frameCs)
+		if img.Bounds() != expected[i].Bounds() {
+			t.Fatalf("frame (%d) bounds not correct: %v", i, img.Bounds())
+		}
+
+		for y := 0; y < expected[i].Bounds().Dy(); y++ {
+			for x := 0; x < expected[i].Bounds().Dx(); x++ {
+				if color.NRGBAModel.Convert(img.At(x, y)) != expected[i].At(x, y) {
+					t.Fatalf("frame (%d) pixel (%d, %d) not correct", i, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestChunkSlice_ExtractFrames_CopiesColorChunks(t *testing.T) {
+	cs := getTestAnimatedChunkSlice()
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(&ChunkGAMA{Gamma: 0.45455})
+	log.PanicIf(err)
+
+	cs.insertChunk(c, FCTLChunkType)
+
+	for _, composite := range []bool{false, true} {
+		frames, err := cs.ExtractFrames(composite)
+		log.PanicIf(err)
+
+		for i, frameCs := range frames {
+			if _, found := frameCs.Index()[GAMAChunkType]; found == false {
+				t.Fatalf("frame (%d) missing gAMA (composite=%v)", i, composite)
+			}
+		}
+	}
+}
+
+func TestChunkSlice_ExtractFrames_Composite(t *testing.T) {
+	cs := getTestAnimatedChunkSlice()
+
+	frames, err := cs.ExtractFrames(true)
+	log.PanicIf(err)
+
+	red := color.NRGBA{0xff, 0, 0, 0xff}
+	blue := color.NRGBA{0, 0, 0xff, 0xff}
+	transparent := color.NRGBA{}
+
+	images := make([]image.Image, len(frames))
+	for i, frameCs := range frames {
+		images[i] = decodeTestChunkSlice(frameCs)
+
+		if images[i].Bounds() != image.Rect(0, 0, 8, 8) {
+			t.Fatalf("frame (%d) not the size of the canvas: %v", i, images[i].Bounds())
+		}
+	}
+
+	at := func(i, x, y int) color.NRGBA {
+		return color.NRGBAModel.Convert(images[i].At(x, y)).(color.NRGBA)
+	}
+
+	if at(0, 0, 0) != transparent || at(0, 5, 5) != red {
+		t.Fatalf("first frame not correct")
+	}
+
+	// The second frame is blended over the first. Its own transparent pixel
+	// leaves the red showing.
+	if at(1, 0, 0) != transparent || at(1, 7, 7) != red || at(1, 2, 2) != red {
+		t.Fatalf("second frame not correct")
+	}
+
+	blended := at(1, 3, 3)
+	if blended.A != 0xff || blended.R < 0x70 || blended.R > 0x90 || blended.G < 0x70 || blended.G > 0x90 {
+		t.Fatalf("second frame not blended: %v", blended)
+	}
+
+	if at(2, 0, 0) != transparent || at(2, 3, 3) != blue || at(2, 7, 7) != blue {
+		t.Fatalf("third frame not correct")
+	}
+}
+
+func TestChunkSlice_ExtractFrames_Composite_16Bit(t *testing.T) {
+	colors := []color.NRGBA64{
+		{0x1234, 0x5678, 0x9abc, 0xffff},
+		{0xfedc, 0xba98, 0x7654, 0xffff},
+	}
+
+	frames := make([]*ChunkSlice, len(colors))
+	for i, c := range colors {
+		img := image.NewNRGBA64(image.Rect(0, 0, 2, 2))
+		draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+
+		frames[i] = getTestImageChunkSlice(img)
+	}
+
+	cs, err := AssembleAnimation(frames, []time.Duration{time.Second, time.Second}, 0)
+	log.PanicIf(err)
+
+	frames, err = cs.ExtractFrames(true)
+	log.PanicIf(err)
+
+	for i, frameCs := range frames {
+		ihdr, err := frameCs.decodeIhdr()
+		log.PanicIf(err)
+
+		if ihdr.BitDepth != 16 {
+			t.Fatalf("frame (%d) bit-depth not kept: (%d)", i, ihdr.BitDepth)
+		}
+
+		actual := color.NRGBA64Model.Convert(decodeTestChunkSlice(frameCs).At(1, 1)).(color.NRGBA64)
+		if actual != colors[i] {
+			t.Fatalf("frame (%d) color not exact: %v != %v", i, actual, colors[i])
+		}
+	}
+}
+
+func TestChunkSlice_ExtractFrames_DisposePrevious(t *testing.T) {
+	cs := getTestAnimatedChunkSlice()
+
+	// Have the second frame restore the first frame's canvas rather than
+	// clearing its region, and blend the third frame over the result.
+	ce := NewChunkEncoder()
+	cd := NewChunkDecoder()
+
+	n := 0
+	for i, c := range cs.Chunks() {
+		if c.Type != FCTLChunkType {
+			continue
+		}
+
+		decoded, err := cd.Decode(c)
+		log.PanicIf(err)
+
+		fctl := decoded.(*ChunkFCTL)
+		if n == 1 {
+			fctl.DisposeOp = DisposeOpPrevious
+		} else if n == 2 {
+			fctl.Width = 4
+			fctl.Height = 4
+			fctl.BlendOp = BlendOpOver
+		}
+
+		cs.chunks[i], err = ce.Encode(fctl)
+		log.PanicIf(err)
+
+		n++
+	}
+
+	// Use the smaller image for the third frame's data.
+	animation, err := cs.Animation()
+	log.PanicIf(err)
+
+	secondData := animation.Frames[1].DataChunks[0]
+	thirdData := animation.Frames[2].DataChunks[0]
+
+	for i, c := range cs.chunks {
+		if c == thirdData {
+			decoded, err := cd.Decode(secondData)
+			log.PanicIf(err)
+
+			fdat := decoded.(*ChunkFDAT)
+			fdat.SequenceNumber++
+
+			cs.chunks[i], err = ce.Encode(fdat)
+			log.PanicIf(err)
+		}
+	}
+
+	frames, err := cs.ExtractFrames(true)
+	log.PanicIf(err)
+
+	img := decodeTestChunkSlice(frames[2])
+
+	// The red of the first frame came back and the green was blended over it
+	// again (not over the previous green).
+	c := color.NRGBAModel.Convert(img.At(3, 3)).(color.NRGBA)
+	first := color.NRGBAModel.Convert(decodeTestChunkSlice(frames[1]).At(3, 3)).(color.NRGBA)
+
+	if c != first {
+		t.Fatalf("previous canvas not restored: %v != %v", c, first)
+	}
+}
+
+func TestChunkSlice_ExtractFrames_NotAnimated(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	_, err := cs.ExtractFrames(false)
+	if err == nil {
+		t.Fatalf("expected error for non-animated image")
+	} else if log.Is(err, ErrNotAnimated) != true {
+		log.Panic(err)
+	}
+}
+
+func ExampleChunkSlice_ExtractFrames() {
+	cs := getTestAnimatedChunkSlice()
+
+	frames, err := cs.ExtractFrames(false)
+	log.PanicIf(err)
+
+	cd := NewChunkDecoder()
+
+	for _, frameCs := range frames {
+		decoded, err := cd.Decode(frameCs.Chunks()[0])
+		log.PanicIf(err)
+
+		ihdr := decoded.(*ChunkIHDR)
+		fmt.Printf("%dx%d\n", ihdr.Width, ihdr.Height)
+	}
+
+	// Output:
+	// 8x8
+	// 4x4
+	// 8x8
+}
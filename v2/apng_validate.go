@@ -0,0 +1,178 @@
+package pngstructure
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"encoding/binary"
+
+	"github.com/dsoprea/go-logging"
+)
+
+var (
+	// ErrAnimationNotValid indicates that an APNG does not conform to the
+	// specification.
+	ErrAnimationNotValid = errors.New("animation not valid")
+)
+
+// chunkSequenceNumber reads the sequence-number at the front of an fcTL or
+// fdAT without loading the rest of a lazy chunk.
+func chunkSequenceNumber(c *Chunk) (sequenceNumber uint32, found bool) {
+	raw := make([]byte, 4)
+
+	_, err := io.ReadFull(c.payloadReader(), raw)
+	if err != nil {
+		return 0, false
+	}
+
+	return binary.BigEndian.Uint32(raw), true
+}
+
+// ValidateAnimation checks the APNG structure against the specification:
+// acTL must precede IDAT, the sequence numbers of the fcTL and fdAT chunks
+// must count up from zero, the acTL frame count must match the number of fcTL
+// chunks, every frame region must be within the canvas, and, if the default
+// image is a frame, its fcTL must describe the whole canvas. Returns
+// `ErrNotAnimated` if there is no acTL chunk and `ErrAnimationNotValid`
+// (describing every problem) if the structure is broken.
+//
+// `PngMediaParser` does not call this; it should be called on the result when
+// animations from untrusted sources must be well-formed.
+func (cs *ChunkSlice) ValidateAnimation() (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(cs.chunks[0])
+	log.PanicIf(err)
+
+	ihdr := decoded.(*ChunkIHDR)
+
+	problems := make([]string, 0)
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	var actl *ChunkACTL
+	actlCount := 0
+	fctlCount := 0
+	expectedSequenceNumber := uint32(0)
+	seenIdat := false
+	defaultImageFctls := 0
+
+	// frameHasData is nil before the first fcTL.
+	var frameHasData *bool
+
+	checkSequenceNumber := func(type_ string, sequenceNumber uint32) {
+		if sequenceNumber != expectedSequenceNumber {
+			addProblem("%s sequence-number (%d) not the expected (%d)", type_, sequenceNumber, expectedSequenceNumber)
+		}
+
+		expectedSequenceNumber = sequenceNumber + 1
+	}
+
+	checkFrameData := func() {
+		if frameHasData != nil && *frameHasData == false {
+			addProblem("frame (%d) has no data", fctlCount-1)
+		}
+	}
+
+	for _, c := range cs.chunks {
+		switch c.Type {
+		case ACTLChunkType:
+			actlCount++
+
+			decoded, err := cd.Decode(c)
+			if err != nil {
+				addProblem("acTL not valid: %s", err.Error())
+			} else if actl == nil {
+				actl = decoded.(*ChunkACTL)
+			}
+
+		case FCTLChunkType:
+			checkFrameData()
+
+			fctlCount++
+			hasData := false
+			frameHasData = &hasData
+
+			if sequenceNumber, found := chunkSequenceNumber(c); found == true {
+				checkSequenceNumber(c.Type, sequenceNumber)
+			}
+
+			decoded, err := cd.Decode(c)
+			if err != nil {
+				addProblem("fcTL (%d) not valid: %s", fctlCount-1, err.Error())
+				continue
+			}
+
+			fctl := decoded.(*ChunkFCTL)
+
+			if uint64(fctl.XOffset)+uint64(fctl.Width) > uint64(ihdr.Width) || uint64(fctl.YOffset)+uint64(fctl.Height) > uint64(ihdr.Height) {
+				addProblem("frame (%d) region (%d, %d)+(%d, %d) not within the canvas (%d, %d)", fctlCount-1, fctl.XOffset, fctl.YOffset, fctl.Width, fctl.Height, ihdr.Width, ihdr.Height)
+			}
+
+			if seenIdat == false {
+				defaultImageFctls++
+
+				if fctl.XOffset != 0 || fctl.YOffset != 0 || fctl.Width != ihdr.Width || fctl.Height != ihdr.Height {
+					addProblem("fcTL for the default image does not match IHDR: %s", fctl)
+				}
+			}
+
+		case IDATChunkType:
+			if seenIdat == false && actlCount == 0 {
+				addProblem("acTL not before IDAT")
+			}
+
+			seenIdat = true
+
+			if frameHasData != nil {
+				*frameHasData = true
+			}
+
+		case FDATChunkType:
+			if seenIdat == false {
+				addProblem("fdAT before IDAT")
+			} else if frameHasData == nil {
+				addProblem("fdAT without a preceding fcTL")
+			} else {
+				*frameHasData = true
+			}
+
+			if sequenceNumber, found := chunkSequenceNumber(c); found == false {
+				addProblem("fdAT too short")
+			} else {
+				checkSequenceNumber(c.Type, sequenceNumber)
+			}
+		}
+	}
+
+	checkFrameData()
+
+	if actlCount == 0 {
+		log.Panic(ErrNotAnimated)
+	} else if actlCount > 1 {
+		addProblem("more than one acTL")
+	}
+
+	if defaultImageFctls > 1 {
+		addProblem("more than one fcTL before IDAT")
+	}
+
+	if actl != nil && actl.NumFrames != uint32(fctlCount) {
+		addProblem("acTL frame-count (%d) does not match the number of fcTL chunks (%d)", actl.NumFrames, fctlCount)
+	}
+
+	if len(problems) > 0 {
+		log.Panicf("%w: %s", ErrAnimationNotValid, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
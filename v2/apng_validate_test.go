@@ -0,0 +1,134 @@
+package pngstructure
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// rewriteTestFctl decodes the nth fcTL, applies the change, and re-encodes it
+// in place.
+func rewriteTestFctl(cs *ChunkSlice, n int, change func(fctl *ChunkFCTL)) {
+	cd := NewChunkDecoder()
+	ce := NewChunkEncoder()
+
+	for i, c := range cs.chunks {
+		if c.Type != FCTLChunkType {
+			continue
+		}
+
+		if n == 0 {
+			decoded, err := cd.Decode(c)
+			log.PanicIf(err)
+
+			fctl := decoded.(*ChunkFCTL)
+			change(fctl)
+
+			cs.chunks[i], err = ce.Encode(fctl)
+			log.PanicIf(err)
+
+			return
+		}
+
+		n--
+	}
+
+	log.Panicf("fcTL not found")
+}
+
+func assertAnimationProblem(t *testing.T, cs *ChunkSlice, expected string) {
+	err := cs.ValidateAnimation()
+	if err == nil {
+		t.Fatalf("expected problem: [%s]", expected)
+	} else if log.Is(err, ErrAnimationNotValid) != true {
+		log.Panic(err)
+	} else if strings.Contains(err.Error(), expected) != true {
+		t.Fatalf("problem not reported: [%s] not in [%s]", expected, err.Error())
+	}
+}
+
+func TestChunkSlice_ValidateAnimation(t *testing.T) {
+	cs := getTestAnimatedChunkSlice()
+
+	err := cs.ValidateAnimation()
+	log.PanicIf(err)
+}
+
+func TestChunkSlice_ValidateAnimation_NotAnimated(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	err := cs.ValidateAnimation()
+	if err == nil {
+		t.Fatalf("expected error for non-animated image")
+	} else if log.Is(err, ErrNotAnimated) != true {
+		log.Panic(err)
+	}
+}
+
+func TestChunkSlice_ValidateAnimation_SequenceNumbers(t *testing.T) {
+	cs := getTestAnimatedChunkSlice()
+
+	rewriteTestFctl(cs, 1, func(fctl *ChunkFCTL) {
+		fctl.SequenceNumber = 7
+	})
+
+	assertAnimationProblem(t, cs, "fcTL sequence-number (7) not the expected (1)")
+}
+
+func TestChunkSlice_ValidateAnimation_FrameCount(t *testing.T) {
+	cs := getTestAnimatedChunkSlice()
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(&ChunkACTL{NumFrames: 2})
+	log.PanicIf(err)
+
+	cs.chunks[1] = c
+
+	assertAnimationProblem(t, cs, "acTL frame-count (2) does not match the number of fcTL chunks (3)")
+}
+
+func TestChunkSlice_ValidateAnimation_Region(t *testing.T) {
+	cs := getTestAnimatedChunkSlice()
+
+	rewriteTestFctl(cs, 1, func(fctl *ChunkFCTL) {
+		fctl.XOffset = 5
+	})
+
+	assertAnimationProblem(t, cs, "frame (1) region (5, 2)+(4, 4) not within the canvas (8, 8)")
+}
+
+func TestChunkSlice_ValidateAnimation_DefaultImage(t *testing.T) {
+	cs := getTestAnimatedChunkSlice()
+
+	rewriteTestFctl(cs, 0, func(fctl *ChunkFCTL) {
+		fctl.Width = 4
+	})
+
+	assertAnimationProblem(t, cs, "fcTL for the default image does not match IHDR")
+}
+
+func TestChunkSlice_ValidateAnimation_ActlAfterIdat(t *testing.T) {
+	cs := getTestAnimatedChunkSlice()
+
+	actl := cs.chunks[1]
+	cs.removeChunks(func(c *Chunk) bool {
+		return c == actl
+	})
+
+	cs.insertChunk(actl)
+
+	assertAnimationProblem(t, cs, "acTL not before IDAT")
+}
+
+func ExampleChunkSlice_ValidateAnimation() {
+	cs := getTestAnimatedChunkSlice()
+
+	err := cs.ValidateAnimation()
+	fmt.Printf("%v\n", err)
+
+	// Output:
+	// <nil>
+}
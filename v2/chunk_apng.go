@@ -0,0 +1,324 @@
+package pngstructure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"encoding/binary"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// Dispose operations, as stored in fcTL. These describe what happens to the
+// frame region before the next frame is rendered.
+const (
+	DisposeOpNone       = uint8(0)
+	DisposeOpBackground = uint8(1)
+	DisposeOpPrevious   = uint8(2)
+)
+
+// Blend operations, as stored in fcTL. These describe how the frame is
+// combined with the output buffer.
+const (
+	BlendOpSource = uint8(0)
+	BlendOpOver   = uint8(1)
+)
+
+const (
+	// defaultDelayDenominator is used when the fcTL delay denominator is
+	// zero (the delay is then in hundredths of a second).
+	defaultDelayDenominator = 100
+)
+
+var (
+	// ErrNotAnimated indicates that there is no acTL chunk.
+	ErrNotAnimated = errors.New("not an animated png")
+)
+
+// ChunkACTL describes an acTL chunk: the animation control.
+type ChunkACTL struct {
+	NumFrames uint32
+
+	// NumPlays is the number of times to loop. Zero means forever.
+	NumPlays uint32
+}
+
+func (ca *ChunkACTL) String() string {
+	return fmt.Sprintf("acTL<FRAMES=(%d) PLAYS=(%d)>", ca.NumFrames, ca.NumPlays)
+}
+
+// ChunkFCTL describes an fcTL chunk: the control for one frame. The field
+// order matches the encoding.
+type ChunkFCTL struct {
+	SequenceNumber uint32
+	Width          uint32
+	Height         uint32
+	XOffset        uint32
+	YOffset        uint32
+	DelayNum       uint16
+	DelayDen       uint16
+	DisposeOp      uint8
+	BlendOp        uint8
+}
+
+func (cf *ChunkFCTL) String() string {
+	return fmt.Sprintf("fcTL<SEQ=(%d) WIDTH=(%d) HEIGHT=(%d) X=(%d) Y=(%d) DELAY=(%d/%d) DISPOSE=(%d) BLEND=(%d)>", cf.SequenceNumber, cf.Width, cf.Height, cf.XOffset, cf.YOffset, cf.DelayNum, cf.DelayDen, cf.DisposeOp, cf.BlendOp)
+}
+
+// Delay returns the time that the frame is displayed for.
+func (cf *ChunkFCTL) Delay() time.Duration {
+	den := cf.DelayDen
+	if den == 0 {
+		den = defaultDelayDenominator
+	}
+
+	return time.Duration(cf.DelayNum) * time.Second / time.Duration(den)
+}
+
+// validate checks the values that do not depend on the IHDR.
+func (cf *ChunkFCTL) validate() (err error) {
+	if cf.Width == 0 || cf.Height == 0 {
+		return log.Errorf("fcTL dimensions must be non-zero: (%d, %d)", cf.Width, cf.Height)
+	} else if cf.DisposeOp > DisposeOpPrevious {
+		return log.Errorf("fcTL dispose-op not valid: (%d)", cf.DisposeOp)
+	} else if cf.BlendOp > BlendOpOver {
+		return log.Errorf("fcTL blend-op not valid: (%d)", cf.BlendOp)
+	}
+
+	return nil
+}
+
+// ChunkFDAT describes an fdAT chunk: image data for a frame after the first.
+// The data is identical to what an IDAT would have.
+type ChunkFDAT struct {
+	SequenceNumber uint32
+	Data           []byte
+}
+
+func (cf *ChunkFDAT) String() string {
+	return fmt.Sprintf("fdAT<SEQ=(%d) LEN=(%d)>", cf.SequenceNumber, len(cf.Data))
+}
+
+func (cd *ChunkDecoder) decodeACTL(c *Chunk) (ca *ChunkACTL, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if len(c.Data) != 8 {
+		log.Panicf("acTL chunk length not correct: (%d)", len(c.Data))
+	}
+
+	ca = &ChunkACTL{
+		NumFrames: binary.BigEndian.Uint32(c.Data[0:4]),
+		NumPlays:  binary.BigEndian.Uint32(c.Data[4:8]),
+	}
+
+	if ca.NumFrames == 0 {
+		log.Panicf("acTL frame count must be non-zero")
+	}
+
+	return ca, nil
+}
+
+func (cd *ChunkDecoder) decodeFCTL(c *Chunk) (cf *ChunkFCTL, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if len(c.Data) != 26 {
+		log.Panicf("fcTL chunk length not correct: (%d)", len(c.Data))
+	}
+
+	cf = new(ChunkFCTL)
+
+	err = binary.Read(bytes.NewBuffer(c.Data), binary.BigEndian, cf)
+	log.PanicIf(err)
+
+	err = cf.validate()
+	log.PanicIf(err)
+
+	return cf, nil
+}
+
+func (cd *ChunkDecoder) decodeFDAT(c *Chunk) (cf *ChunkFDAT, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if len(c.Data) < 4 {
+		log.Panicf("fdAT chunk too short")
+	}
+
+	cf = &ChunkFDAT{
+		SequenceNumber: binary.BigEndian.Uint32(c.Data[0:4]),
+		Data:           c.Data[4:],
+	}
+
+	return cf, nil
+}
+
+func (ce *ChunkEncoder) encodeACTL(ca *ChunkACTL) (data []byte, err error) {
+	if ca.NumFrames == 0 {
+		return nil, log.Errorf("acTL frame count must be non-zero")
+	}
+
+	data = make([]byte, 8)
+	binary.BigEndian.PutUint32(data[0:4], ca.NumFrames)
+	binary.BigEndian.PutUint32(data[4:8], ca.NumPlays)
+
+	return data, nil
+}
+
+func (ce *ChunkEncoder) encodeFCTL(cf *ChunkFCTL) (data []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = cf.validate()
+	log.PanicIf(err)
+
+	b := new(bytes.Buffer)
+
+	err = binary.Write(b, binary.BigEndian, cf)
+	log.PanicIf(err)
+
+	return b.Bytes(), nil
+}
+
+func (ce *ChunkEncoder) encodeFDAT(cf *ChunkFDAT) (data []byte, err error) {
+	data = make([]byte, 4, 4+len(cf.Data))
+	binary.BigEndian.PutUint32(data, cf.SequenceNumber)
+
+	data = append(data, cf.Data...)
+
+	return data, nil
+}
+
+// AnimationFrame is one frame of an animation.
+type AnimationFrame struct {
+	Control *ChunkFCTL
+
+	// IsDefaultImage is true if the frame's data is the IDAT data (the image
+	// shown by decoders that don't support animation).
+	IsDefaultImage bool
+
+	// DataChunks are the IDAT or fdAT chunks that hold the frame's data.
+	DataChunks []*Chunk
+}
+
+func (af *AnimationFrame) String() string {
+	return fmt.Sprintf("AnimationFrame<SEQ=(%d) DEFAULT=[%v] DATA-CHUNKS=(%d)>", af.Control.SequenceNumber, af.IsDefaultImage, len(af.DataChunks))
+}
+
+// Animation describes the structure of an APNG.
+type Animation struct {
+	Control *ChunkACTL
+
+	// DefaultImageIsFrame is true if the default image is the first frame of
+	// the animation. Otherwise it is only shown by decoders that don't
+	// support animation.
+	DefaultImageIsFrame bool
+
+	Frames []*AnimationFrame
+}
+
+func (a *Animation) String() string {
+	return fmt.Sprintf("Animation<FRAMES=(%d) PLAYS=(%d) DEFAULT-IS-FRAME=[%v]>", len(a.Frames), a.Control.NumPlays, a.DefaultImageIsFrame)
+}
+
+// Duration returns the time that one play of the animation takes.
+func (a *Animation) Duration() time.Duration {
+	total := time.Duration(0)
+	for _, frame := range a.Frames {
+		total += frame.Control.Delay()
+	}
+
+	return total
+}
+
+// Animation groups the chunks into frames. No image data is decoded. Returns
+// `ErrNotAnimated` if there is no acTL chunk.
+func (cs *ChunkSlice) Animation() (animation *Animation, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	cd := NewChunkDecoder()
+
+	var current *AnimationFrame
+	seenIdat := false
+
+	for _, c := range cs.chunks {
+		switch c.Type {
+		case ACTLChunkType:
+			if animation != nil {
+				log.Panicf("more than one acTL chunk")
+			}
+
+			decoded, err := cd.Decode(c)
+			log.PanicIf(err)
+
+			animation = &Animation{
+				Control: decoded.(*ChunkACTL),
+				Frames:  make([]*AnimationFrame, 0),
+			}
+
+		case FCTLChunkType:
+			if animation == nil {
+				log.Panicf("fcTL chunk before acTL chunk")
+			}
+
+			decoded, err := cd.Decode(c)
+			log.PanicIf(err)
+
+			current = &AnimationFrame{
+				Control:    decoded.(*ChunkFCTL),
+				DataChunks: make([]*Chunk, 0),
+			}
+
+			animation.Frames = append(animation.Frames, current)
+
+		case IDATChunkType:
+			// The default image is only a frame if its fcTL precedes the
+			// IDATs.
+			if seenIdat == false && current != nil {
+				current.IsDefaultImage = true
+				animation.DefaultImageIsFrame = true
+			}
+
+			seenIdat = true
+
+			if current != nil && current.IsDefaultImage == true {
+				current.DataChunks = append(current.DataChunks, c)
+			}
+
+		case FDATChunkType:
+			if current == nil || current.IsDefaultImage == true {
+				log.Panicf("fdAT chunk without a preceding fcTL chunk")
+			}
+
+			current.DataChunks = append(current.DataChunks, c)
+		}
+	}
+
+	if animation == nil {
+		log.Panic(ErrNotAnimated)
+	}
+
+	return animation, nil
+}
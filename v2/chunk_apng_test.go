@@ -0,0 +1,159 @@
+package pngstructure
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func TestChunkEncoder_Encode_Apng_Cycle(t *testing.T) {
+	decodedList := []interface{}{
+		&ChunkACTL{NumFrames: 3, NumPlays: 2},
+		&ChunkFCTL{SequenceNumber: 5, Width: 10, Height: 20, XOffset: 1, YOffset: 2, DelayNum: 1, DelayDen: 25, DisposeOp: DisposeOpPrevious, BlendOp: BlendOpOver},
+		&ChunkFDAT{SequenceNumber: 6, Data: []byte{1, 2, 3}},
+	}
+
+	ce := NewChunkEncoder()
+	cd := NewChunkDecoder()
+
+	for _, decoded := range decodedList {
+		c, err := ce.Encode(decoded)
+		log.PanicIf(err)
+
+		recovered, err := cd.Decode(c)
+		log.PanicIf(err)
+
+		if reflect.DeepEqual(recovered, decoded) != true {
+			t.Fatalf("chunk not recovered correctly: %s != %s", recovered, decoded)
+		}
+	}
+}
+
+func TestChunkDecoder_decodeFCTL_NotValid(t *testing.T) {
+	ce := NewChunkEncoder()
+
+	_, err := ce.Encode(&ChunkFCTL{Width: 0, Height: 1})
+	if err == nil {
+		t.Fatalf("expected error for zero width")
+	}
+
+	_, err = ce.Encode(&ChunkFCTL{Width: 1, Height: 1, DisposeOp: 3})
+	if err == nil {
+		t.Fatalf("expected error for dispose-op")
+	}
+
+	cd := NewChunkDecoder()
+
+	_, err = cd.Decode(NewChunk(FCTLChunkType, make([]byte, 25)))
+	if err == nil {
+		t.Fatalf("expected error for short fcTL")
+	}
+
+	_, err = cd.Decode(NewChunk(ACTLChunkType, make([]byte, 8)))
+	if err == nil {
+		t.Fatalf("expected error for zero frame-count")
+	}
+}
+
+func TestChunkFCTL_Delay(t *testing.T) {
+	cf := &ChunkFCTL{DelayNum: 1, DelayDen: 3}
+	if cf.Delay() != time.Second/3 {
+		t.Fatalf("delay not correct: %s", cf.Delay())
+	}
+
+	// A zero denominator means hundredths.
+	cf = &ChunkFCTL{DelayNum: 7}
+	if cf.Delay() != 70*time.Millisecond {
+		t.Fatalf("delay not correct with zero denominator: %s", cf.Delay())
+	}
+}
+
+func TestChunkSlice_Animation(t *testing.T) {
+	cs := getTestAnimatedChunkSlice()
+
+	animation, err := cs.Animation()
+	log.PanicIf(err)
+
+	if animation.Control.NumFrames != 3 || animation.Control.NumPlays != 0 {
+		t.Fatalf("acTL not correct: %s", animation.Control)
+	} else if animation.DefaultImageIsFrame != true {
+		t.Fatalf("default image should be a frame")
+	} else if len(animation.Frames) != 3 {
+		t.Fatalf("frame count not correct: (%d)", len(animation.Frames))
+	}
+
+	expectedTypes := []string{IDATChunkType, FDATChunkType, FDATChunkType}
+	expectedDelays := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 30 * time.Millisecond}
+
+	for i, frame := range animation.Frames {
+		if frame.IsDefaultImage != (i == 0) {
+			t.Fatalf("frame (%d) default-image flag not correct", i)
+		} else if len(frame.DataChunks) == 0 || frame.DataChunks[0].Type != expectedTypes[i] {
+			t.Fatalf("frame (%d) data chunks not correct", i)
+		} else if frame.Control.Delay() != expectedDelays[i] {
+			t.Fatalf("frame (%d) delay not correct: %s", i, frame.Control.Delay())
+		}
+	}
+
+	if animation.Frames[1].Control.XOffset != 2 || animation.Frames[1].Control.BlendOp != BlendOpOver {
+		t.Fatalf("second frame control not correct: %s", animation.Frames[1].Control)
+	}
+
+	if animation.Duration() != 330*time.Millisecond {
+		t.Fatalf("duration not correct: %s", animation.Duration())
+	}
+}
+
+func TestChunkSlice_Animation_DefaultImageNotFrame(t *testing.T) {
+	cs := getTestAnimatedChunkSlice()
+
+	// Move the first fcTL after the IDAT so that the default image is
+	// excluded. The frame then has no data, but the grouping still holds.
+	chunks := cs.Chunks()
+
+	fctl := chunks[2]
+	cs.removeChunks(func(c *Chunk) bool {
+		return c == fctl
+	})
+
+	cs.insertChunk(fctl, FCTLChunkType)
+
+	animation, err := cs.Animation()
+	log.PanicIf(err)
+
+	if animation.DefaultImageIsFrame != false {
+		t.Fatalf("default image should not be a frame")
+	} else if animation.Frames[0].IsDefaultImage != false {
+		t.Fatalf("first frame should not be the default image")
+	}
+}
+
+func TestChunkSlice_Animation_NotAnimated(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	_, err := cs.Animation()
+	if err == nil {
+		t.Fatalf("expected error for non-animated image")
+	} else if log.Is(err, ErrNotAnimated) != true {
+		log.Panic(err)
+	}
+}
+
+func ExampleChunkSlice_Animation() {
+	cs := getTestAnimatedChunkSlice()
+
+	animation, err := cs.Animation()
+	log.PanicIf(err)
+
+	for _, frame := range animation.Frames {
+		fmt.Printf("%dx%d at (%d, %d) for %s\n", frame.Control.Width, frame.Control.Height, frame.Control.XOffset, frame.Control.YOffset, frame.Control.Delay())
+	}
+
+	// Output:
+	// 8x8 at (0, 0) for 100ms
+	// 4x4 at (2, 2) for 200ms
+	// 8x8 at (0, 0) for 30ms
+}
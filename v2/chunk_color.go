@@ -0,0 +1,359 @@
+package pngstructure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+
+	"encoding/binary"
+
+	"github.com/dsoprea/go-logging"
+)
+
+const (
+	// fixedPointScale is the scale of the fixed-point values in gAMA and
+	// cHRM.
+	fixedPointScale = 100000
+)
+
+// Rendering intents, as stored in sRGB.
+const (
+	RenderingIntentPerceptual           = uint8(0)
+	RenderingIntentRelativeColorimetric = uint8(1)
+	RenderingIntentSaturation           = uint8(2)
+	RenderingIntentAbsoluteColorimetric = uint8(3)
+)
+
+var (
+	renderingIntentNames = map[uint8]string{
+		RenderingIntentPerceptual:           "perceptual",
+		RenderingIntentRelativeColorimetric: "relative-colorimetric",
+		RenderingIntentSaturation:           "saturation",
+		RenderingIntentAbsoluteColorimetric: "absolute-colorimetric",
+	}
+)
+
+var (
+	// ErrNoColorSpace indicates that there aren't any chunks describing the
+	// color-space.
+	ErrNoColorSpace = errors.New("no color-space information")
+)
+
+// toFixedPoint converts to the PNG fixed-point representation.
+func toFixedPoint(value float64) uint32 {
+	return uint32(math.Round(value * fixedPointScale))
+}
+
+// fromFixedPoint converts from the PNG fixed-point representation.
+func fromFixedPoint(value uint32) float64 {
+	return float64(value) / fixedPointScale
+}
+
+// ChunkGAMA describes a gAMA chunk.
+type ChunkGAMA struct {
+	// Gamma is the image gamma (e.g. 0.45455 for a 1/2.2 encoding).
+	Gamma float64
+}
+
+func (cg *ChunkGAMA) String() string {
+	return fmt.Sprintf("gAMA<GAMA=(%.5f)>", cg.Gamma)
+}
+
+// ChunkCHRM describes a cHRM chunk. All values are CIE 1931 xy
+// chromaticities.
+type ChunkCHRM struct {
+	WhitePointX float64
+	WhitePointY float64
+	RedX        float64
+	RedY        float64
+	GreenX      float64
+	GreenY      float64
+	BlueX       float64
+	BlueY       float64
+}
+
+func (cc *ChunkCHRM) String() string {
+	return fmt.Sprintf("cHRM<WHITE=(%.5f, %.5f) RED=(%.5f, %.5f) GREEN=(%.5f, %.5f) BLUE=(%.5f, %.5f)>", cc.WhitePointX, cc.WhitePointY, cc.RedX, cc.RedY, cc.GreenX, cc.GreenY, cc.BlueX, cc.BlueY)
+}
+
+// ChunkSRGB describes an sRGB chunk.
+type ChunkSRGB struct {
+	RenderingIntent uint8
+}
+
+func (cs *ChunkSRGB) String() string {
+	return fmt.Sprintf("sRGB<INTENT=[%s]>", cs.RenderingIntentName())
+}
+
+// RenderingIntentName returns a descriptive name for the rendering intent.
+func (cs *ChunkSRGB) RenderingIntentName() string {
+	if name, found := renderingIntentNames[cs.RenderingIntent]; found == true {
+		return name
+	}
+
+	return fmt.Sprintf("unknown (%d)", cs.RenderingIntent)
+}
+
+// ChunkCICP describes a cICP chunk. The values are code-points from ITU-T
+// H.273.
+type ChunkCICP struct {
+	ColorPrimaries     uint8
+	TransferFunction   uint8
+	MatrixCoefficients uint8
+	VideoFullRangeFlag bool
+}
+
+func (cc *ChunkCICP) String() string {
+	return fmt.Sprintf("cICP<PRIMARIES=(%d) TRANSFER=(%d) MATRIX=(%d) FULL-RANGE=[%v]>", cc.ColorPrimaries, cc.TransferFunction, cc.MatrixCoefficients, cc.VideoFullRangeFlag)
+}
+
+func (cd *ChunkDecoder) decodeGAMA(c *Chunk) (cg *ChunkGAMA, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if len(c.Data) != 4 {
+		log.Panicf("gAMA chunk length not correct: (%d)", len(c.Data))
+	}
+
+	cg = &ChunkGAMA{
+		Gamma: fromFixedPoint(binary.BigEndian.Uint32(c.Data)),
+	}
+
+	return cg, nil
+}
+
+func (cd *ChunkDecoder) decodeCHRM(c *Chunk) (cc *ChunkCHRM, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if len(c.Data) != 32 {
+		log.Panicf("cHRM chunk length not correct: (%d)", len(c.Data))
+	}
+
+	values := make([]uint32, 8)
+
+	err = binary.Read(bytes.NewBuffer(c.Data), binary.BigEndian, values)
+	log.PanicIf(err)
+
+	cc = &ChunkCHRM{
+		WhitePointX: fromFixedPoint(values[0]),
+		WhitePointY: fromFixedPoint(values[1]),
+		RedX:        fromFixedPoint(values[2]),
+		RedY:        fromFixedPoint(values[3]),
+		GreenX:      fromFixedPoint(values[4]),
+		GreenY:      fromFixedPoint(values[5]),
+		BlueX:       fromFixedPoint(values[6]),
+		BlueY:       fromFixedPoint(values[7]),
+	}
+
+	return cc, nil
+}
+
+func (cd *ChunkDecoder) decodeSRGB(c *Chunk) (cs *ChunkSRGB, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if len(c.Data) != 1 {
+		log.Panicf("sRGB chunk length not correct: (%d)", len(c.Data))
+	}
+
+	cs = &ChunkSRGB{
+		RenderingIntent: c.Data[0],
+	}
+
+	return cs, nil
+}
+
+func (cd *ChunkDecoder) decodeCICP(c *Chunk) (cc *ChunkCICP, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if len(c.Data) != 4 {
+		log.Panicf("cICP chunk length not correct: (%d)", len(c.Data))
+	} else if c.Data[3] > 1 {
+		log.Panicf("cICP full-range flag not valid: (%d)", c.Data[3])
+	}
+
+	cc = &ChunkCICP{
+		ColorPrimaries:     c.Data[0],
+		TransferFunction:   c.Data[1],
+		MatrixCoefficients: c.Data[2],
+		VideoFullRangeFlag: c.Data[3] == 1,
+	}
+
+	return cc, nil
+}
+
+func (ce *ChunkEncoder) encodeGAMA(cg *ChunkGAMA) (data []byte, err error) {
+	if cg.Gamma <= 0 {
+		return nil, log.Errorf("gamma must be positive: (%f)", cg.Gamma)
+	}
+
+	data = make([]byte, 4)
+	binary.BigEndian.PutUint32(data, toFixedPoint(cg.Gamma))
+
+	return data, nil
+}
+
+func (ce *ChunkEncoder) encodeCHRM(cc *ChunkCHRM) (data []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	values := []float64{
+		cc.WhitePointX, cc.WhitePointY,
+		cc.RedX, cc.RedY,
+		cc.GreenX, cc.GreenY,
+		cc.BlueX, cc.BlueY,
+	}
+
+	b := new(bytes.Buffer)
+	for _, value := range values {
+		if value < 0 {
+			log.Panicf("chromaticity must not be negative: (%f)", value)
+		}
+
+		err := binary.Write(b, binary.BigEndian, toFixedPoint(value))
+		log.PanicIf(err)
+	}
+
+	return b.Bytes(), nil
+}
+
+func (ce *ChunkEncoder) encodeSRGB(cs *ChunkSRGB) (data []byte, err error) {
+	if cs.RenderingIntent > RenderingIntentAbsoluteColorimetric {
+		return nil, log.Errorf("rendering intent not valid: (%d)", cs.RenderingIntent)
+	}
+
+	return []byte{cs.RenderingIntent}, nil
+}
+
+func (ce *ChunkEncoder) encodeCICP(cc *ChunkCICP) (data []byte, err error) {
+	// PNG only stores RGB, so this must always be zero (identity).
+	if cc.MatrixCoefficients != 0 {
+		return nil, log.Errorf("cICP matrix coefficients must be zero: (%d)", cc.MatrixCoefficients)
+	}
+
+	fullRange := uint8(0)
+	if cc.VideoFullRangeFlag == true {
+		fullRange = 1
+	}
+
+	data = []byte{
+		cc.ColorPrimaries,
+		cc.TransferFunction,
+		cc.MatrixCoefficients,
+		fullRange,
+	}
+
+	return data, nil
+}
+
+// ColorSpace describes the color-space information that applies to the image.
+// Only the chunks that take effect are set.
+type ColorSpace struct {
+	// Source is the type of the chunk that determines the color-space. If it
+	// is cHRM or gAMA, either or both of `Chromaticities` and `Gamma` may be
+	// set.
+	Source string
+
+	Cicp           *ChunkCICP
+	Icc            *ChunkICCP
+	Srgb           *ChunkSRGB
+	Chromaticities *ChunkCHRM
+	Gamma          *ChunkGAMA
+}
+
+func (cs *ColorSpace) String() string {
+	return fmt.Sprintf("ColorSpace<SOURCE=[%s]>", cs.Source)
+}
+
+// ColorSpace resolves the color-space chunks according to the precedence in
+// the PNG Third Edition: cICP, then iCCP, then sRGB, and finally cHRM and
+// gAMA.
+func (cs *ChunkSlice) ColorSpace() (colorSpace *ColorSpace, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	index := cs.Index()
+	cd := NewChunkDecoder()
+
+	decodeFirst := func(type_ string) interface{} {
+		chunks, found := index[type_]
+		if found == false {
+			return nil
+		}
+
+		decoded, err := cd.Decode(chunks[0])
+		log.PanicIf(err)
+
+		return decoded
+	}
+
+	if decoded := decodeFirst(CICPChunkType); decoded != nil {
+		colorSpace = &ColorSpace{
+			Source: CICPChunkType,
+			Cicp:   decoded.(*ChunkCICP),
+		}
+
+		return colorSpace, nil
+	}
+
+	if decoded := decodeFirst(ICCPChunkType); decoded != nil {
+		colorSpace = &ColorSpace{
+			Source: ICCPChunkType,
+			Icc:    decoded.(*ChunkICCP),
+		}
+
+		return colorSpace, nil
+	}
+
+	if decoded := decodeFirst(SRGBChunkType); decoded != nil {
+		colorSpace = &ColorSpace{
+			Source: SRGBChunkType,
+			Srgb:   decoded.(*ChunkSRGB),
+		}
+
+		return colorSpace, nil
+	}
+
+	colorSpace = new(ColorSpace)
+
+	if decoded := decodeFirst(GAMAChunkType); decoded != nil {
+		colorSpace.Source = GAMAChunkType
+		colorSpace.Gamma = decoded.(*ChunkGAMA)
+	}
+
+	if decoded := decodeFirst(CHRMChunkType); decoded != nil {
+		colorSpace.Source = CHRMChunkType
+		colorSpace.Chromaticities = decoded.(*ChunkCHRM)
+	}
+
+	if colorSpace.Source == "" {
+		log.Panic(ErrNoColorSpace)
+	}
+
+	return colorSpace, nil
+}
@@ -0,0 +1,205 @@
+package pngstructure
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func TestChunkDecoder_decodeGAMA(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(cs.Index()[GAMAChunkType][0])
+	log.PanicIf(err)
+
+	cg := decoded.(*ChunkGAMA)
+	if cg.Gamma != 0.45455 {
+		t.Fatalf("gamma not correct: (%f)", cg.Gamma)
+	}
+}
+
+func TestChunkDecoder_decodeCHRM(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(cs.Index()[CHRMChunkType][0])
+	log.PanicIf(err)
+
+	expected := &ChunkCHRM{
+		WhitePointX: 0.3127,
+		WhitePointY: 0.329,
+		RedX:        0.64,
+		RedY:        0.33,
+		GreenX:      0.3,
+		GreenY:      0.6,
+		BlueX:       0.15,
+		BlueY:       0.06,
+	}
+
+	if reflect.DeepEqual(decoded, expected) != true {
+		t.Fatalf("cHRM not correct: %s", decoded)
+	}
+}
+
+func TestChunkDecoder_decodeSRGB(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(cs.Index()[SRGBChunkType][0])
+	log.PanicIf(err)
+
+	srgb := decoded.(*ChunkSRGB)
+	if srgb.RenderingIntent != RenderingIntentRelativeColorimetric {
+		t.Fatalf("rendering intent not correct: (%d)", srgb.RenderingIntent)
+	} else if srgb.RenderingIntentName() != "relative-colorimetric" {
+		t.Fatalf("rendering intent name not correct: [%s]", srgb.RenderingIntentName())
+	}
+}
+
+func TestChunkEncoder_Encode_Colorimetry_Cycle(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+	index := cs.Index()
+
+	cd := NewChunkDecoder()
+	ce := NewChunkEncoder()
+
+	for _, type_ := range []string{GAMAChunkType, CHRMChunkType, SRGBChunkType} {
+		original := index[type_][0]
+
+		decoded, err := cd.Decode(original)
+		log.PanicIf(err)
+
+		c, err := ce.Encode(decoded)
+		log.PanicIf(err)
+
+		if reflect.DeepEqual(c.Bytes(), original.Bytes()) != true {
+			t.Fatalf("[%s] chunk not re-encoded correctly", type_)
+		}
+	}
+}
+
+func TestChunkCICP_Cycle(t *testing.T) {
+	// BT.2100 PQ, full-range.
+	original := &ChunkCICP{
+		ColorPrimaries:     9,
+		TransferFunction:   16,
+		MatrixCoefficients: 0,
+		VideoFullRangeFlag: true,
+	}
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(original)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(c.Data, []byte{9, 16, 0, 1}) != true {
+		t.Fatalf("cICP not encoded correctly")
+	}
+
+	cd := NewChunkDecoder()
+
+	recovered, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(recovered, original) != true {
+		t.Fatalf("cICP not recovered correctly: %s", recovered)
+	}
+}
+
+func TestChunkCICP_Encode_MatrixCoefficients(t *testing.T) {
+	cc := &ChunkCICP{
+		ColorPrimaries:     1,
+		TransferFunction:   13,
+		MatrixCoefficients: 1,
+	}
+
+	ce := NewChunkEncoder()
+
+	_, err := ce.Encode(cc)
+	if err == nil {
+		t.Fatalf("expected error for non-zero matrix coefficients")
+	}
+}
+
+func TestChunkSlice_ColorSpace_Precedence(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	colorSpace, err := cs.ColorSpace()
+	log.PanicIf(err)
+
+	if colorSpace.Source != SRGBChunkType || colorSpace.Srgb == nil {
+		t.Fatalf("sRGB should take precedence over cHRM/gAMA: %s", colorSpace)
+	} else if colorSpace.Gamma != nil || colorSpace.Chromaticities != nil {
+		t.Fatalf("overridden chunks should not be set")
+	}
+
+	err = cs.SetIccProfile("Test profile", getTestIccProfile())
+	log.PanicIf(err)
+
+	colorSpace, err = cs.ColorSpace()
+	log.PanicIf(err)
+
+	if colorSpace.Source != ICCPChunkType || colorSpace.Icc == nil {
+		t.Fatalf("iCCP should take precedence: %s", colorSpace)
+	}
+
+	ce := NewChunkEncoder()
+
+	cicpChunk, err := ce.Encode(&ChunkCICP{ColorPrimaries: 1, TransferFunction: 13, VideoFullRangeFlag: true})
+	log.PanicIf(err)
+
+	cs.insertChunk(cicpChunk, PLTEChunkType, IDATChunkType)
+
+	colorSpace, err = cs.ColorSpace()
+	log.PanicIf(err)
+
+	if colorSpace.Source != CICPChunkType || colorSpace.Cicp == nil {
+		t.Fatalf("cICP should take precedence: %s", colorSpace)
+	}
+}
+
+func TestChunkSlice_ColorSpace_Fallback(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	cs.removeChunks(func(c *Chunk) bool {
+		return c.Type == SRGBChunkType
+	})
+
+	colorSpace, err := cs.ColorSpace()
+	log.PanicIf(err)
+
+	if colorSpace.Source != CHRMChunkType {
+		t.Fatalf("source not correct: [%s]", colorSpace.Source)
+	} else if colorSpace.Gamma == nil || colorSpace.Chromaticities == nil {
+		t.Fatalf("cHRM and gAMA should both be set")
+	}
+}
+
+func TestChunkSlice_ColorSpace_Miss(t *testing.T) {
+	cs := NewPngChunkSlice()
+
+	_, err := cs.ColorSpace()
+	if err == nil {
+		t.Fatalf("expected error for missing color-space")
+	} else if log.Is(err, ErrNoColorSpace) != true {
+		log.Panic(err)
+	}
+}
+
+func ExampleChunkSlice_ColorSpace() {
+	cs := getTestBasicChunkSlice()
+
+	colorSpace, err := cs.ColorSpace()
+	log.PanicIf(err)
+
+	fmt.Printf("%s\n", colorSpace.Srgb)
+
+	// Output:
+	// sRGB<INTENT=[relative-colorimetric]>
+}
@@ -2,34 +2,242 @@ package pngstructure
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 
 	"encoding/binary"
+	"image/color"
 
 	"github.com/dsoprea/go-logging"
 )
 
+// Color types, as stored in IHDR.
+const (
+	ColorTypeGrayscale      = uint8(0)
+	ColorTypeRgb            = uint8(2)
+	ColorTypeIndexed        = uint8(3)
+	ColorTypeGrayscaleAlpha = uint8(4)
+	ColorTypeRgba           = uint8(6)
+)
+
+var (
+	// allowedBitDepths are the bit-depths that each color-type allows.
+	allowedBitDepths = map[uint8][]uint8{
+		ColorTypeGrayscale:      {1, 2, 4, 8, 16},
+		ColorTypeRgb:            {8, 16},
+		ColorTypeIndexed:        {1, 2, 4, 8},
+		ColorTypeGrayscaleAlpha: {8, 16},
+		ColorTypeRgba:           {8, 16},
+	}
+)
+
+// isValidBitDepth returns true if the color-type and bit-depth are an allowed
+// combination.
+func isValidBitDepth(colorType, bitDepth uint8) bool {
+	for _, allowed := range allowedBitDepths[colorType] {
+		if bitDepth == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	// ErrNoIhdr indicates that a chunk can not be interpreted without the
+	// IHDR.
+	ErrNoIhdr = errors.New("ihdr required")
+)
+
+// ChunkDecoder decodes chunks. Some chunks can only be interpreted in the
+// context of the IHDR (and PLTE) chunks. These are recorded as they are
+// decoded (they always come first in a stream) or can be set explicitly.
 type ChunkDecoder struct {
+	ihdr    *ChunkIHDR
+	palette color.Palette
 }
 
 func NewChunkDecoder() *ChunkDecoder {
 	return new(ChunkDecoder)
 }
 
+// SetIhdr sets the IHDR that subsequent chunks are interpreted against.
+func (cd *ChunkDecoder) SetIhdr(ihdr *ChunkIHDR) {
+	cd.ihdr = ihdr
+}
+
+// SetPalette sets the palette that subsequent chunks are interpreted against.
+func (cd *ChunkDecoder) SetPalette(palette color.Palette) {
+	cd.palette = palette
+}
+
+// Decode returns a struct describing the given chunk or nil if we don't decode
+// that type. A malformed chunk is returned as an error rather than a panic,
+// since the data usually comes from an untrusted file.
 func (cd *ChunkDecoder) Decode(c *Chunk) (decoded interface{}, err error) {
 	defer func() {
 		if state := recover(); state != nil {
-			err := log.Wrap(state.(error))
-			log.Panic(err)
+			err = log.Wrap(state.(error))
 		}
 	}()
 
+	err = c.Load()
+	log.PanicIf(err)
+
 	switch c.Type {
 	case "IHDR":
 		ihdr, err := cd.decodeIHDR(c)
 		log.PanicIf(err)
 
+		cd.ihdr = ihdr
+
 		return ihdr, nil
+
+	case PLTEChunkType:
+		cp, err := cd.decodePLTE(c)
+		log.PanicIf(err)
+
+		cd.palette = cp.Palette
+
+		return cp, nil
+
+	case TRNSChunkType:
+		ct, err := cd.decodeTRNS(c)
+		log.PanicIf(err)
+
+		return ct, nil
+
+	case BKGDChunkType:
+		cb, err := cd.decodeBKGD(c)
+		log.PanicIf(err)
+
+		return cb, nil
+
+	case HISTChunkType:
+		ch, err := cd.decodeHIST(c)
+		log.PanicIf(err)
+
+		return ch, nil
+
+	case SPLTChunkType:
+		cs, err := cd.decodeSPLT(c)
+		log.PanicIf(err)
+
+		return cs, nil
+
+	case PHYSChunkType:
+		cp, err := cd.decodePHYS(c)
+		log.PanicIf(err)
+
+		return cp, nil
+
+	case OFFSChunkType:
+		co, err := cd.decodeOFFS(c)
+		log.PanicIf(err)
+
+		return co, nil
+
+	case SCALChunkType:
+		cs, err := cd.decodeSCAL(c)
+		log.PanicIf(err)
+
+		return cs, nil
+
+	case PCALChunkType:
+		cp, err := cd.decodePCAL(c)
+		log.PanicIf(err)
+
+		return cp, nil
+
+	case TIMEChunkType:
+		ct, err := cd.decodeTIME(c)
+		log.PanicIf(err)
+
+		return ct, nil
+
+	case SBITChunkType:
+		cs, err := cd.decodeSBIT(c)
+		log.PanicIf(err)
+
+		return cs, nil
+
+	case ACTLChunkType:
+		ca, err := cd.decodeACTL(c)
+		log.PanicIf(err)
+
+		return ca, nil
+
+	case FCTLChunkType:
+		cf, err := cd.decodeFCTL(c)
+		log.PanicIf(err)
+
+		return cf, nil
+
+	case FDATChunkType:
+		cf, err := cd.decodeFDAT(c)
+		log.PanicIf(err)
+
+		return cf, nil
+
+	case TEXtChunkType:
+		ct, err := cd.decodeText(c)
+		log.PanicIf(err)
+
+		return ct, nil
+
+	case ZTXtChunkType:
+		cct, err := cd.decodeCompressedText(c)
+		log.PanicIf(err)
+
+		return cct, nil
+
+	case ITXtChunkType:
+		cit, err := cd.decodeInternationalText(c)
+		log.PanicIf(err)
+
+		return cit, nil
+
+	case ICCPChunkType:
+		ci, err := cd.decodeICCP(c)
+		log.PanicIf(err)
+
+		return ci, nil
+
+	case GAMAChunkType:
+		cg, err := cd.decodeGAMA(c)
+		log.PanicIf(err)
+
+		return cg, nil
+
+	case CHRMChunkType:
+		cc, err := cd.decodeCHRM(c)
+		log.PanicIf(err)
+
+		return cc, nil
+
+	case SRGBChunkType:
+		cs, err := cd.decodeSRGB(c)
+		log.PanicIf(err)
+
+		return cs, nil
+
+	case CICPChunkType:
+		cc, err := cd.decodeCICP(c)
+		log.PanicIf(err)
+
+		return cc, nil
+
+	case MDCVChunkType:
+		cm, err := cd.decodeMDCV(c)
+		log.PanicIf(err)
+
+		return cm, nil
+
+	case CLLIChunkType:
+		cc, err := cd.decodeCLLI(c)
+		log.PanicIf(err)
+
+		return cc, nil
 	}
 
 	// We don't decode this particular type.
@@ -47,6 +47,30 @@ func TestChunkDecoder_decodeIHDR(t *testing.T) {
 	}
 }
 
+func TestChunkDecoder_Decode_Malformed(t *testing.T) {
+	cd := NewChunkDecoder()
+
+	malformed := []*Chunk{
+		NewChunk(IHDRChunkType, []byte{0x00, 0x00}),
+		NewChunk(TEXtChunkType, []byte("no separator")),
+	}
+
+	for _, c := range malformed {
+		func() {
+			defer func() {
+				if state := recover(); state != nil {
+					t.Fatalf("Decode panicked for [%s]: %v", c.Type, state)
+				}
+			}()
+
+			_, err := cd.Decode(c)
+			if err == nil {
+				t.Fatalf("expected error for malformed [%s]", c.Type)
+			}
+		}()
+	}
+}
+
 func ExampleChunkDecoder_Decode() {
 	filepath := path.Join(assetsPath, "Selection_058.png")
 
@@ -0,0 +1,156 @@
+package pngstructure
+
+import (
+	"bytes"
+	"reflect"
+
+	"encoding/binary"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// ChunkEncoder knows how to produce raw chunks from the structs returned by
+// `ChunkDecoder`.
+type ChunkEncoder struct {
+}
+
+func NewChunkEncoder() *ChunkEncoder {
+	return new(ChunkEncoder)
+}
+
+// Encode returns a new chunk, with the length and CRC calculated, for the given
+// decoded-chunk struct.
+func (ce *ChunkEncoder) Encode(decoded interface{}) (c *Chunk, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	var type_ string
+	var data []byte
+
+	switch t := decoded.(type) {
+	case *ChunkIHDR:
+		type_ = IHDRChunkType
+		data, err = ce.encodeIHDR(t)
+
+	case *ChunkText:
+		type_ = TEXtChunkType
+		data, err = ce.encodeText(t)
+
+	case *ChunkCompressedText:
+		type_ = ZTXtChunkType
+		data, err = ce.encodeCompressedText(t)
+
+	case *ChunkInternationalText:
+		type_ = ITXtChunkType
+		data, err = ce.encodeInternationalText(t)
+
+	case *ChunkICCP:
+		type_ = ICCPChunkType
+		data, err = ce.encodeICCP(t)
+
+	case *ChunkGAMA:
+		type_ = GAMAChunkType
+		data, err = ce.encodeGAMA(t)
+
+	case *ChunkCHRM:
+		type_ = CHRMChunkType
+		data, err = ce.encodeCHRM(t)
+
+	case *ChunkSRGB:
+		type_ = SRGBChunkType
+		data, err = ce.encodeSRGB(t)
+
+	case *ChunkCICP:
+		type_ = CICPChunkType
+		data, err = ce.encodeCICP(t)
+
+	case *ChunkMDCV:
+		type_ = MDCVChunkType
+		data, err = ce.encodeMDCV(t)
+
+	case *ChunkCLLI:
+		type_ = CLLIChunkType
+		data, err = ce.encodeCLLI(t)
+
+	case *ChunkPLTE:
+		type_ = PLTEChunkType
+		data, err = ce.encodePLTE(t)
+
+	case *ChunkTRNS:
+		type_ = TRNSChunkType
+		data, err = ce.encodeTRNS(t)
+
+	case *ChunkBKGD:
+		type_ = BKGDChunkType
+		data, err = ce.encodeBKGD(t)
+
+	case *ChunkHIST:
+		type_ = HISTChunkType
+		data, err = ce.encodeHIST(t)
+
+	case *ChunkSPLT:
+		type_ = SPLTChunkType
+		data, err = ce.encodeSPLT(t)
+
+	case *ChunkPHYS:
+		type_ = PHYSChunkType
+		data, err = ce.encodePHYS(t)
+
+	case *ChunkOFFS:
+		type_ = OFFSChunkType
+		data, err = ce.encodeOFFS(t)
+
+	case *ChunkSCAL:
+		type_ = SCALChunkType
+		data, err = ce.encodeSCAL(t)
+
+	case *ChunkPCAL:
+		type_ = PCALChunkType
+		data, err = ce.encodePCAL(t)
+
+	case *ChunkTIME:
+		type_ = TIMEChunkType
+		data, err = ce.encodeTIME(t)
+
+	case *ChunkSBIT:
+		type_ = SBITChunkType
+		data, err = ce.encodeSBIT(t)
+
+	case *ChunkACTL:
+		type_ = ACTLChunkType
+		data, err = ce.encodeACTL(t)
+
+	case *ChunkFCTL:
+		type_ = FCTLChunkType
+		data, err = ce.encodeFCTL(t)
+
+	case *ChunkFDAT:
+		type_ = FDATChunkType
+		data, err = ce.encodeFDAT(t)
+
+	default:
+		log.Panicf("can not encode chunk of type [%v]", reflect.TypeOf(decoded))
+	}
+
+	log.PanicIf(err)
+
+	return NewChunk(type_, data), nil
+}
+
+func (ce *ChunkEncoder) encodeIHDR(ihdr *ChunkIHDR) (data []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	b := new(bytes.Buffer)
+
+	err = binary.Write(b, binary.BigEndian, ihdr)
+	log.PanicIf(err)
+
+	return b.Bytes(), nil
+}
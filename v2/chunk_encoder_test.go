@@ -0,0 +1,61 @@
+package pngstructure
+
+import (
+	"bytes"
+	"path"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func TestChunkEncoder_Encode_IHDR(t *testing.T) {
+	filepath := path.Join(assetsPath, "Selection_058.png")
+
+	pmp := NewPngMediaParser()
+
+	intfc, err := pmp.ParseFile(filepath)
+	log.PanicIf(err)
+
+	cs := intfc.(*ChunkSlice)
+	original := cs.Index()[IHDRChunkType][0]
+
+	cd := NewChunkDecoder()
+
+	ihdr, err := cd.Decode(original)
+	log.PanicIf(err)
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(ihdr)
+	log.PanicIf(err)
+
+	if bytes.Compare(c.Bytes(), original.Bytes()) != 0 {
+		t.Fatalf("encoded IHDR not correct")
+	}
+}
+
+func TestChunkEncoder_Encode_Unsupported(t *testing.T) {
+	ce := NewChunkEncoder()
+
+	_, err := ce.Encode("not a chunk")
+	if err == nil {
+		t.Fatalf("expected error for unsupported type")
+	}
+}
+
+func ExampleChunkEncoder_Encode() {
+	ct := &ChunkText{
+		Keyword: "Title",
+		Text:    "Some title",
+	}
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(ct)
+	log.PanicIf(err)
+
+	cs := NewPngChunkSlice()
+	cs.chunks = append(cs.chunks, c)
+
+	// Output:
+}
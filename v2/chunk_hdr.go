@@ -0,0 +1,287 @@
+package pngstructure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"encoding/binary"
+
+	"github.com/dsoprea/go-logging"
+)
+
+const (
+	// mdcvChromaticityScale is the scale of the mDCv chromaticities (units of
+	// 0.00002).
+	mdcvChromaticityScale = 50000
+
+	// luminanceScale is the scale of the mDCv and cLLi luminance values
+	// (units of 0.0001 cd/m2).
+	luminanceScale = 10000
+
+	// maxPlausibleLuminance is the ceiling of the PQ transfer function, in
+	// cd/m2.
+	maxPlausibleLuminance = 10000
+)
+
+var (
+	// ErrImplausibleHdrMetadata indicates HDR metadata values outside of
+	// plausible ranges.
+	ErrImplausibleHdrMetadata = errors.New("hdr metadata not plausible")
+)
+
+// ChunkMDCV describes a mDCv (mastering display color volume) chunk. The
+// chromaticities are CIE 1931 xy and the luminances are in cd/m2.
+type ChunkMDCV struct {
+	RedX        float64
+	RedY        float64
+	GreenX      float64
+	GreenY      float64
+	BlueX       float64
+	BlueY       float64
+	WhitePointX float64
+	WhitePointY float64
+
+	MaxLuminance float64
+	MinLuminance float64
+}
+
+func (cm *ChunkMDCV) String() string {
+	return fmt.Sprintf("mDCv<RED=(%.5f, %.5f) GREEN=(%.5f, %.5f) BLUE=(%.5f, %.5f) WHITE=(%.5f, %.5f) MAX-LUM=(%.4f) MIN-LUM=(%.4f)>", cm.RedX, cm.RedY, cm.GreenX, cm.GreenY, cm.BlueX, cm.BlueY, cm.WhitePointX, cm.WhitePointY, cm.MaxLuminance, cm.MinLuminance)
+}
+
+// Validate returns `ErrImplausibleHdrMetadata` (describing every problem) if
+// any value is outside of a plausible range.
+func (cm *ChunkMDCV) Validate() (err error) {
+	problems := make([]string, 0)
+
+	chromaticities := map[string][2]float64{
+		"red":         {cm.RedX, cm.RedY},
+		"green":       {cm.GreenX, cm.GreenY},
+		"blue":        {cm.BlueX, cm.BlueY},
+		"white-point": {cm.WhitePointX, cm.WhitePointY},
+	}
+
+	for _, name := range []string{"red", "green", "blue", "white-point"} {
+		xy := chromaticities[name]
+		if xy[0] < 0 || xy[1] < 0 || xy[0]+xy[1] > 1 {
+			problems = append(problems, fmt.Sprintf("%s chromaticity (%.5f, %.5f) not in the CIE xy gamut", name, xy[0], xy[1]))
+		}
+	}
+
+	if cm.MaxLuminance <= 0 || cm.MaxLuminance > maxPlausibleLuminance {
+		problems = append(problems, fmt.Sprintf("max luminance (%.4f) not in (0, %d]", cm.MaxLuminance, maxPlausibleLuminance))
+	}
+
+	if cm.MinLuminance < 0 || cm.MinLuminance >= cm.MaxLuminance {
+		problems = append(problems, fmt.Sprintf("min luminance (%.4f) not in [0, max luminance)", cm.MinLuminance))
+	}
+
+	return hdrProblemsError(problems)
+}
+
+// ChunkCLLI describes a cLLi (content light level information) chunk. Both
+// values are in cd/m2.
+type ChunkCLLI struct {
+	// MaxContentLightLevel is the MaxCLL: the brightest pixel in the
+	// content.
+	MaxContentLightLevel float64
+
+	// MaxFrameAverageLightLevel is the MaxFALL: the brightest frame average
+	// in the content.
+	MaxFrameAverageLightLevel float64
+}
+
+func (cc *ChunkCLLI) String() string {
+	return fmt.Sprintf("cLLi<MAX-CLL=(%.4f) MAX-FALL=(%.4f)>", cc.MaxContentLightLevel, cc.MaxFrameAverageLightLevel)
+}
+
+// Validate returns `ErrImplausibleHdrMetadata` (describing every problem) if
+// any value is outside of a plausible range.
+func (cc *ChunkCLLI) Validate() (err error) {
+	problems := make([]string, 0)
+
+	if cc.MaxContentLightLevel < 0 || cc.MaxContentLightLevel > maxPlausibleLuminance {
+		problems = append(problems, fmt.Sprintf("MaxCLL (%.4f) not in [0, %d]", cc.MaxContentLightLevel, maxPlausibleLuminance))
+	}
+
+	if cc.MaxFrameAverageLightLevel < 0 || cc.MaxFrameAverageLightLevel > cc.MaxContentLightLevel {
+		problems = append(problems, fmt.Sprintf("MaxFALL (%.4f) not in [0, MaxCLL]", cc.MaxFrameAverageLightLevel))
+	}
+
+	return hdrProblemsError(problems)
+}
+
+func hdrProblemsError(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return log.Errorf("%w: %s", ErrImplausibleHdrMetadata, strings.Join(problems, "; "))
+}
+
+func (cd *ChunkDecoder) decodeMDCV(c *Chunk) (cm *ChunkMDCV, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if len(c.Data) != 24 {
+		log.Panicf("mDCv chunk length not correct: (%d)", len(c.Data))
+	}
+
+	chromaticities := make([]uint16, 8)
+	luminances := make([]uint32, 2)
+
+	b := bytes.NewBuffer(c.Data)
+
+	err = binary.Read(b, binary.BigEndian, chromaticities)
+	log.PanicIf(err)
+
+	err = binary.Read(b, binary.BigEndian, luminances)
+	log.PanicIf(err)
+
+	cm = &ChunkMDCV{
+		RedX:         float64(chromaticities[0]) / mdcvChromaticityScale,
+		RedY:         float64(chromaticities[1]) / mdcvChromaticityScale,
+		GreenX:       float64(chromaticities[2]) / mdcvChromaticityScale,
+		GreenY:       float64(chromaticities[3]) / mdcvChromaticityScale,
+		BlueX:        float64(chromaticities[4]) / mdcvChromaticityScale,
+		BlueY:        float64(chromaticities[5]) / mdcvChromaticityScale,
+		WhitePointX:  float64(chromaticities[6]) / mdcvChromaticityScale,
+		WhitePointY:  float64(chromaticities[7]) / mdcvChromaticityScale,
+		MaxLuminance: float64(luminances[0]) / luminanceScale,
+		MinLuminance: float64(luminances[1]) / luminanceScale,
+	}
+
+	return cm, nil
+}
+
+func (cd *ChunkDecoder) decodeCLLI(c *Chunk) (cc *ChunkCLLI, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if len(c.Data) != 8 {
+		log.Panicf("cLLi chunk length not correct: (%d)", len(c.Data))
+	}
+
+	cc = &ChunkCLLI{
+		MaxContentLightLevel:      float64(binary.BigEndian.Uint32(c.Data[0:4])) / luminanceScale,
+		MaxFrameAverageLightLevel: float64(binary.BigEndian.Uint32(c.Data[4:8])) / luminanceScale,
+	}
+
+	return cc, nil
+}
+
+func (ce *ChunkEncoder) encodeMDCV(cm *ChunkMDCV) (data []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	chromaticities := []float64{
+		cm.RedX, cm.RedY,
+		cm.GreenX, cm.GreenY,
+		cm.BlueX, cm.BlueY,
+		cm.WhitePointX, cm.WhitePointY,
+	}
+
+	b := new(bytes.Buffer)
+
+	for _, value := range chromaticities {
+		scaled := math.Round(value * mdcvChromaticityScale)
+		if scaled < 0 || scaled > math.MaxUint16 {
+			log.Panicf("mDCv chromaticity can not be encoded: (%f)", value)
+		}
+
+		err := binary.Write(b, binary.BigEndian, uint16(scaled))
+		log.PanicIf(err)
+	}
+
+	for _, value := range []float64{cm.MaxLuminance, cm.MinLuminance} {
+		scaled := math.Round(value * luminanceScale)
+		if scaled < 0 || scaled > math.MaxUint32 {
+			log.Panicf("mDCv luminance can not be encoded: (%f)", value)
+		}
+
+		err := binary.Write(b, binary.BigEndian, uint32(scaled))
+		log.PanicIf(err)
+	}
+
+	return b.Bytes(), nil
+}
+
+func (ce *ChunkEncoder) encodeCLLI(cc *ChunkCLLI) (data []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	b := new(bytes.Buffer)
+
+	for _, value := range []float64{cc.MaxContentLightLevel, cc.MaxFrameAverageLightLevel} {
+		scaled := math.Round(value * luminanceScale)
+		if scaled < 0 || scaled > math.MaxUint32 {
+			log.Panicf("cLLi light level can not be encoded: (%f)", value)
+		}
+
+		err := binary.Write(b, binary.BigEndian, uint32(scaled))
+		log.PanicIf(err)
+	}
+
+	return b.Bytes(), nil
+}
+
+// SetMasteringDisplayColorVolume validates and sets the mDCv chunk, replacing
+// any existing one. The chunk is always placed before IDAT, as required.
+func (cs *ChunkSlice) SetMasteringDisplayColorVolume(cm *ChunkMDCV) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = cm.Validate()
+	log.PanicIf(err)
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(cm)
+	log.PanicIf(err)
+
+	cs.replaceChunk(c, IDATChunkType)
+
+	return nil
+}
+
+// SetContentLightLevel validates and sets the cLLi chunk, replacing any
+// existing one. The chunk is always placed before IDAT, as required.
+func (cs *ChunkSlice) SetContentLightLevel(cc *ChunkCLLI) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = cc.Validate()
+	log.PanicIf(err)
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(cc)
+	log.PanicIf(err)
+
+	cs.replaceChunk(c, IDATChunkType)
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package pngstructure
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// getTestMdcv returns BT.2020 primaries with a D65 white-point mastered on a
+// 1000 cd/m2 display.
+func getTestMdcv() *ChunkMDCV {
+	return &ChunkMDCV{
+		RedX:         0.708,
+		RedY:         0.292,
+		GreenX:       0.17,
+		GreenY:       0.797,
+		BlueX:        0.131,
+		BlueY:        0.046,
+		WhitePointX:  0.3127,
+		WhitePointY:  0.329,
+		MaxLuminance: 1000,
+		MinLuminance: 0.0001,
+	}
+}
+
+func TestChunkMDCV_Cycle(t *testing.T) {
+	original := getTestMdcv()
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(original)
+	log.PanicIf(err)
+
+	if c.Type != MDCVChunkType || c.Length != 24 {
+		t.Fatalf("mDCv chunk not correct: %s", c)
+	}
+
+	// The red-x chromaticity in units of 0.00002.
+	if bytes.Compare(c.Data[0:2], []byte{0x8a, 0x48}) != 0 {
+		t.Fatalf("chromaticity not scaled correctly")
+	}
+
+	cd := NewChunkDecoder()
+
+	recovered, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(recovered, original) != true {
+		t.Fatalf("mDCv not recovered correctly: %s", recovered)
+	}
+}
+
+func TestChunkCLLI_Cycle(t *testing.T) {
+	original := &ChunkCLLI{
+		MaxContentLightLevel:      1000,
+		MaxFrameAverageLightLevel: 400.5,
+	}
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(original)
+	log.PanicIf(err)
+
+	if bytes.Compare(c.Data, []byte{0x00, 0x98, 0x96, 0x80, 0x00, 0x3d, 0x1c, 0x88}) != 0 {
+		t.Fatalf("cLLi not encoded correctly")
+	}
+
+	cd := NewChunkDecoder()
+
+	recovered, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(recovered, original) != true {
+		t.Fatalf("cLLi not recovered correctly: %s", recovered)
+	}
+}
+
+func TestChunkMDCV_Validate(t *testing.T) {
+	cm := getTestMdcv()
+
+	err := cm.Validate()
+	log.PanicIf(err)
+
+	cm.RedX = 0.9
+	cm.MinLuminance = 2000
+
+	err = cm.Validate()
+	if err == nil {
+		t.Fatalf("expected error for implausible values")
+	} else if log.Is(err, ErrImplausibleHdrMetadata) != true {
+		log.Panic(err)
+	}
+}
+
+func TestChunkCLLI_Validate(t *testing.T) {
+	cc := &ChunkCLLI{
+		MaxContentLightLevel:      1000,
+		MaxFrameAverageLightLevel: 1200,
+	}
+
+	err := cc.Validate()
+	if err == nil {
+		t.Fatalf("expected error for MaxFALL above MaxCLL")
+	} else if log.Is(err, ErrImplausibleHdrMetadata) != true {
+		log.Panic(err)
+	}
+}
+
+func TestChunkSlice_SetMasteringDisplayColorVolume(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	err := cs.SetMasteringDisplayColorVolume(getTestMdcv())
+	log.PanicIf(err)
+
+	cm := getTestMdcv()
+	cm.MaxLuminance = 4000
+
+	err = cs.SetMasteringDisplayColorVolume(cm)
+	log.PanicIf(err)
+
+	err = cs.SetContentLightLevel(&ChunkCLLI{MaxContentLightLevel: 4000, MaxFrameAverageLightLevel: 500})
+	log.PanicIf(err)
+
+	index := cs.Index()
+	if len(index[MDCVChunkType]) != 1 || len(index[CLLIChunkType]) != 1 {
+		t.Fatalf("expected exactly one mDCv and one cLLi chunk")
+	}
+
+	seen := 0
+	for _, c := range cs.Chunks() {
+		if c.Type == MDCVChunkType || c.Type == CLLIChunkType {
+			seen++
+		} else if c.Type == IDATChunkType && seen != 2 {
+			t.Fatalf("HDR chunks not placed before IDAT")
+		}
+	}
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(index[MDCVChunkType][0])
+	log.PanicIf(err)
+
+	if decoded.(*ChunkMDCV).MaxLuminance != 4000 {
+		t.Fatalf("mDCv not replaced")
+	}
+}
+
+func TestChunkSlice_SetMasteringDisplayColorVolume_AfterImageData(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	ce := NewChunkEncoder()
+
+	mdcvChunk, err := ce.Encode(getTestMdcv())
+	log.PanicIf(err)
+
+	clliChunk, err := ce.Encode(&ChunkCLLI{MaxContentLightLevel: 1000, MaxFrameAverageLightLevel: 400})
+	log.PanicIf(err)
+
+	// Put the existing chunks after the image data.
+	cs.insertChunk(mdcvChunk)
+	cs.insertChunk(clliChunk)
+
+	err = cs.SetMasteringDisplayColorVolume(getTestMdcv())
+	log.PanicIf(err)
+
+	err = cs.SetContentLightLevel(&ChunkCLLI{MaxContentLightLevel: 4000, MaxFrameAverageLightLevel: 500})
+	log.PanicIf(err)
+
+	index := cs.Index()
+	if len(index[MDCVChunkType]) != 1 || len(index[CLLIChunkType]) != 1 {
+		t.Fatalf("expected exactly one mDCv and one cLLi chunk")
+	}
+
+	seen := 0
+	for _, c := range cs.Chunks() {
+		if c.Type == MDCVChunkType || c.Type == CLLIChunkType {
+			seen++
+		} else if c.Type == IDATChunkType && seen != 2 {
+			t.Fatalf("HDR chunks not moved before IDAT")
+		}
+	}
+}
+
+func TestChunkSlice_SetContentLightLevel_Implausible(t *testing.T) {
+	cs := NewPngChunkSlice()
+
+	err := cs.SetContentLightLevel(&ChunkCLLI{MaxContentLightLevel: 20000})
+	if err == nil {
+		t.Fatalf("expected error for implausible MaxCLL")
+	} else if log.Is(err, ErrImplausibleHdrMetadata) != true {
+		log.Panic(err)
+	} else if len(cs.Chunks()) != 1 {
+		t.Fatalf("chunk should not have been added")
+	}
+}
+
+func ExampleChunkSlice_SetContentLightLevel() {
+	cs := NewPngChunkSlice()
+
+	cc := &ChunkCLLI{
+		MaxContentLightLevel:      1000,
+		MaxFrameAverageLightLevel: 400,
+	}
+
+	err := cs.SetContentLightLevel(cc)
+	log.PanicIf(err)
+
+	fmt.Printf("%s\n", cs.Index()[CLLIChunkType][0])
+
+	// Output:
+	// Chunk<OFFSET=(0) LENGTH=(8) TYPE=[cLLi] CRC=(3615658867)>
+}
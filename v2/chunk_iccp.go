@@ -0,0 +1,212 @@
+package pngstructure
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"encoding/binary"
+
+	"github.com/dsoprea/go-logging"
+)
+
+const (
+	// iccHeaderSize is the size of the fixed header at the top of every ICC
+	// profile.
+	iccHeaderSize = 128
+)
+
+var (
+	// ErrNoIccProfile indicates that there is no iCCP chunk.
+	ErrNoIccProfile = errors.New("no icc profile")
+
+	// ErrIccHeaderNotValid indicates that the profile data doesn't have a
+	// recognizable ICC header.
+	ErrIccHeaderNotValid = errors.New("icc profile header not valid")
+)
+
+// ChunkICCP describes an iCCP chunk. The profile has already been inflated.
+type ChunkICCP struct {
+	ProfileName       string
+	CompressionMethod uint8
+	Profile           []byte
+}
+
+func (ci *ChunkICCP) String() string {
+	return fmt.Sprintf("iCCP<NAME=[%s] COMP-METHOD=(%d) PROFILE-LEN=(%d)>", ci.ProfileName, ci.CompressionMethod, len(ci.Profile))
+}
+
+// IccProfileHeader describes the interesting parts of the fixed header of an
+// ICC profile.
+type IccProfileHeader struct {
+	Size uint32
+
+	// PreferredCmm is the signature of the preferred color-management module.
+	PreferredCmm string
+
+	MajorVersion  uint8
+	MinorVersion  uint8
+	BugfixVersion uint8
+
+	// DeviceClass is the profile/device class signature (e.g. "mntr", "prtr",
+	// "scnr").
+	DeviceClass string
+
+	// ColorSpace is the data color-space signature (e.g. "RGB ", "GRAY",
+	// "CMYK").
+	ColorSpace string
+
+	// ConnectionSpace is the profile connection-space signature ("XYZ " or
+	// "Lab ").
+	ConnectionSpace string
+
+	RenderingIntent uint32
+}
+
+func (iph *IccProfileHeader) String() string {
+	return fmt.Sprintf("IccProfileHeader<SIZE=(%d) VERSION=[%s] CLASS=[%s] COLOR-SPACE=[%s] PCS=[%s] INTENT=(%d)>", iph.Size, iph.Version(), iph.DeviceClass, iph.ColorSpace, iph.ConnectionSpace, iph.RenderingIntent)
+}
+
+// Version returns the profile version as a dotted string.
+func (iph *IccProfileHeader) Version() string {
+	return fmt.Sprintf("%d.%d.%d", iph.MajorVersion, iph.MinorVersion, iph.BugfixVersion)
+}
+
+// ParseIccProfileHeader parses the fixed header at the front of an ICC
+// profile.
+func ParseIccProfileHeader(profile []byte) (iph *IccProfileHeader, err error) {
+	if len(profile) < iccHeaderSize {
+		return nil, ErrIccHeaderNotValid
+	}
+
+	// Every profile carries this magic at offset 36.
+	if string(profile[36:40]) != "acsp" {
+		return nil, ErrIccHeaderNotValid
+	}
+
+	iph = &IccProfileHeader{
+		Size:            binary.BigEndian.Uint32(profile[0:4]),
+		PreferredCmm:    strings.TrimRight(string(profile[4:8]), "\x00"),
+		MajorVersion:    profile[8],
+		MinorVersion:    profile[9] >> 4,
+		BugfixVersion:   profile[9] & 0x0f,
+		DeviceClass:     string(profile[12:16]),
+		ColorSpace:      string(profile[16:20]),
+		ConnectionSpace: string(profile[20:24]),
+		RenderingIntent: binary.BigEndian.Uint32(profile[64:68]),
+	}
+
+	return iph, nil
+}
+
+// Header parses the header of the embedded profile.
+func (ci *ChunkICCP) Header() (iph *IccProfileHeader, err error) {
+	return ParseIccProfileHeader(ci.Profile)
+}
+
+func (cd *ChunkDecoder) decodeICCP(c *Chunk) (ci *ChunkICCP, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	name, rest, err := splitNull(c.Data)
+	log.PanicIf(err)
+
+	if len(rest) < 1 {
+		log.Panicf("iCCP chunk too short")
+	}
+
+	compressionMethod := rest[0]
+	if compressionMethod != CompressionMethodDeflate {
+		log.Panic(ErrUnsupportedCompressionMethod)
+	}
+
+	profile, err := inflate(rest[1:])
+	log.PanicIf(err)
+
+	ci = &ChunkICCP{
+		ProfileName:       latin1ToUtf8(name),
+		CompressionMethod: compressionMethod,
+		Profile:           profile,
+	}
+
+	return ci, nil
+}
+
+func (ce *ChunkEncoder) encodeICCP(ci *ChunkICCP) (data []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if ci.CompressionMethod != CompressionMethodDeflate {
+		log.Panic(ErrUnsupportedCompressionMethod)
+	}
+
+	// The profile name has the same restrictions as a text keyword.
+	data, err = encodeKeyword(ci.ProfileName)
+	log.PanicIf(err)
+
+	deflated, err := deflate(ci.Profile)
+	log.PanicIf(err)
+
+	data = append(data, ci.CompressionMethod)
+	data = append(data, deflated...)
+
+	return data, nil
+}
+
+// IccProfile returns the embedded ICC profile.
+func (cs *ChunkSlice) IccProfile() (ci *ChunkICCP, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	chunks, found := cs.Index()[ICCPChunkType]
+	if found == false {
+		log.Panic(ErrNoIccProfile)
+	}
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(chunks[0])
+	log.PanicIf(err)
+
+	return decoded.(*ChunkICCP), nil
+}
+
+// SetIccProfile embeds the given ICC profile, replacing any existing one. As
+// iCCP and sRGB must not both be present, any sRGB chunk is removed. The
+// chunk is always placed before PLTE and IDAT, as required.
+func (cs *ChunkSlice) SetIccProfile(name string, profile []byte) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	ci := &ChunkICCP{
+		ProfileName:       name,
+		CompressionMethod: CompressionMethodDeflate,
+		Profile:           profile,
+	}
+
+	ce := NewChunkEncoder()
+
+	iccpChunk, err := ce.Encode(ci)
+	log.PanicIf(err)
+
+	cs.removeChunks(func(c *Chunk) bool {
+		return c.Type == SRGBChunkType
+	})
+
+	cs.replaceChunk(iccpChunk, PLTEChunkType, IDATChunkType)
+
+	return nil
+}
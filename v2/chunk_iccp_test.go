@@ -0,0 +1,224 @@
+package pngstructure
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"encoding/binary"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// getTestIccProfile returns a minimal profile with a valid header.
+func getTestIccProfile() []byte {
+	profile := make([]byte, iccHeaderSize+32)
+
+	binary.BigEndian.PutUint32(profile[0:4], uint32(len(profile)))
+	copy(profile[4:8], "lcms")
+	profile[8] = 4
+	profile[9] = 0x30
+	copy(profile[12:16], "mntr")
+	copy(profile[16:20], "RGB ")
+	copy(profile[20:24], "XYZ ")
+	copy(profile[36:40], "acsp")
+	binary.BigEndian.PutUint32(profile[64:68], 1)
+
+	return profile
+}
+
+func TestParseIccProfileHeader(t *testing.T) {
+	profile := getTestIccProfile()
+
+	iph, err := ParseIccProfileHeader(profile)
+	log.PanicIf(err)
+
+	expected := &IccProfileHeader{
+		Size:            uint32(len(profile)),
+		PreferredCmm:    "lcms",
+		MajorVersion:    4,
+		MinorVersion:    3,
+		BugfixVersion:   0,
+		DeviceClass:     "mntr",
+		ColorSpace:      "RGB ",
+		ConnectionSpace: "XYZ ",
+		RenderingIntent: 1,
+	}
+
+	if reflect.DeepEqual(iph, expected) != true {
+		t.Fatalf("header not correct: %s", iph)
+	} else if iph.Version() != "4.3.0" {
+		t.Fatalf("version not correct: [%s]", iph.Version())
+	}
+}
+
+func TestParseIccProfileHeader_NotValid(t *testing.T) {
+	_, err := ParseIccProfileHeader([]byte{1, 2, 3})
+	if err != ErrIccHeaderNotValid {
+		t.Fatalf("expected error for short profile: %v", err)
+	}
+
+	profile := getTestIccProfile()
+	copy(profile[36:40], "xxxx")
+
+	_, err = ParseIccProfileHeader(profile)
+	if err != ErrIccHeaderNotValid {
+		t.Fatalf("expected error for missing magic: %v", err)
+	}
+}
+
+func TestChunkICCP_Cycle(t *testing.T) {
+	original := &ChunkICCP{
+		ProfileName:       "Display P3",
+		CompressionMethod: CompressionMethodDeflate,
+		Profile:           getTestIccProfile(),
+	}
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(original)
+	log.PanicIf(err)
+
+	if c.Type != ICCPChunkType {
+		t.Fatalf("chunk type not correct: [%s]", c.Type)
+	} else if c.CheckCrc32() != true {
+		t.Fatalf("chunk CRC not correct")
+	}
+
+	cd := NewChunkDecoder()
+
+	recovered, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(recovered, original) != true {
+		t.Fatalf("iCCP not recovered correctly: %v", recovered)
+	}
+}
+
+func TestChunkSlice_IccProfile_Miss(t *testing.T) {
+	cs := NewPngChunkSlice()
+
+	_, err := cs.IccProfile()
+	if err == nil {
+		t.Fatalf("expected error for missing profile")
+	} else if log.Is(err, ErrNoIccProfile) != true {
+		log.Panic(err)
+	}
+}
+
+func TestChunkSlice_SetIccProfile(t *testing.T) {
+	filepath := getTestBasicImageFilepath()
+
+	pmp := NewPngMediaParser()
+
+	intfc, err := pmp.ParseFile(filepath)
+	log.PanicIf(err)
+
+	cs := intfc.(*ChunkSlice)
+
+	if _, found := cs.Index()[SRGBChunkType]; found != true {
+		t.Fatalf("test image expected to have an sRGB chunk")
+	}
+
+	profile := getTestIccProfile()
+
+	err = cs.SetIccProfile("Test profile", profile)
+	log.PanicIf(err)
+
+	b := new(bytes.Buffer)
+
+	err = cs.WriteTo(b)
+	log.PanicIf(err)
+
+	intfc, err = pmp.ParseBytes(b.Bytes())
+	log.PanicIf(err)
+
+	cs = intfc.(*ChunkSlice)
+	index := cs.Index()
+
+	if _, found := index[SRGBChunkType]; found != false {
+		t.Fatalf("sRGB chunk should have been removed")
+	} else if len(index[ICCPChunkType]) != 1 {
+		t.Fatalf("expected exactly one iCCP chunk")
+	}
+
+	for _, c := range cs.Chunks() {
+		if c.Type == ICCPChunkType {
+			break
+		} else if c.Type == PLTEChunkType || c.Type == IDATChunkType {
+			t.Fatalf("iCCP chunk not placed before PLTE/IDAT")
+		}
+	}
+
+	ci, err := cs.IccProfile()
+	log.PanicIf(err)
+
+	if ci.ProfileName != "Test profile" {
+		t.Fatalf("profile name not correct: [%s]", ci.ProfileName)
+	} else if bytes.Compare(ci.Profile, profile) != 0 {
+		t.Fatalf("profile not correct")
+	}
+}
+
+func TestChunkSlice_SetIccProfile_AfterImageData(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	ci := &ChunkICCP{
+		ProfileName: "Old profile",
+		Profile:     getTestIccProfile(),
+	}
+
+	ce := NewChunkEncoder()
+
+	iccpChunk, err := ce.Encode(ci)
+	log.PanicIf(err)
+
+	// Put the existing profile after the image data.
+	cs.insertChunk(iccpChunk)
+
+	err = cs.SetIccProfile("Test profile", getTestIccProfile())
+	log.PanicIf(err)
+
+	iccpChunks := 0
+	for _, c := range cs.Chunks() {
+		if c.Type == ICCPChunkType {
+			iccpChunks++
+		} else if c.Type == IDATChunkType && iccpChunks == 0 {
+			t.Fatalf("iCCP chunk not moved before IDAT")
+		}
+	}
+
+	if iccpChunks != 1 {
+		t.Fatalf("expected exactly one iCCP chunk: (%d)", iccpChunks)
+	}
+}
+
+func TestChunkSlice_SetIccProfile_InvalidName(t *testing.T) {
+	cs := NewPngChunkSlice()
+
+	err := cs.SetIccProfile(" leading space", getTestIccProfile())
+	if err == nil {
+		t.Fatalf("expected error for invalid profile name")
+	} else if log.Is(err, ErrInvalidKeyword) != true {
+		log.Panic(err)
+	}
+}
+
+func ExampleChunkSlice_IccProfile() {
+	cs := NewPngChunkSlice()
+
+	err := cs.SetIccProfile("Test profile", getTestIccProfile())
+	log.PanicIf(err)
+
+	ci, err := cs.IccProfile()
+	log.PanicIf(err)
+
+	iph, err := ci.Header()
+	log.PanicIf(err)
+
+	fmt.Printf("%s %s [%s] [%s]\n", ci.ProfileName, iph.Version(), iph.DeviceClass, iph.ColorSpace)
+
+	// Output:
+	// Test profile 4.3.0 [mntr] [RGB ]
+}
@@ -0,0 +1,482 @@
+package pngstructure
+
+import (
+	"bytes"
+	"fmt"
+
+	"encoding/binary"
+	"image/color"
+
+	"github.com/dsoprea/go-logging"
+)
+
+const (
+	// maxPaletteEntries is the most entries that a PLTE can have.
+	maxPaletteEntries = 256
+)
+
+// scaleSample scales a sample of the given bit-depth to sixteen bits.
+func scaleSample(value uint16, bitDepth uint8) uint16 {
+	if bitDepth == 16 {
+		return value
+	}
+
+	max := uint32(1)<<bitDepth - 1
+	return uint16(uint32(value) * 0xffff / max)
+}
+
+// ChunkPLTE describes a PLTE chunk. Every entry is a `color.RGBA` and is
+// fully opaque (transparency comes from tRNS).
+type ChunkPLTE struct {
+	Palette color.Palette
+}
+
+func (cp *ChunkPLTE) String() string {
+	return fmt.Sprintf("PLTE<ENTRIES=(%d)>", len(cp.Palette))
+}
+
+// ChunkTRNS describes a tRNS chunk. Which fields apply depends on the color-
+// type of the image.
+type ChunkTRNS struct {
+	ColorType uint8
+
+	// Alphas has the alpha for each palette entry (for indexed images). It may
+	// be shorter than the palette, in which case the remaining entries are
+	// opaque.
+	Alphas []uint8
+
+	// Gray is the transparent sample (for grayscale images).
+	Gray uint16
+
+	// Red, Green, and Blue are the transparent color (for truecolor images).
+	Red   uint16
+	Green uint16
+	Blue  uint16
+}
+
+func (ct *ChunkTRNS) String() string {
+	switch ct.ColorType {
+	case ColorTypeIndexed:
+		return fmt.Sprintf("tRNS<ALPHAS=(%d)>", len(ct.Alphas))
+	case ColorTypeGrayscale:
+		return fmt.Sprintf("tRNS<GRAY=(%d)>", ct.Gray)
+	default:
+		return fmt.Sprintf("tRNS<RED=(%d) GREEN=(%d) BLUE=(%d)>", ct.Red, ct.Green, ct.Blue)
+	}
+}
+
+// ApplyToPalette returns a copy of the palette with the alphas applied. Every
+// entry is a `color.NRGBA`.
+func (ct *ChunkTRNS) ApplyToPalette(palette color.Palette) color.Palette {
+	applied := make(color.Palette, len(palette))
+	for i, c := range palette {
+		nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+		if i < len(ct.Alphas) {
+			nrgba.A = ct.Alphas[i]
+		}
+
+		applied[i] = nrgba
+	}
+
+	return applied
+}
+
+// ChunkBKGD describes a bKGD chunk. Which of the raw fields apply depends on
+// the color-type of the image.
+type ChunkBKGD struct {
+	ColorType uint8
+
+	PaletteIndex uint8
+	Gray         uint16
+	Red          uint16
+	Green        uint16
+	Blue         uint16
+
+	// Color is the resolved background color: the palette entry for indexed
+	// images and the sample(s) scaled to sixteen bits otherwise. This is not
+	// used for encoding.
+	Color color.Color
+}
+
+func (cb *ChunkBKGD) String() string {
+	return fmt.Sprintf("bKGD<COLOR-TYPE=(%d) COLOR=%v>", cb.ColorType, cb.Color)
+}
+
+// ChunkHIST describes a hIST chunk: the approximate usage frequency of each
+// palette entry.
+type ChunkHIST struct {
+	Frequencies []uint16
+}
+
+func (ch *ChunkHIST) String() string {
+	return fmt.Sprintf("hIST<ENTRIES=(%d)>", len(ch.Frequencies))
+}
+
+// SuggestedPaletteEntry is a single entry in a sPLT chunk.
+type SuggestedPaletteEntry struct {
+	Red       uint16
+	Green     uint16
+	Blue      uint16
+	Alpha     uint16
+	Frequency uint16
+}
+
+// ChunkSPLT describes a sPLT (suggested palette) chunk.
+type ChunkSPLT struct {
+	Name string
+
+	// SampleDepth is the depth of the color and alpha samples: 8 or 16.
+	SampleDepth uint8
+
+	Entries []SuggestedPaletteEntry
+}
+
+func (cs *ChunkSPLT) String() string {
+	return fmt.Sprintf("sPLT<NAME=[%s] DEPTH=(%d) ENTRIES=(%d)>", cs.Name, cs.SampleDepth, len(cs.Entries))
+}
+
+func (cd *ChunkDecoder) decodePLTE(c *Chunk) (cp *ChunkPLTE, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if len(c.Data) == 0 || len(c.Data)%3 != 0 || len(c.Data)/3 > maxPaletteEntries {
+		log.Panicf("PLTE chunk length not valid: (%d)", len(c.Data))
+	}
+
+	palette := make(color.Palette, len(c.Data)/3)
+	for i := range palette {
+		palette[i] = color.RGBA{
+			R: c.Data[i*3],
+			G: c.Data[i*3+1],
+			B: c.Data[i*3+2],
+			A: 0xff,
+		}
+	}
+
+	cp = &ChunkPLTE{
+		Palette: palette,
+	}
+
+	return cp, nil
+}
+
+func (cd *ChunkDecoder) decodeTRNS(c *Chunk) (ct *ChunkTRNS, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if cd.ihdr == nil {
+		log.Panic(ErrNoIhdr)
+	}
+
+	ct = &ChunkTRNS{
+		ColorType: cd.ihdr.ColorType,
+	}
+
+	switch cd.ihdr.ColorType {
+	case ColorTypeIndexed:
+		if cd.palette != nil && len(c.Data) > len(cd.palette) {
+			log.Panicf("tRNS has more entries than the palette: (%d) > (%d)", len(c.Data), len(cd.palette))
+		}
+
+		ct.Alphas = make([]uint8, len(c.Data))
+		copy(ct.Alphas, c.Data)
+
+	case ColorTypeGrayscale:
+		if len(c.Data) != 2 {
+			log.Panicf("tRNS chunk length not correct for grayscale: (%d)", len(c.Data))
+		}
+
+		ct.Gray = binary.BigEndian.Uint16(c.Data)
+
+	case ColorTypeRgb:
+		if len(c.Data) != 6 {
+			log.Panicf("tRNS chunk length not correct for truecolor: (%d)", len(c.Data))
+		}
+
+		ct.Red = binary.BigEndian.Uint16(c.Data[0:2])
+		ct.Green = binary.BigEndian.Uint16(c.Data[2:4])
+		ct.Blue = binary.BigEndian.Uint16(c.Data[4:6])
+
+	default:
+		log.Panicf("tRNS not allowed for color-type (%d)", cd.ihdr.ColorType)
+	}
+
+	return ct, nil
+}
+
+func (cd *ChunkDecoder) decodeBKGD(c *Chunk) (cb *ChunkBKGD, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if cd.ihdr == nil {
+		log.Panic(ErrNoIhdr)
+	}
+
+	cb = &ChunkBKGD{
+		ColorType: cd.ihdr.ColorType,
+	}
+
+	switch cd.ihdr.ColorType {
+	case ColorTypeIndexed:
+		if len(c.Data) != 1 {
+			log.Panicf("bKGD chunk length not correct for indexed: (%d)", len(c.Data))
+		}
+
+		cb.PaletteIndex = c.Data[0]
+
+		if cd.palette == nil {
+			log.Panicf("bKGD for indexed image requires the palette")
+		} else if int(cb.PaletteIndex) >= len(cd.palette) {
+			log.Panicf("bKGD palette index out of range: (%d) >= (%d)", cb.PaletteIndex, len(cd.palette))
+		}
+
+		cb.Color = cd.palette[cb.PaletteIndex]
+
+	case ColorTypeGrayscale, ColorTypeGrayscaleAlpha:
+		if len(c.Data) != 2 {
+			log.Panicf("bKGD chunk length not correct for grayscale: (%d)", len(c.Data))
+		}
+
+		cb.Gray = binary.BigEndian.Uint16(c.Data)
+		cb.Color = color.Gray16{Y: scaleSample(cb.Gray, cd.ihdr.BitDepth)}
+
+	case ColorTypeRgb, ColorTypeRgba:
+		if len(c.Data) != 6 {
+			log.Panicf("bKGD chunk length not correct for truecolor: (%d)", len(c.Data))
+		}
+
+		cb.Red = binary.BigEndian.Uint16(c.Data[0:2])
+		cb.Green = binary.BigEndian.Uint16(c.Data[2:4])
+		cb.Blue = binary.BigEndian.Uint16(c.Data[4:6])
+
+		cb.Color = color.RGBA64{
+			R: scaleSample(cb.Red, cd.ihdr.BitDepth),
+			G: scaleSample(cb.Green, cd.ihdr.BitDepth),
+			B: scaleSample(cb.Blue, cd.ihdr.BitDepth),
+			A: 0xffff,
+		}
+
+	default:
+		log.Panicf("color-type not valid: (%d)", cd.ihdr.ColorType)
+	}
+
+	return cb, nil
+}
+
+func (cd *ChunkDecoder) decodeHIST(c *Chunk) (ch *ChunkHIST, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if len(c.Data)%2 != 0 {
+		log.Panicf("hIST chunk length not valid: (%d)", len(c.Data))
+	}
+
+	ch = &ChunkHIST{
+		Frequencies: make([]uint16, len(c.Data)/2),
+	}
+
+	if cd.palette != nil && len(ch.Frequencies) != len(cd.palette) {
+		log.Panicf("hIST must have one entry per palette entry: (%d) != (%d)", len(ch.Frequencies), len(cd.palette))
+	}
+
+	err = binary.Read(bytes.NewBuffer(c.Data), binary.BigEndian, ch.Frequencies)
+	log.PanicIf(err)
+
+	return ch, nil
+}
+
+func (cd *ChunkDecoder) decodeSPLT(c *Chunk) (cs *ChunkSPLT, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	name, rest, err := splitNull(c.Data)
+	log.PanicIf(err)
+
+	if len(rest) < 1 {
+		log.Panicf("sPLT chunk too short")
+	}
+
+	cs = &ChunkSPLT{
+		Name:        latin1ToUtf8(name),
+		SampleDepth: rest[0],
+	}
+
+	rest = rest[1:]
+
+	var entrySize int
+	switch cs.SampleDepth {
+	case 8:
+		entrySize = 6
+	case 16:
+		entrySize = 10
+	default:
+		log.Panicf("sPLT sample-depth not valid: (%d)", cs.SampleDepth)
+	}
+
+	if len(rest)%entrySize != 0 {
+		log.Panicf("sPLT entries not valid: (%d) bytes", len(rest))
+	}
+
+	cs.Entries = make([]SuggestedPaletteEntry, len(rest)/entrySize)
+	for i := range cs.Entries {
+		raw := rest[i*entrySize : (i+1)*entrySize]
+		spe := &cs.Entries[i]
+
+		if cs.SampleDepth == 8 {
+			spe.Red = uint16(raw[0])
+			spe.Green = uint16(raw[1])
+			spe.Blue = uint16(raw[2])
+			spe.Alpha = uint16(raw[3])
+			spe.Frequency = binary.BigEndian.Uint16(raw[4:6])
+		} else {
+			spe.Red = binary.BigEndian.Uint16(raw[0:2])
+			spe.Green = binary.BigEndian.Uint16(raw[2:4])
+			spe.Blue = binary.BigEndian.Uint16(raw[4:6])
+			spe.Alpha = binary.BigEndian.Uint16(raw[6:8])
+			spe.Frequency = binary.BigEndian.Uint16(raw[8:10])
+		}
+	}
+
+	return cs, nil
+}
+
+func (ce *ChunkEncoder) encodePLTE(cp *ChunkPLTE) (data []byte, err error) {
+	if len(cp.Palette) == 0 || len(cp.Palette) > maxPaletteEntries {
+		return nil, log.Errorf("palette must have between 1 and %d entries: (%d)", maxPaletteEntries, len(cp.Palette))
+	}
+
+	data = make([]byte, 0, len(cp.Palette)*3)
+	for _, c := range cp.Palette {
+		nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+		data = append(data, nrgba.R, nrgba.G, nrgba.B)
+	}
+
+	return data, nil
+}
+
+func (ce *ChunkEncoder) encodeTRNS(ct *ChunkTRNS) (data []byte, err error) {
+	switch ct.ColorType {
+	case ColorTypeIndexed:
+		if len(ct.Alphas) == 0 || len(ct.Alphas) > maxPaletteEntries {
+			return nil, log.Errorf("tRNS must have between 1 and %d alphas: (%d)", maxPaletteEntries, len(ct.Alphas))
+		}
+
+		data = make([]byte, len(ct.Alphas))
+		copy(data, ct.Alphas)
+
+	case ColorTypeGrayscale:
+		data = make([]byte, 2)
+		binary.BigEndian.PutUint16(data, ct.Gray)
+
+	case ColorTypeRgb:
+		data = make([]byte, 6)
+		binary.BigEndian.PutUint16(data[0:2], ct.Red)
+		binary.BigEndian.PutUint16(data[2:4], ct.Green)
+		binary.BigEndian.PutUint16(data[4:6], ct.Blue)
+
+	default:
+		return nil, log.Errorf("tRNS not allowed for color-type (%d)", ct.ColorType)
+	}
+
+	return data, nil
+}
+
+func (ce *ChunkEncoder) encodeBKGD(cb *ChunkBKGD) (data []byte, err error) {
+	switch cb.ColorType {
+	case ColorTypeIndexed:
+		data = []byte{cb.PaletteIndex}
+
+	case ColorTypeGrayscale, ColorTypeGrayscaleAlpha:
+		data = make([]byte, 2)
+		binary.BigEndian.PutUint16(data, cb.Gray)
+
+	case ColorTypeRgb, ColorTypeRgba:
+		data = make([]byte, 6)
+		binary.BigEndian.PutUint16(data[0:2], cb.Red)
+		binary.BigEndian.PutUint16(data[2:4], cb.Green)
+		binary.BigEndian.PutUint16(data[4:6], cb.Blue)
+
+	default:
+		return nil, log.Errorf("color-type not valid: (%d)", cb.ColorType)
+	}
+
+	return data, nil
+}
+
+func (ce *ChunkEncoder) encodeHIST(ch *ChunkHIST) (data []byte, err error) {
+	if len(ch.Frequencies) == 0 || len(ch.Frequencies) > maxPaletteEntries {
+		return nil, log.Errorf("hIST must have between 1 and %d entries: (%d)", maxPaletteEntries, len(ch.Frequencies))
+	}
+
+	data = make([]byte, len(ch.Frequencies)*2)
+	for i, frequency := range ch.Frequencies {
+		binary.BigEndian.PutUint16(data[i*2:], frequency)
+	}
+
+	return data, nil
+}
+
+func (ce *ChunkEncoder) encodeSPLT(cs *ChunkSPLT) (data []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	// The palette name has the same restrictions as a text keyword.
+	data, err = encodeKeyword(cs.Name)
+	log.PanicIf(err)
+
+	if cs.SampleDepth != 8 && cs.SampleDepth != 16 {
+		log.Panicf("sPLT sample-depth not valid: (%d)", cs.SampleDepth)
+	}
+
+	data = append(data, cs.SampleDepth)
+
+	for _, spe := range cs.Entries {
+		switch cs.SampleDepth {
+		case 8:
+			if spe.Red > 0xff || spe.Green > 0xff || spe.Blue > 0xff || spe.Alpha > 0xff {
+				log.Panicf("sPLT entry does not fit in eight bits: %v", spe)
+			}
+
+			data = append(data, uint8(spe.Red), uint8(spe.Green), uint8(spe.Blue), uint8(spe.Alpha))
+
+		case 16:
+			raw := make([]byte, 8)
+			binary.BigEndian.PutUint16(raw[0:2], spe.Red)
+			binary.BigEndian.PutUint16(raw[2:4], spe.Green)
+			binary.BigEndian.PutUint16(raw[4:6], spe.Blue)
+			binary.BigEndian.PutUint16(raw[6:8], spe.Alpha)
+
+			data = append(data, raw...)
+		}
+
+		frequency := make([]byte, 2)
+		binary.BigEndian.PutUint16(frequency, spe.Frequency)
+
+		data = append(data, frequency...)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,336 @@
+package pngstructure
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"image/color"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func getTestIndexedDecoder(bitDepth uint8) *ChunkDecoder {
+	cd := NewChunkDecoder()
+
+	ihdr := &ChunkIHDR{
+		Width:     16,
+		Height:    16,
+		BitDepth:  bitDepth,
+		ColorType: ColorTypeIndexed,
+	}
+
+	cd.SetIhdr(ihdr)
+
+	return cd
+}
+
+func TestScaleSample(t *testing.T) {
+	if scaleSample(1, 1) != 0xffff {
+		t.Fatalf("1-bit sample not scaled correctly")
+	} else if scaleSample(0x80, 8) != 0x8080 {
+		t.Fatalf("8-bit sample not scaled correctly")
+	} else if scaleSample(0x1234, 16) != 0x1234 {
+		t.Fatalf("16-bit sample not scaled correctly")
+	}
+}
+
+func TestChunkPLTE_Cycle(t *testing.T) {
+	c := NewChunk(PLTEChunkType, []byte{0xff, 0x00, 0x00, 0x00, 0xff, 0x00, 0x00, 0x00, 0xff})
+
+	cd := getTestIndexedDecoder(8)
+
+	decoded, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	expected := color.Palette{
+		color.RGBA{R: 0xff, A: 0xff},
+		color.RGBA{G: 0xff, A: 0xff},
+		color.RGBA{B: 0xff, A: 0xff},
+	}
+
+	if reflect.DeepEqual(decoded.(*ChunkPLTE).Palette, expected) != true {
+		t.Fatalf("palette not correct")
+	}
+
+	ce := NewChunkEncoder()
+
+	recovered, err := ce.Encode(decoded)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(recovered, c) != true {
+		t.Fatalf("PLTE not re-encoded correctly")
+	}
+}
+
+func TestChunkDecoder_decodePLTE_BadLength(t *testing.T) {
+	cd := NewChunkDecoder()
+
+	_, err := cd.Decode(NewChunk(PLTEChunkType, []byte{0x01, 0x02}))
+	if err == nil {
+		t.Fatalf("expected error for bad PLTE length")
+	}
+}
+
+func TestChunkTRNS_Indexed(t *testing.T) {
+	cd := getTestIndexedDecoder(8)
+
+	_, err := cd.Decode(NewChunk(PLTEChunkType, []byte{0xff, 0x00, 0x00, 0x00, 0xff, 0x00, 0x00, 0x00, 0xff}))
+	log.PanicIf(err)
+
+	c := NewChunk(TRNSChunkType, []byte{0x00, 0x80})
+
+	decoded, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	ct := decoded.(*ChunkTRNS)
+
+	if ct.ColorType != ColorTypeIndexed || reflect.DeepEqual(ct.Alphas, []uint8{0x00, 0x80}) != true {
+		t.Fatalf("tRNS not decoded correctly: %s", ct)
+	}
+
+	applied := ct.ApplyToPalette(cd.palette)
+
+	expected := color.Palette{
+		color.NRGBA{R: 0xff, A: 0x00},
+		color.NRGBA{G: 0xff, A: 0x80},
+		color.NRGBA{B: 0xff, A: 0xff},
+	}
+
+	if reflect.DeepEqual(applied, expected) != true {
+		t.Fatalf("alphas not applied correctly: %v", applied)
+	}
+
+	ce := NewChunkEncoder()
+
+	recovered, err := ce.Encode(ct)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(recovered, c) != true {
+		t.Fatalf("tRNS not re-encoded correctly")
+	}
+
+	// More alphas than palette entries.
+
+	_, err = cd.Decode(NewChunk(TRNSChunkType, []byte{0x00, 0x00, 0x00, 0x00}))
+	if err == nil {
+		t.Fatalf("expected error for too many alphas")
+	}
+}
+
+func TestChunkTRNS_Truecolor(t *testing.T) {
+	cd := NewChunkDecoder()
+
+	cd.SetIhdr(&ChunkIHDR{BitDepth: 16, ColorType: ColorTypeRgb})
+
+	c := NewChunk(TRNSChunkType, []byte{0x00, 0x01, 0x00, 0x02, 0x00, 0x03})
+
+	decoded, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	ct := decoded.(*ChunkTRNS)
+	if ct.Red != 1 || ct.Green != 2 || ct.Blue != 3 {
+		t.Fatalf("tRNS not decoded correctly: %s", ct)
+	}
+
+	ce := NewChunkEncoder()
+
+	recovered, err := ce.Encode(ct)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(recovered, c) != true {
+		t.Fatalf("tRNS not re-encoded correctly")
+	}
+}
+
+func TestChunkTRNS_Grayscale(t *testing.T) {
+	cd := NewChunkDecoder()
+
+	cd.SetIhdr(&ChunkIHDR{BitDepth: 4, ColorType: ColorTypeGrayscale})
+
+	decoded, err := cd.Decode(NewChunk(TRNSChunkType, []byte{0x00, 0x0a}))
+	log.PanicIf(err)
+
+	if decoded.(*ChunkTRNS).Gray != 10 {
+		t.Fatalf("tRNS not decoded correctly: %s", decoded)
+	}
+}
+
+func TestChunkTRNS_NotAllowed(t *testing.T) {
+	cd := NewChunkDecoder()
+
+	_, err := cd.Decode(NewChunk(TRNSChunkType, []byte{0x00, 0x0a}))
+	if err == nil {
+		t.Fatalf("expected error without IHDR")
+	} else if log.Is(err, ErrNoIhdr) != true {
+		log.Panic(err)
+	}
+
+	cd.SetIhdr(&ChunkIHDR{BitDepth: 8, ColorType: ColorTypeRgba})
+
+	_, err = cd.Decode(NewChunk(TRNSChunkType, []byte{0x00, 0x0a}))
+	if err == nil {
+		t.Fatalf("expected error for tRNS with alpha channel")
+	}
+
+	ce := NewChunkEncoder()
+
+	_, err = ce.Encode(&ChunkTRNS{ColorType: ColorTypeGrayscaleAlpha})
+	if err == nil {
+		t.Fatalf("expected error encoding tRNS with alpha channel")
+	}
+}
+
+func TestChunkBKGD_Truecolor(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	cd := NewChunkDecoder()
+
+	// Will implicitly record the IHDR.
+	for _, c := range cs.Chunks() {
+		if c.Type == BKGDChunkType {
+			decoded, err := cd.Decode(c)
+			log.PanicIf(err)
+
+			cb := decoded.(*ChunkBKGD)
+
+			if cb.ColorType != ColorTypeRgba {
+				t.Fatalf("color-type not correct: (%d)", cb.ColorType)
+			}
+
+			expected := color.RGBA64{
+				R: scaleSample(cb.Red, 8),
+				G: scaleSample(cb.Green, 8),
+				B: scaleSample(cb.Blue, 8),
+				A: 0xffff,
+			}
+
+			if cb.Color != expected {
+				t.Fatalf("color not resolved correctly: %v", cb.Color)
+			}
+
+			ce := NewChunkEncoder()
+
+			recovered, err := ce.Encode(cb)
+			log.PanicIf(err)
+
+			if reflect.DeepEqual(recovered.Bytes(), c.Bytes()) != true {
+				t.Fatalf("bKGD not re-encoded correctly")
+			}
+
+			return
+		}
+
+		_, err := cd.Decode(c)
+		log.PanicIf(err)
+	}
+
+	t.Fatalf("bKGD not found")
+}
+
+func TestChunkBKGD_Indexed(t *testing.T) {
+	cd := getTestIndexedDecoder(8)
+
+	_, err := cd.Decode(NewChunk(PLTEChunkType, []byte{0xff, 0x00, 0x00, 0x00, 0xff, 0x00}))
+	log.PanicIf(err)
+
+	decoded, err := cd.Decode(NewChunk(BKGDChunkType, []byte{0x01}))
+	log.PanicIf(err)
+
+	if decoded.(*ChunkBKGD).Color != (color.RGBA{G: 0xff, A: 0xff}) {
+		t.Fatalf("background not resolved against the palette")
+	}
+
+	_, err = cd.Decode(NewChunk(BKGDChunkType, []byte{0x02}))
+	if err == nil {
+		t.Fatalf("expected error for out-of-range index")
+	}
+}
+
+func TestChunkHIST_Cycle(t *testing.T) {
+	cd := getTestIndexedDecoder(8)
+
+	_, err := cd.Decode(NewChunk(PLTEChunkType, []byte{0xff, 0x00, 0x00, 0x00, 0xff, 0x00}))
+	log.PanicIf(err)
+
+	c := NewChunk(HISTChunkType, []byte{0x00, 0x10, 0x01, 0x00})
+
+	decoded, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(decoded.(*ChunkHIST).Frequencies, []uint16{0x10, 0x100}) != true {
+		t.Fatalf("hIST not decoded correctly")
+	}
+
+	ce := NewChunkEncoder()
+
+	recovered, err := ce.Encode(decoded)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(recovered, c) != true {
+		t.Fatalf("hIST not re-encoded correctly")
+	}
+
+	_, err = cd.Decode(NewChunk(HISTChunkType, []byte{0x00, 0x10}))
+	if err == nil {
+		t.Fatalf("expected error for hIST not matching the palette")
+	}
+}
+
+func TestChunkSPLT_Cycle(t *testing.T) {
+	for _, sampleDepth := range []uint8{8, 16} {
+		original := &ChunkSPLT{
+			Name:        "Web safe",
+			SampleDepth: sampleDepth,
+			Entries: []SuggestedPaletteEntry{
+				{Red: 0xff, Green: 0x33, Blue: 0x00, Alpha: 0xff, Frequency: 100},
+				{Red: 0x00, Green: 0x00, Blue: 0x00, Alpha: 0x00, Frequency: 5},
+			},
+		}
+
+		ce := NewChunkEncoder()
+
+		c, err := ce.Encode(original)
+		log.PanicIf(err)
+
+		cd := NewChunkDecoder()
+
+		recovered, err := cd.Decode(c)
+		log.PanicIf(err)
+
+		if reflect.DeepEqual(recovered, original) != true {
+			t.Fatalf("sPLT (%d) not recovered correctly: %s", sampleDepth, recovered)
+		}
+	}
+}
+
+func TestChunkSPLT_Encode_BadDepth(t *testing.T) {
+	ce := NewChunkEncoder()
+
+	_, err := ce.Encode(&ChunkSPLT{Name: "Palette", SampleDepth: 4})
+	if err == nil {
+		t.Fatalf("expected error for bad sample-depth")
+	}
+}
+
+func ExampleChunkTRNS_ApplyToPalette() {
+	cd := NewChunkDecoder()
+
+	cd.SetIhdr(&ChunkIHDR{Width: 1, Height: 1, BitDepth: 8, ColorType: ColorTypeIndexed})
+
+	decoded, err := cd.Decode(NewChunk(PLTEChunkType, []byte{0xff, 0x00, 0x00, 0x00, 0x00, 0xff}))
+	log.PanicIf(err)
+
+	palette := decoded.(*ChunkPLTE).Palette
+
+	decoded, err = cd.Decode(NewChunk(TRNSChunkType, []byte{0x40}))
+	log.PanicIf(err)
+
+	for _, c := range decoded.(*ChunkTRNS).ApplyToPalette(palette) {
+		fmt.Printf("%v\n", c)
+	}
+
+	// Output:
+	// {255 0 0 64}
+	// {0 0 255 255}
+}
@@ -0,0 +1,450 @@
+package pngstructure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"encoding/binary"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// Units, as stored in pHYs.
+const (
+	PhysicalUnitUnknown = uint8(0)
+	PhysicalUnitMeter   = uint8(1)
+)
+
+// Units, as stored in oFFs.
+const (
+	OffsetUnitPixel      = uint8(0)
+	OffsetUnitMicrometer = uint8(1)
+)
+
+// Units, as stored in sCAL.
+const (
+	ScaleUnitMeter  = uint8(1)
+	ScaleUnitRadian = uint8(2)
+)
+
+// Equation types, as stored in pCAL.
+const (
+	CalibrationEquationLinear              = uint8(0)
+	CalibrationEquationBaseE               = uint8(1)
+	CalibrationEquationArbitraryBase       = uint8(2)
+	CalibrationEquationHyperbolicFunctions = uint8(3)
+)
+
+const (
+	metersPerInch = 0.0254
+)
+
+var (
+	// calibrationParameterCounts is the number of parameters required by each
+	// pCAL equation type.
+	calibrationParameterCounts = map[uint8]int{
+		CalibrationEquationLinear:              2,
+		CalibrationEquationBaseE:               3,
+		CalibrationEquationArbitraryBase:       4,
+		CalibrationEquationHyperbolicFunctions: 4,
+	}
+)
+
+var (
+	// ErrUnitUnknown indicates that the pHYs only describes the aspect ratio.
+	ErrUnitUnknown = errors.New("physical unit not known")
+)
+
+// ChunkPHYS describes a pHYs chunk.
+type ChunkPHYS struct {
+	PixelsPerUnitX uint32
+	PixelsPerUnitY uint32
+	Unit           uint8
+}
+
+func (cp *ChunkPHYS) String() string {
+	return fmt.Sprintf("pHYs<X=(%d) Y=(%d) UNIT=(%d)>", cp.PixelsPerUnitX, cp.PixelsPerUnitY, cp.Unit)
+}
+
+// DPI returns the resolution in dots-per-inch. Returns `ErrUnitUnknown` if the
+// unit is not meters.
+func (cp *ChunkPHYS) DPI() (x, y float64, err error) {
+	if cp.Unit != PhysicalUnitMeter {
+		return 0, 0, ErrUnitUnknown
+	}
+
+	x = float64(cp.PixelsPerUnitX) * metersPerInch
+	y = float64(cp.PixelsPerUnitY) * metersPerInch
+
+	return x, y, nil
+}
+
+// ChunkOFFS describes an oFFs chunk: the position of the image on the page.
+type ChunkOFFS struct {
+	X    int32
+	Y    int32
+	Unit uint8
+}
+
+func (co *ChunkOFFS) String() string {
+	return fmt.Sprintf("oFFs<X=(%d) Y=(%d) UNIT=(%d)>", co.X, co.Y, co.Unit)
+}
+
+// ChunkSCAL describes a sCAL chunk: the physical size of a pixel. The width
+// and height are kept as the original ASCII floating-point strings.
+type ChunkSCAL struct {
+	Unit   uint8
+	Width  string
+	Height string
+}
+
+func (cs *ChunkSCAL) String() string {
+	return fmt.Sprintf("sCAL<UNIT=(%d) WIDTH=[%s] HEIGHT=[%s]>", cs.Unit, cs.Width, cs.Height)
+}
+
+// Dimensions returns the parsed pixel width and height.
+func (cs *ChunkSCAL) Dimensions() (width, height float64, err error) {
+	width, err = parseScaleValue(cs.Width)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	height, err = parseScaleValue(cs.Height)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return width, height, nil
+}
+
+// isFloatString returns true if the string is a floating-point number as the
+// specification writes them for sCAL and pCAL: an optional sign, digits with
+// an optional decimal point, and an optional exponent. Unlike
+// `strconv.ParseFloat`, this excludes "NaN", "Inf", hexadecimal, and
+// underscores.
+func isFloatString(raw string) bool {
+	i := 0
+
+	skipDigits := func() (count int) {
+		for i < len(raw) && raw[i] >= '0' && raw[i] <= '9' {
+			i++
+			count++
+		}
+
+		return count
+	}
+
+	if i < len(raw) && (raw[i] == '+' || raw[i] == '-') {
+		i++
+	}
+
+	digits := skipDigits()
+
+	if i < len(raw) && raw[i] == '.' {
+		i++
+		digits += skipDigits()
+	}
+
+	if digits == 0 {
+		return false
+	}
+
+	if i < len(raw) && (raw[i] == 'e' || raw[i] == 'E') {
+		i++
+
+		if i < len(raw) && (raw[i] == '+' || raw[i] == '-') {
+			i++
+		}
+
+		if skipDigits() == 0 {
+			return false
+		}
+	}
+
+	return i == len(raw)
+}
+
+// parseFloatString parses a floating-point number after checking it against
+// the grammar of the specification.
+func parseFloatString(raw string) (value float64, err error) {
+	if isFloatString(raw) == false {
+		return 0, log.Errorf("floating-point value not valid: [%s]", raw)
+	}
+
+	return strconv.ParseFloat(raw, 64)
+}
+
+// parseScaleValue parses a sCAL value, which must be positive.
+func parseScaleValue(raw string) (value float64, err error) {
+	value, err = parseFloatString(raw)
+	if err != nil {
+		return 0, err
+	} else if value <= 0 || math.IsInf(value, 0) == true {
+		return 0, log.Errorf("sCAL value must be positive: [%s]", raw)
+	}
+
+	return value, nil
+}
+
+// ChunkPCAL describes a pCAL chunk: the mapping of the sample values to
+// physical values. The parameters are kept as the original ASCII floating-
+// point strings.
+type ChunkPCAL struct {
+	Name         string
+	X0           int32
+	X1           int32
+	EquationType uint8
+	Unit         string
+	Parameters   []string
+}
+
+func (cp *ChunkPCAL) String() string {
+	return fmt.Sprintf("pCAL<NAME=[%s] X0=(%d) X1=(%d) EQUATION=(%d) UNIT=[%s] PARAMETERS=%v>", cp.Name, cp.X0, cp.X1, cp.EquationType, cp.Unit, cp.Parameters)
+}
+
+func (cd *ChunkDecoder) decodePHYS(c *Chunk) (cp *ChunkPHYS, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if len(c.Data) != 9 {
+		log.Panicf("pHYs chunk length not correct: (%d)", len(c.Data))
+	}
+
+	cp = new(ChunkPHYS)
+
+	err = binary.Read(bytes.NewBuffer(c.Data), binary.BigEndian, cp)
+	log.PanicIf(err)
+
+	return cp, nil
+}
+
+func (cd *ChunkDecoder) decodeOFFS(c *Chunk) (co *ChunkOFFS, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if len(c.Data) != 9 {
+		log.Panicf("oFFs chunk length not correct: (%d)", len(c.Data))
+	}
+
+	co = new(ChunkOFFS)
+
+	err = binary.Read(bytes.NewBuffer(c.Data), binary.BigEndian, co)
+	log.PanicIf(err)
+
+	return co, nil
+}
+
+func (cd *ChunkDecoder) decodeSCAL(c *Chunk) (cs *ChunkSCAL, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if len(c.Data) < 1 {
+		log.Panicf("sCAL chunk too short")
+	}
+
+	width, height, err := splitNull(c.Data[1:])
+	log.PanicIf(err)
+
+	cs = &ChunkSCAL{
+		Unit:   c.Data[0],
+		Width:  string(width),
+		Height: string(height),
+	}
+
+	_, _, err = cs.Dimensions()
+	log.PanicIf(err)
+
+	return cs, nil
+}
+
+func (cd *ChunkDecoder) decodePCAL(c *Chunk) (cp *ChunkPCAL, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	name, rest, err := splitNull(c.Data)
+	log.PanicIf(err)
+
+	if len(rest) < 10 {
+		log.Panicf("pCAL chunk too short")
+	}
+
+	cp = &ChunkPCAL{
+		Name:         latin1ToUtf8(name),
+		X0:           int32(binary.BigEndian.Uint32(rest[0:4])),
+		X1:           int32(binary.BigEndian.Uint32(rest[4:8])),
+		EquationType: rest[8],
+	}
+
+	parameterCount := int(rest[9])
+
+	if expected, found := calibrationParameterCounts[cp.EquationType]; found == false {
+		log.Panicf("pCAL equation-type not valid: (%d)", cp.EquationType)
+	} else if parameterCount != expected {
+		log.Panicf("pCAL parameter count not correct for equation-type (%d): (%d) != (%d)", cp.EquationType, parameterCount, expected)
+	}
+
+	unit, rest, err := splitNull(rest[10:])
+	log.PanicIf(err)
+
+	cp.Unit = latin1ToUtf8(unit)
+
+	// The parameters are separated (not terminated) by NULs.
+	cp.Parameters = make([]string, parameterCount)
+	for i := range cp.Parameters {
+		var parameter []byte
+
+		if i < parameterCount-1 {
+			parameter, rest, err = splitNull(rest)
+			log.PanicIf(err)
+		} else {
+			parameter = rest
+		}
+
+		_, err := parseFloatString(string(parameter))
+		log.PanicIf(err)
+
+		cp.Parameters[i] = string(parameter)
+	}
+
+	return cp, nil
+}
+
+func (ce *ChunkEncoder) encodePHYS(cp *ChunkPHYS) (data []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	b := new(bytes.Buffer)
+
+	err = binary.Write(b, binary.BigEndian, cp)
+	log.PanicIf(err)
+
+	return b.Bytes(), nil
+}
+
+func (ce *ChunkEncoder) encodeOFFS(co *ChunkOFFS) (data []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	b := new(bytes.Buffer)
+
+	err = binary.Write(b, binary.BigEndian, co)
+	log.PanicIf(err)
+
+	return b.Bytes(), nil
+}
+
+func (ce *ChunkEncoder) encodeSCAL(cs *ChunkSCAL) (data []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if cs.Unit != ScaleUnitMeter && cs.Unit != ScaleUnitRadian {
+		log.Panicf("sCAL unit not valid: (%d)", cs.Unit)
+	}
+
+	_, _, err = cs.Dimensions()
+	log.PanicIf(err)
+
+	data = append([]byte{cs.Unit}, cs.Width...)
+	data = append(data, 0)
+	data = append(data, cs.Height...)
+
+	return data, nil
+}
+
+func (ce *ChunkEncoder) encodePCAL(cp *ChunkPCAL) (data []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if expected, found := calibrationParameterCounts[cp.EquationType]; found == false {
+		log.Panicf("pCAL equation-type not valid: (%d)", cp.EquationType)
+	} else if len(cp.Parameters) != expected {
+		log.Panicf("pCAL parameter count not correct for equation-type (%d): (%d) != (%d)", cp.EquationType, len(cp.Parameters), expected)
+	}
+
+	// The calibration name has the same restrictions as a text keyword.
+	data, err = encodeKeyword(cp.Name)
+	log.PanicIf(err)
+
+	header := make([]byte, 10)
+	binary.BigEndian.PutUint32(header[0:4], uint32(cp.X0))
+	binary.BigEndian.PutUint32(header[4:8], uint32(cp.X1))
+	header[8] = cp.EquationType
+	header[9] = uint8(len(cp.Parameters))
+
+	data = append(data, header...)
+
+	unit, err := utf8ToLatin1(cp.Unit)
+	log.PanicIf(err)
+
+	data = append(data, unit...)
+
+	for _, parameter := range cp.Parameters {
+		_, err := parseFloatString(parameter)
+		log.PanicIf(err)
+
+		data = append(data, 0)
+		data = append(data, parameter...)
+	}
+
+	return data, nil
+}
+
+// SetDPI sets the resolution in dots-per-inch. The pHYs chunk is updated in
+// place if it exists before IDAT and is otherwise inserted before IDAT.
+func (cs *ChunkSlice) SetDPI(x, y float64) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if x <= 0 || y <= 0 {
+		log.Panicf("DPI must be positive: (%f, %f)", x, y)
+	}
+
+	cp := &ChunkPHYS{
+		PixelsPerUnitX: uint32(math.Round(x / metersPerInch)),
+		PixelsPerUnitY: uint32(math.Round(y / metersPerInch)),
+		Unit:           PhysicalUnitMeter,
+	}
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(cp)
+	log.PanicIf(err)
+
+	cs.replaceChunk(c, IDATChunkType)
+
+	return nil
+}
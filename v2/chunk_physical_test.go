@@ -0,0 +1,272 @@
+package pngstructure
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func TestChunkEncoder_Encode_Physical_Cycle(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+	index := cs.Index()
+
+	cd := NewChunkDecoder()
+	ce := NewChunkEncoder()
+
+	for _, type_ := range []string{PHYSChunkType, OFFSChunkType, SCALChunkType, PCALChunkType} {
+		original := index[type_][0]
+
+		decoded, err := cd.Decode(original)
+		log.PanicIf(err)
+
+		c, err := ce.Encode(decoded)
+		log.PanicIf(err)
+
+		if reflect.DeepEqual(c.Bytes(), original.Bytes()) != true {
+			t.Fatalf("[%s] chunk not re-encoded correctly: %s", type_, decoded)
+		}
+	}
+}
+
+func TestChunkPHYS_DPI(t *testing.T) {
+	cp := &ChunkPHYS{
+		PixelsPerUnitX: 11811,
+		PixelsPerUnitY: 2835,
+		Unit:           PhysicalUnitMeter,
+	}
+
+	x, y, err := cp.DPI()
+	log.PanicIf(err)
+
+	if fmt.Sprintf("%.2f", x) != "300.00" || fmt.Sprintf("%.2f", y) != "72.01" {
+		t.Fatalf("DPI not correct: (%f, %f)", x, y)
+	}
+
+	cp.Unit = PhysicalUnitUnknown
+
+	_, _, err = cp.DPI()
+	if err != ErrUnitUnknown {
+		t.Fatalf("expected error for unknown unit: %v", err)
+	}
+}
+
+func TestChunkDecoder_decodeOFFS(t *testing.T) {
+	c := NewChunk(OFFSChunkType, []byte{0xff, 0xff, 0xff, 0xfe, 0x00, 0x00, 0x00, 0x64, 0x01})
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	expected := &ChunkOFFS{
+		X:    -2,
+		Y:    100,
+		Unit: OffsetUnitMicrometer,
+	}
+
+	if reflect.DeepEqual(decoded, expected) != true {
+		t.Fatalf("oFFs not correct: %s", decoded)
+	}
+}
+
+func TestChunkSCAL_Dimensions(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(cs.Index()[SCALChunkType][0])
+	log.PanicIf(err)
+
+	scal := decoded.(*ChunkSCAL)
+
+	width, height, err := scal.Dimensions()
+	log.PanicIf(err)
+
+	if width <= 0 || height <= 0 {
+		t.Fatalf("dimensions not correct: (%f, %f)", width, height)
+	}
+
+	scal.Width = "-1.5"
+
+	ce := NewChunkEncoder()
+
+	_, err = ce.Encode(scal)
+	if err == nil {
+		t.Fatalf("expected error for negative width")
+	}
+}
+
+func TestParseScaleValue(t *testing.T) {
+	valid := map[string]float64{
+		"1":       1,
+		"1.5":     1.5,
+		"+.5":     0.5,
+		"2.":      2,
+		"1e-3":    0.001,
+		"2.5E+02": 250,
+	}
+
+	for raw, expected := range valid {
+		value, err := parseScaleValue(raw)
+		log.PanicIf(err)
+
+		if value != expected {
+			t.Fatalf("value [%s] not parsed correctly: (%f)", raw, value)
+		}
+	}
+
+	notValid := []string{
+		"",
+		".",
+		"NaN",
+		"nan",
+		"Inf",
+		"+Infinity",
+		"0x1p-2",
+		"0x10",
+		"1_000",
+		"1e",
+		"e5",
+		" 1",
+		"1.5.5",
+		"0",
+		"-1",
+		"1e400",
+	}
+
+	for _, raw := range notValid {
+		_, err := parseScaleValue(raw)
+		if err == nil {
+			t.Fatalf("expected error for [%s]", raw)
+		}
+	}
+}
+
+func TestChunkPCAL_Cycle(t *testing.T) {
+	original := &ChunkPCAL{
+		Name:         "Temperature",
+		X0:           0,
+		X1:           255,
+		EquationType: CalibrationEquationLinear,
+		Unit:         "°C",
+		Parameters:   []string{"-40.0", "0.5"},
+	}
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(original)
+	log.PanicIf(err)
+
+	cd := NewChunkDecoder()
+
+	recovered, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(recovered, original) != true {
+		t.Fatalf("pCAL not recovered correctly: %s", recovered)
+	}
+
+	original.Parameters = original.Parameters[:1]
+
+	_, err = ce.Encode(original)
+	if err == nil {
+		t.Fatalf("expected error for wrong parameter count")
+	}
+}
+
+func TestChunkSlice_SetDPI_Update(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	position := -1
+	for i, c := range cs.Chunks() {
+		if c.Type == PHYSChunkType {
+			position = i
+		}
+	}
+
+	err := cs.SetDPI(300, 150)
+	log.PanicIf(err)
+
+	chunks := cs.Chunks()
+	if chunks[position].Type != PHYSChunkType {
+		t.Fatalf("pHYs not updated in place")
+	} else if len(cs.Index()[PHYSChunkType]) != 1 {
+		t.Fatalf("expected exactly one pHYs chunk")
+	}
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(chunks[position])
+	log.PanicIf(err)
+
+	cp := decoded.(*ChunkPHYS)
+	if cp.PixelsPerUnitX != 11811 || cp.PixelsPerUnitY != 5906 || cp.Unit != PhysicalUnitMeter {
+		t.Fatalf("pHYs not correct: %s", cp)
+	}
+}
+
+func TestChunkSlice_SetDPI_Insert(t *testing.T) {
+	cs := NewPngChunkSlice()
+
+	err := cs.SetDPI(72, 72)
+	log.PanicIf(err)
+
+	chunks := cs.Chunks()
+	if len(chunks) != 2 || chunks[1].Type != PHYSChunkType {
+		t.Fatalf("pHYs not inserted")
+	}
+}
+
+func TestChunkSlice_SetDPI_AfterImageData(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	cs.removeChunks(func(c *Chunk) bool {
+		return c.Type == PHYSChunkType
+	})
+
+	ce := NewChunkEncoder()
+
+	physChunk, err := ce.Encode(&ChunkPHYS{PixelsPerUnitX: 1, PixelsPerUnitY: 1})
+	log.PanicIf(err)
+
+	// Put the existing chunk after the image data.
+	cs.insertChunk(physChunk)
+
+	err = cs.SetDPI(300, 300)
+	log.PanicIf(err)
+
+	physChunks := 0
+	for _, c := range cs.Chunks() {
+		if c.Type == PHYSChunkType {
+			physChunks++
+		} else if c.Type == IDATChunkType && physChunks == 0 {
+			t.Fatalf("pHYs chunk not moved before IDAT")
+		}
+	}
+
+	if physChunks != 1 {
+		t.Fatalf("expected exactly one pHYs chunk: (%d)", physChunks)
+	}
+}
+
+func ExampleChunkSlice_SetDPI() {
+	cs := NewPngChunkSlice()
+
+	err := cs.SetDPI(300, 300)
+	log.PanicIf(err)
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(cs.Index()[PHYSChunkType][0])
+	log.PanicIf(err)
+
+	x, y, err := decoded.(*ChunkPHYS).DPI()
+	log.PanicIf(err)
+
+	fmt.Printf("%.0f x %.0f\n", x, y)
+
+	// Output:
+	// 300 x 300
+}
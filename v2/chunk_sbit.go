@@ -0,0 +1,162 @@
+package pngstructure
+
+import (
+	"fmt"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// ChunkSBIT describes a sBIT chunk: the number of significant bits in each
+// channel. Only the channels present in the color-type are set.
+type ChunkSBIT struct {
+	// ColorType and BitDepth are taken from the IHDR. They determine the
+	// layout and the allowed values.
+	ColorType uint8
+	BitDepth  uint8
+
+	Gray  uint8
+	Red   uint8
+	Green uint8
+	Blue  uint8
+	Alpha uint8
+}
+
+func (cs *ChunkSBIT) String() string {
+	switch cs.ColorType {
+	case ColorTypeGrayscale:
+		return fmt.Sprintf("sBIT<GRAY=(%d)>", cs.Gray)
+	case ColorTypeGrayscaleAlpha:
+		return fmt.Sprintf("sBIT<GRAY=(%d) ALPHA=(%d)>", cs.Gray, cs.Alpha)
+	case ColorTypeRgba:
+		return fmt.Sprintf("sBIT<RED=(%d) GREEN=(%d) BLUE=(%d) ALPHA=(%d)>", cs.Red, cs.Green, cs.Blue, cs.Alpha)
+	default:
+		return fmt.Sprintf("sBIT<RED=(%d) GREEN=(%d) BLUE=(%d)>", cs.Red, cs.Green, cs.Blue)
+	}
+}
+
+// sampleDepth returns the depth that the significant bits are relative to.
+// Palette entries are always eight bits, regardless of the bit-depth.
+func (cs *ChunkSBIT) sampleDepth() uint8 {
+	if cs.ColorType == ColorTypeIndexed {
+		return 8
+	}
+
+	return cs.BitDepth
+}
+
+// channels returns the names and values of the channels that are present for
+// the color-type, in the order that they are stored.
+func (cs *ChunkSBIT) channels() (names []string, values []*uint8, err error) {
+	switch cs.ColorType {
+	case ColorTypeGrayscale:
+		return []string{"gray"}, []*uint8{&cs.Gray}, nil
+	case ColorTypeRgb, ColorTypeIndexed:
+		return []string{"red", "green", "blue"}, []*uint8{&cs.Red, &cs.Green, &cs.Blue}, nil
+	case ColorTypeGrayscaleAlpha:
+		return []string{"gray", "alpha"}, []*uint8{&cs.Gray, &cs.Alpha}, nil
+	case ColorTypeRgba:
+		return []string{"red", "green", "blue", "alpha"}, []*uint8{&cs.Red, &cs.Green, &cs.Blue, &cs.Alpha}, nil
+	}
+
+	return nil, nil, log.Errorf("color-type not valid: (%d)", cs.ColorType)
+}
+
+// Validate checks that the color-type and bit-depth are a valid combination,
+// that every present channel has between one and the sample-depth bits, and
+// that no absent channel is set.
+func (cs *ChunkSBIT) Validate() (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if isValidBitDepth(cs.ColorType, cs.BitDepth) != true {
+		log.Panicf("bit-depth (%d) not valid for color-type (%d)", cs.BitDepth, cs.ColorType)
+	}
+
+	names, values, err := cs.channels()
+	log.PanicIf(err)
+
+	sampleDepth := cs.sampleDepth()
+
+	present := make(map[*uint8]bool)
+	for i, value := range values {
+		if *value < 1 || *value > sampleDepth {
+			log.Panicf("sBIT %s (%d) not in [1, %d]", names[i], *value, sampleDepth)
+		}
+
+		present[value] = true
+	}
+
+	all := map[string]*uint8{
+		"gray":  &cs.Gray,
+		"red":   &cs.Red,
+		"green": &cs.Green,
+		"blue":  &cs.Blue,
+		"alpha": &cs.Alpha,
+	}
+
+	for name, value := range all {
+		if present[value] == false && *value != 0 {
+			log.Panicf("sBIT %s not allowed for color-type (%d)", name, cs.ColorType)
+		}
+	}
+
+	return nil
+}
+
+func (cd *ChunkDecoder) decodeSBIT(c *Chunk) (cs *ChunkSBIT, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if cd.ihdr == nil {
+		log.Panic(ErrNoIhdr)
+	}
+
+	cs = &ChunkSBIT{
+		ColorType: cd.ihdr.ColorType,
+		BitDepth:  cd.ihdr.BitDepth,
+	}
+
+	_, values, err := cs.channels()
+	log.PanicIf(err)
+
+	if len(c.Data) != len(values) {
+		log.Panicf("sBIT chunk length not correct for color-type (%d): (%d) != (%d)", cs.ColorType, len(c.Data), len(values))
+	}
+
+	for i, value := range values {
+		*value = c.Data[i]
+	}
+
+	err = cs.Validate()
+	log.PanicIf(err)
+
+	return cs, nil
+}
+
+func (ce *ChunkEncoder) encodeSBIT(cs *ChunkSBIT) (data []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = cs.Validate()
+	log.PanicIf(err)
+
+	_, values, err := cs.channels()
+	log.PanicIf(err)
+
+	data = make([]byte, len(values))
+	for i, value := range values {
+		data[i] = *value
+	}
+
+	return data, nil
+}
@@ -0,0 +1,158 @@
+package pngstructure
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func TestChunkSBIT_Cycle(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	cd := NewChunkDecoder()
+
+	_, err := cd.Decode(cs.Chunks()[0])
+	log.PanicIf(err)
+
+	original := cs.Index()[SBITChunkType][0]
+
+	decoded, err := cd.Decode(original)
+	log.PanicIf(err)
+
+	sbit := decoded.(*ChunkSBIT)
+	if sbit.ColorType != ColorTypeRgba || sbit.BitDepth != 8 || sbit.Alpha == 0 {
+		t.Fatalf("sBIT not decoded correctly: %s", sbit)
+	}
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(sbit)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(c.Bytes(), original.Bytes()) != true {
+		t.Fatalf("sBIT not re-encoded correctly")
+	}
+}
+
+func TestChunkDecoder_decodeSBIT_Layouts(t *testing.T) {
+	cases := []struct {
+		ihdr     *ChunkIHDR
+		data     []byte
+		expected *ChunkSBIT
+	}{
+		{
+			ihdr:     &ChunkIHDR{ColorType: ColorTypeGrayscale, BitDepth: 4},
+			data:     []byte{3},
+			expected: &ChunkSBIT{ColorType: ColorTypeGrayscale, BitDepth: 4, Gray: 3},
+		},
+		{
+			ihdr:     &ChunkIHDR{ColorType: ColorTypeRgb, BitDepth: 16},
+			data:     []byte{10, 12, 10},
+			expected: &ChunkSBIT{ColorType: ColorTypeRgb, BitDepth: 16, Red: 10, Green: 12, Blue: 10},
+		},
+		{
+			// Relative to the (eight-bit) palette rather than the bit-depth.
+			ihdr:     &ChunkIHDR{ColorType: ColorTypeIndexed, BitDepth: 2},
+			data:     []byte{5, 6, 5},
+			expected: &ChunkSBIT{ColorType: ColorTypeIndexed, BitDepth: 2, Red: 5, Green: 6, Blue: 5},
+		},
+		{
+			ihdr:     &ChunkIHDR{ColorType: ColorTypeGrayscaleAlpha, BitDepth: 8},
+			data:     []byte{7, 1},
+			expected: &ChunkSBIT{ColorType: ColorTypeGrayscaleAlpha, BitDepth: 8, Gray: 7, Alpha: 1},
+		},
+	}
+
+	for i, tc := range cases {
+		cd := NewChunkDecoder()
+		cd.SetIhdr(tc.ihdr)
+
+		decoded, err := cd.Decode(NewChunk(SBITChunkType, tc.data))
+		log.PanicIf(err)
+
+		if reflect.DeepEqual(decoded, tc.expected) != true {
+			t.Fatalf("sBIT (%d) not decoded correctly: %s", i, decoded)
+		}
+	}
+}
+
+func TestChunkDecoder_decodeSBIT_NotValid(t *testing.T) {
+	cases := []struct {
+		ihdr *ChunkIHDR
+		data []byte
+	}{
+		// Wrong length.
+		{&ChunkIHDR{ColorType: ColorTypeRgb, BitDepth: 8}, []byte{8, 8}},
+
+		// More bits than the bit-depth.
+		{&ChunkIHDR{ColorType: ColorTypeGrayscale, BitDepth: 4}, []byte{5}},
+
+		// Zero bits.
+		{&ChunkIHDR{ColorType: ColorTypeRgba, BitDepth: 8}, []byte{8, 8, 8, 0}},
+	}
+
+	for i, tc := range cases {
+		cd := NewChunkDecoder()
+		cd.SetIhdr(tc.ihdr)
+
+		_, err := cd.Decode(NewChunk(SBITChunkType, tc.data))
+		if err == nil {
+			t.Fatalf("expected error for invalid sBIT (%d)", i)
+		}
+	}
+
+	cd := NewChunkDecoder()
+
+	_, err := cd.Decode(NewChunk(SBITChunkType, []byte{8}))
+	if err == nil {
+		t.Fatalf("expected error without IHDR")
+	} else if log.Is(err, ErrNoIhdr) != true {
+		log.Panic(err)
+	}
+}
+
+func TestChunkSBIT_Encode_Disallowed(t *testing.T) {
+	disallowed := []*ChunkSBIT{
+		// Alpha with a color-type that has no alpha channel.
+		{ColorType: ColorTypeRgb, BitDepth: 8, Red: 5, Green: 6, Blue: 5, Alpha: 8},
+
+		// Gray with a truecolor color-type.
+		{ColorType: ColorTypeRgba, BitDepth: 8, Red: 5, Green: 6, Blue: 5, Alpha: 8, Gray: 4},
+
+		// Bit-depth not allowed for the color-type.
+		{ColorType: ColorTypeRgb, BitDepth: 4, Red: 4, Green: 4, Blue: 4},
+
+		// Too many bits.
+		{ColorType: ColorTypeGrayscale, BitDepth: 8, Gray: 9},
+
+		// Not a color-type.
+		{ColorType: 5, BitDepth: 8, Gray: 8},
+	}
+
+	ce := NewChunkEncoder()
+
+	for i, sbit := range disallowed {
+		_, err := ce.Encode(sbit)
+		if err == nil {
+			t.Fatalf("expected error for disallowed sBIT (%d): %s", i, sbit)
+		}
+	}
+}
+
+func ExampleChunkSBIT_Validate() {
+	sbit := &ChunkSBIT{
+		ColorType: ColorTypeRgb,
+		BitDepth:  8,
+		Red:       5,
+		Green:     6,
+		Blue:      5,
+	}
+
+	err := sbit.Validate()
+	fmt.Printf("%v\n", err)
+
+	// Output:
+	// <nil>
+}
@@ -0,0 +1,294 @@
+package pngstructure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"unicode/utf8"
+
+	"github.com/dsoprea/go-logging"
+)
+
+const (
+	// CompressionMethodDeflate is the only compression-method defined by the
+	// PNG specification (zlib datastream with deflate compression).
+	CompressionMethodDeflate = uint8(0)
+)
+
+var (
+	// ErrNotLatin1 indicates that a string can not be represented in the
+	// Latin-1 (ISO 8859-1) character set required by tEXt and zTXt chunks.
+	ErrNotLatin1 = errors.New("string not representable as latin-1")
+
+	// ErrUnsupportedCompressionMethod indicates a compression-method other
+	// than deflate.
+	ErrUnsupportedCompressionMethod = errors.New("compression method not supported")
+)
+
+// ChunkText describes a tEXt chunk. Both fields are converted from Latin-1.
+type ChunkText struct {
+	Keyword string
+	Text    string
+}
+
+func (ct *ChunkText) String() string {
+	return fmt.Sprintf("tEXt<KEYWORD=[%s] TEXT-LEN=(%d)>", ct.Keyword, len(ct.Text))
+}
+
+// ChunkCompressedText describes a zTXt chunk. Both fields are converted from
+// Latin-1 and the text has already been inflated.
+type ChunkCompressedText struct {
+	Keyword           string
+	CompressionMethod uint8
+	Text              string
+}
+
+func (cct *ChunkCompressedText) String() string {
+	return fmt.Sprintf("zTXt<KEYWORD=[%s] COMP-METHOD=(%d) TEXT-LEN=(%d)>", cct.Keyword, cct.CompressionMethod, len(cct.Text))
+}
+
+// ChunkInternationalText describes an iTXt chunk. The text has already been
+// inflated if it was compressed.
+type ChunkInternationalText struct {
+	Keyword           string
+	Compressed        bool
+	CompressionMethod uint8
+	LanguageTag       string
+	TranslatedKeyword string
+	Text              string
+}
+
+func (cit *ChunkInternationalText) String() string {
+	return fmt.Sprintf("iTXt<KEYWORD=[%s] COMPRESSED=[%v] COMP-METHOD=(%d) LANG=[%s] TRANSLATED-KEYWORD=[%s] TEXT-LEN=(%d)>", cit.Keyword, cit.Compressed, cit.CompressionMethod, cit.LanguageTag, cit.TranslatedKeyword, len(cit.Text))
+}
+
+// latin1ToUtf8 converts Latin-1 bytes to a (UTF-8) string. Every Latin-1 byte
+// is the same as the Unicode code-point with the same value.
+func latin1ToUtf8(raw []byte) string {
+	runes := make([]rune, len(raw))
+	for i, b := range raw {
+		runes[i] = rune(b)
+	}
+
+	return string(runes)
+}
+
+// utf8ToLatin1 converts a (UTF-8) string to Latin-1 bytes.
+func utf8ToLatin1(s string) (raw []byte, err error) {
+	raw = make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return nil, ErrNotLatin1
+		}
+
+		raw = append(raw, byte(r))
+	}
+
+	return raw, nil
+}
+
+// splitNull returns the bytes before the first NUL and the bytes after it.
+func splitNull(data []byte) (before, after []byte, err error) {
+	i := bytes.IndexByte(data, 0)
+	if i == -1 {
+		return nil, nil, errors.New("null separator not found")
+	}
+
+	return data[:i], data[i+1:], nil
+}
+
+func (cd *ChunkDecoder) decodeText(c *Chunk) (ct *ChunkText, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	keyword, text, err := splitNull(c.Data)
+	log.PanicIf(err)
+
+	ct = &ChunkText{
+		Keyword: latin1ToUtf8(keyword),
+		Text:    latin1ToUtf8(text),
+	}
+
+	return ct, nil
+}
+
+func (cd *ChunkDecoder) decodeCompressedText(c *Chunk) (cct *ChunkCompressedText, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	keyword, rest, err := splitNull(c.Data)
+	log.PanicIf(err)
+
+	if len(rest) < 1 {
+		log.Panicf("zTXt chunk too short")
+	}
+
+	compressionMethod := rest[0]
+	if compressionMethod != CompressionMethodDeflate {
+		log.Panic(ErrUnsupportedCompressionMethod)
+	}
+
+	text, err := inflate(rest[1:])
+	log.PanicIf(err)
+
+	cct = &ChunkCompressedText{
+		Keyword:           latin1ToUtf8(keyword),
+		CompressionMethod: compressionMethod,
+		Text:              latin1ToUtf8(text),
+	}
+
+	return cct, nil
+}
+
+func (cd *ChunkDecoder) decodeInternationalText(c *Chunk) (cit *ChunkInternationalText, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	keyword, rest, err := splitNull(c.Data)
+	log.PanicIf(err)
+
+	if len(rest) < 2 {
+		log.Panicf("iTXt chunk too short")
+	}
+
+	compressionFlag := rest[0]
+	compressionMethod := rest[1]
+
+	languageTag, rest, err := splitNull(rest[2:])
+	log.PanicIf(err)
+
+	translatedKeyword, text, err := splitNull(rest)
+	log.PanicIf(err)
+
+	if compressionFlag == 1 {
+		if compressionMethod != CompressionMethodDeflate {
+			log.Panic(ErrUnsupportedCompressionMethod)
+		}
+
+		text, err = inflate(text)
+		log.PanicIf(err)
+	} else if compressionFlag != 0 {
+		log.Panicf("iTXt compression-flag not valid: (%d)", compressionFlag)
+	}
+
+	cit = &ChunkInternationalText{
+		Keyword:           latin1ToUtf8(keyword),
+		Compressed:        compressionFlag == 1,
+		CompressionMethod: compressionMethod,
+		LanguageTag:       string(languageTag),
+		TranslatedKeyword: string(translatedKeyword),
+		Text:              string(text),
+	}
+
+	return cit, nil
+}
+
+// encodeKeyword converts the keyword to Latin-1 and adds the NUL separator.
+func encodeKeyword(keyword string) (raw []byte, err error) {
+	err = ValidateKeyword(keyword)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err = utf8ToLatin1(keyword)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(raw, 0), nil
+}
+
+func (ce *ChunkEncoder) encodeText(ct *ChunkText) (data []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	data, err = encodeKeyword(ct.Keyword)
+	log.PanicIf(err)
+
+	text, err := utf8ToLatin1(ct.Text)
+	log.PanicIf(err)
+
+	return append(data, text...), nil
+}
+
+func (ce *ChunkEncoder) encodeCompressedText(cct *ChunkCompressedText) (data []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if cct.CompressionMethod != CompressionMethodDeflate {
+		log.Panic(ErrUnsupportedCompressionMethod)
+	}
+
+	data, err = encodeKeyword(cct.Keyword)
+	log.PanicIf(err)
+
+	text, err := utf8ToLatin1(cct.Text)
+	log.PanicIf(err)
+
+	deflated, err := deflate(text)
+	log.PanicIf(err)
+
+	data = append(data, cct.CompressionMethod)
+	data = append(data, deflated...)
+
+	return data, nil
+}
+
+func (ce *ChunkEncoder) encodeInternationalText(cit *ChunkInternationalText) (data []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if utf8.ValidString(cit.Text) != true || utf8.ValidString(cit.TranslatedKeyword) != true {
+		log.Panicf("iTXt text must be valid UTF-8")
+	}
+
+	data, err = encodeKeyword(cit.Keyword)
+	log.PanicIf(err)
+
+	text := []byte(cit.Text)
+
+	if cit.Compressed == true {
+		if cit.CompressionMethod != CompressionMethodDeflate {
+			log.Panic(ErrUnsupportedCompressionMethod)
+		}
+
+		text, err = deflate(text)
+		log.PanicIf(err)
+
+		data = append(data, 1, cit.CompressionMethod)
+	} else {
+		data = append(data, 0, 0)
+	}
+
+	data = append(data, cit.LanguageTag...)
+	data = append(data, 0)
+
+	data = append(data, cit.TranslatedKeyword...)
+	data = append(data, 0)
+
+	data = append(data, text...)
+
+	return data, nil
+}
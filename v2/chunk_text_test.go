@@ -0,0 +1,223 @@
+package pngstructure
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func TestLatin1_Cycle(t *testing.T) {
+	raw := []byte{'a', 0xe9, 'b', 0xff}
+
+	s := latin1ToUtf8(raw)
+	if s != "aébÿ" {
+		t.Fatalf("latin-1 not converted correctly: [%s]", s)
+	}
+
+	recovered, err := utf8ToLatin1(s)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(recovered, raw) != true {
+		t.Fatalf("latin-1 not recovered correctly")
+	}
+}
+
+func TestUtf8ToLatin1_NotRepresentable(t *testing.T) {
+	_, err := utf8ToLatin1("snow ☃")
+	if err != ErrNotLatin1 {
+		t.Fatalf("expected latin-1 error: %v", err)
+	}
+}
+
+func TestChunkDecoder_decodeText(t *testing.T) {
+	c := NewChunk(TEXtChunkType, []byte{'A', 'u', 't', 'h', 'o', 'r', 0, 'J', 0xe9, 'r', 0xf4, 'm', 'e'})
+
+	cd := NewChunkDecoder()
+
+	ct, err := cd.decodeText(c)
+	log.PanicIf(err)
+
+	expected := &ChunkText{
+		Keyword: "Author",
+		Text:    "Jérôme",
+	}
+
+	if reflect.DeepEqual(ct, expected) != true {
+		t.Fatalf("tEXt not decoded correctly: %v", ct)
+	}
+}
+
+func TestChunkText_Cycle(t *testing.T) {
+	original := &ChunkText{
+		Keyword: "Comment",
+		Text:    "Café",
+	}
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(original)
+	log.PanicIf(err)
+
+	if c.Type != TEXtChunkType {
+		t.Fatalf("chunk type not correct: [%s]", c.Type)
+	} else if int(c.Length) != len("Comment")+1+len("Caf")+1 {
+		t.Fatalf("chunk length not correct: (%d)", c.Length)
+	} else if c.CheckCrc32() != true {
+		t.Fatalf("chunk CRC not correct")
+	}
+
+	cd := NewChunkDecoder()
+
+	recovered, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(recovered, original) != true {
+		t.Fatalf("tEXt not recovered correctly: %v", recovered)
+	}
+}
+
+func TestChunkText_Encode_NotLatin1(t *testing.T) {
+	ct := &ChunkText{
+		Keyword: "Comment",
+		Text:    "Snowman ☃",
+	}
+
+	ce := NewChunkEncoder()
+
+	_, err := ce.Encode(ct)
+	if err == nil {
+		t.Fatalf("expected error for non-latin-1 text")
+	} else if log.Is(err, ErrNotLatin1) != true {
+		log.Panic(err)
+	}
+}
+
+func TestChunkCompressedText_Cycle(t *testing.T) {
+	original := &ChunkCompressedText{
+		Keyword:           "Description",
+		CompressionMethod: CompressionMethodDeflate,
+		Text:              strings.Repeat("Déjà vu. ", 100),
+	}
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(original)
+	log.PanicIf(err)
+
+	if c.Type != ZTXtChunkType {
+		t.Fatalf("chunk type not correct: [%s]", c.Type)
+	} else if int(c.Length) >= len(original.Text) {
+		t.Fatalf("text does not appear to be compressed")
+	} else if c.CheckCrc32() != true {
+		t.Fatalf("chunk CRC not correct")
+	}
+
+	cd := NewChunkDecoder()
+
+	recovered, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(recovered, original) != true {
+		t.Fatalf("zTXt not recovered correctly: %v", recovered)
+	}
+}
+
+func TestChunkDecoder_decodeCompressedText_BadMethod(t *testing.T) {
+	c := NewChunk(ZTXtChunkType, []byte{'K', 0, 1, 0x78, 0x9c})
+
+	cd := NewChunkDecoder()
+
+	_, err := cd.Decode(c)
+	if err == nil {
+		t.Fatalf("expected error for bad compression-method")
+	} else if log.Is(err, ErrUnsupportedCompressionMethod) != true {
+		log.Panic(err)
+	}
+}
+
+func TestChunkInternationalText_Cycle_Uncompressed(t *testing.T) {
+	original := &ChunkInternationalText{
+		Keyword:           "Title",
+		LanguageTag:       "ja",
+		TranslatedKeyword: "タイトル",
+		Text:              "雪だるま ☃",
+	}
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(original)
+	log.PanicIf(err)
+
+	if c.Type != ITXtChunkType {
+		t.Fatalf("chunk type not correct: [%s]", c.Type)
+	} else if c.CheckCrc32() != true {
+		t.Fatalf("chunk CRC not correct")
+	}
+
+	cd := NewChunkDecoder()
+
+	recovered, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(recovered, original) != true {
+		t.Fatalf("iTXt not recovered correctly: %v", recovered)
+	}
+}
+
+func TestChunkInternationalText_Cycle_Compressed(t *testing.T) {
+	original := &ChunkInternationalText{
+		Keyword:           "Description",
+		Compressed:        true,
+		CompressionMethod: CompressionMethodDeflate,
+		LanguageTag:       "de-CH",
+		TranslatedKeyword: "Beschreibung",
+		Text:              strings.Repeat("Grüezi mitenand. ", 50),
+	}
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(original)
+	log.PanicIf(err)
+
+	if int(c.Length) >= len(original.Text) {
+		t.Fatalf("text does not appear to be compressed")
+	}
+
+	cd := NewChunkDecoder()
+
+	recovered, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(recovered, original) != true {
+		t.Fatalf("iTXt not recovered correctly: %v", recovered)
+	}
+}
+
+func TestChunkDecoder_decodeInternationalText_Truncated(t *testing.T) {
+	c := NewChunk(ITXtChunkType, []byte{'K', 0, 0, 0, 'e', 'n'})
+
+	cd := NewChunkDecoder()
+
+	_, err := cd.Decode(c)
+	if err == nil {
+		t.Fatalf("expected error for truncated iTXt")
+	}
+}
+
+func ExampleChunkDecoder_Decode_text() {
+	c := NewChunk(TEXtChunkType, []byte("Author\x00Someone"))
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	ct := decoded.(*ChunkText)
+	fmt.Printf("%s: %s\n", ct.Keyword, ct.Text)
+
+	// Output:
+	// Author: Someone
+}
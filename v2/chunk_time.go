@@ -0,0 +1,107 @@
+package pngstructure
+
+import (
+	"fmt"
+	"time"
+
+	"encoding/binary"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// ChunkTIME describes a tIME chunk: the time of the last modification.
+type ChunkTIME struct {
+	// ModificationTime is always in UTC.
+	ModificationTime time.Time
+}
+
+func (ct *ChunkTIME) String() string {
+	return fmt.Sprintf("tIME<TIME=[%s]>", ct.ModificationTime.Format(time.RFC3339))
+}
+
+func (cd *ChunkDecoder) decodeTIME(c *Chunk) (ct *ChunkTIME, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err := log.Wrap(state.(error))
+			log.Panic(err)
+		}
+	}()
+
+	if len(c.Data) != 7 {
+		log.Panicf("tIME chunk length not correct: (%d)", len(c.Data))
+	}
+
+	year := int(binary.BigEndian.Uint16(c.Data[0:2]))
+	month := int(c.Data[2])
+	day := int(c.Data[3])
+	hour := int(c.Data[4])
+	minute := int(c.Data[5])
+
+	// Allows for leap seconds.
+	second := int(c.Data[6])
+
+	if month < 1 || month > 12 {
+		log.Panicf("tIME month not valid: (%d)", month)
+	}
+
+	// The zeroth day of the next month is the last day of this one.
+	daysInMonth := time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+
+	if day < 1 || day > daysInMonth {
+		log.Panicf("tIME day not valid: (%d)", day)
+	} else if hour > 23 {
+		log.Panicf("tIME hour not valid: (%d)", hour)
+	} else if minute > 59 {
+		log.Panicf("tIME minute not valid: (%d)", minute)
+	} else if second > 60 {
+		log.Panicf("tIME second not valid: (%d)", second)
+	}
+
+	ct = &ChunkTIME{
+		ModificationTime: time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC),
+	}
+
+	return ct, nil
+}
+
+func (ce *ChunkEncoder) encodeTIME(ct *ChunkTIME) (data []byte, err error) {
+	t := ct.ModificationTime.UTC()
+
+	if t.Year() < 0 || t.Year() > 0xffff {
+		return nil, log.Errorf("tIME year not representable: (%d)", t.Year())
+	}
+
+	data = make([]byte, 7)
+
+	binary.BigEndian.PutUint16(data[0:2], uint16(t.Year()))
+	data[2] = uint8(t.Month())
+	data[3] = uint8(t.Day())
+	data[4] = uint8(t.Hour())
+	data[5] = uint8(t.Minute())
+	data[6] = uint8(t.Second())
+
+	return data, nil
+}
+
+// SetModificationTime sets the tIME chunk, replacing any existing one. The
+// time is converted to UTC.
+func (cs *ChunkSlice) SetModificationTime(t time.Time) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	ct := &ChunkTIME{
+		ModificationTime: t,
+	}
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(ct)
+	log.PanicIf(err)
+
+	cs.replaceChunk(c)
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package pngstructure
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func TestChunkDecoder_decodeTIME(t *testing.T) {
+	c := NewChunk(TIMEChunkType, []byte{0x07, 0xcc, 0x06, 0x07, 0x11, 0x3a, 0x08})
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	expected := time.Date(1996, time.June, 7, 17, 58, 8, 0, time.UTC)
+
+	ct := decoded.(*ChunkTIME)
+	if ct.ModificationTime.Equal(expected) != true || ct.ModificationTime.Location() != time.UTC {
+		t.Fatalf("tIME not correct: %s", ct)
+	}
+}
+
+func TestChunkDecoder_decodeTIME_NotValid(t *testing.T) {
+	invalid := [][]byte{
+		{0x07, 0xcc, 0x00, 0x07, 0x11, 0x3a, 0x08},
+		{0x07, 0xcc, 0x0d, 0x07, 0x11, 0x3a, 0x08},
+		{0x07, 0xcc, 0x06, 0x00, 0x11, 0x3a, 0x08},
+		{0x07, 0xcc, 0x06, 0x20, 0x11, 0x3a, 0x08},
+		{0x07, 0xcc, 0x06, 0x1f, 0x11, 0x3a, 0x08},
+		{0x07, 0xcc, 0x02, 0x1f, 0x11, 0x3a, 0x08},
+		{0x07, 0xcc, 0x02, 0x1e, 0x11, 0x3a, 0x08},
+		{0x07, 0xcd, 0x02, 0x1d, 0x11, 0x3a, 0x08},
+		{0x07, 0xcc, 0x06, 0x07, 0x18, 0x3a, 0x08},
+		{0x07, 0xcc, 0x06, 0x07, 0x11, 0x3c, 0x08},
+		{0x07, 0xcc, 0x06, 0x07, 0x11, 0x3a, 0x3d},
+		{0x07, 0xcc, 0x06},
+	}
+
+	cd := NewChunkDecoder()
+
+	for i, data := range invalid {
+		_, err := cd.Decode(NewChunk(TIMEChunkType, data))
+		if err == nil {
+			t.Fatalf("expected error for invalid tIME (%d)", i)
+		}
+	}
+}
+
+func TestChunkDecoder_decodeTIME_LeapDay(t *testing.T) {
+	c := NewChunk(TIMEChunkType, []byte{0x07, 0xcc, 0x02, 0x1d, 0x11, 0x3a, 0x08})
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(c)
+	log.PanicIf(err)
+
+	expected := time.Date(1996, time.February, 29, 17, 58, 8, 0, time.UTC)
+
+	ct := decoded.(*ChunkTIME)
+	if ct.ModificationTime.Equal(expected) != true {
+		t.Fatalf("tIME not correct: %s", ct)
+	}
+}
+
+func TestChunkTIME_Cycle(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+	original := cs.Index()[TIMEChunkType][0]
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(original)
+	log.PanicIf(err)
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(decoded)
+	log.PanicIf(err)
+
+	if reflect.DeepEqual(c.Bytes(), original.Bytes()) != true {
+		t.Fatalf("tIME not re-encoded correctly")
+	}
+}
+
+func TestChunkSlice_SetModificationTime(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	location := time.FixedZone("UTC+2", 2*60*60)
+	modified := time.Date(2020, time.July, 4, 12, 30, 15, 0, location)
+
+	err := cs.SetModificationTime(modified)
+	log.PanicIf(err)
+
+	timeChunks := cs.Index()[TIMEChunkType]
+	if len(timeChunks) != 1 {
+		t.Fatalf("expected exactly one tIME chunk")
+	}
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(timeChunks[0])
+	log.PanicIf(err)
+
+	ct := decoded.(*ChunkTIME)
+	if ct.ModificationTime.Equal(modified) != true || ct.ModificationTime.Hour() != 10 {
+		t.Fatalf("tIME not correct: %s", ct)
+	}
+}
+
+func TestChunkSlice_WriteTo_DoUpdateModificationTime(t *testing.T) {
+	cs := NewPngChunkSlice()
+	cs.DoUpdateModificationTime(true)
+
+	before := time.Now().UTC().Truncate(time.Second)
+
+	b := new(bytes.Buffer)
+
+	err := cs.WriteTo(b)
+	log.PanicIf(err)
+
+	after := time.Now().UTC()
+
+	timeChunks := cs.Index()[TIMEChunkType]
+	if len(timeChunks) != 1 {
+		t.Fatalf("expected exactly one tIME chunk")
+	}
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(timeChunks[0])
+	log.PanicIf(err)
+
+	modified := decoded.(*ChunkTIME).ModificationTime
+	if modified.Before(before) == true || modified.After(after) == true {
+		t.Fatalf("tIME not refreshed: %s", modified)
+	}
+}
+
+func ExampleChunkSlice_SetModificationTime() {
+	cs := NewPngChunkSlice()
+
+	err := cs.SetModificationTime(time.Date(2021, time.May, 12, 4, 36, 55, 0, time.UTC))
+	log.PanicIf(err)
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(cs.Index()[TIMEChunkType][0])
+	log.PanicIf(err)
+
+	fmt.Printf("%s\n", decoded)
+
+	// Output:
+	// tIME<TIME=[2021-05-12T04:36:55Z]>
+}
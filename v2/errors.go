@@ -0,0 +1,82 @@
+package pngstructure
+
+import (
+	"fmt"
+	"io"
+)
+
+// ChunkError describes a failure with a particular chunk. It unwraps to the
+// cause, so `errors.Is` and `errors.As` see through it (e.g. to
+// `ErrCrcFailure`, a `*CrcMismatchError`, a `*TruncatedError`, or one of the
+// limit errors). It is returned inside the usual stack-trace wrapper, which
+// both `log.Is` and `errors.Is` see through.
+type ChunkError struct {
+	// Offset is where the chunk starts in the stream.
+	Offset int
+
+	Type string
+
+	// Index is the position of the chunk in the stream, or -1 if not known.
+	Index int
+
+	Cause error
+}
+
+func (ce *ChunkError) Error() string {
+	return fmt.Sprintf("chunk (%d) [%s] at offset (%d): %s", ce.Index, ce.Type, ce.Offset, ce.Cause.Error())
+}
+
+// Unwrap returns the cause.
+func (ce *ChunkError) Unwrap() error {
+	return ce.Cause
+}
+
+// CrcMismatchError describes a chunk whose CRC does not match its data. It
+// is `ErrCrcFailure` as far as `errors.Is` is concerned.
+type CrcMismatchError struct {
+	// Expected is the CRC that was stored.
+	Expected uint32
+
+	// Actual is the CRC that was calculated.
+	Actual uint32
+}
+
+func (cme *CrcMismatchError) Error() string {
+	return fmt.Sprintf("%s: stored (0x%08x) but calculated (0x%08x)", ErrCrcFailure.Error(), cme.Expected, cme.Actual)
+}
+
+// Is returns true for `ErrCrcFailure`.
+func (cme *CrcMismatchError) Is(target error) bool {
+	return target == ErrCrcFailure
+}
+
+// TruncatedError describes a stream that ended early. It is
+// `io.ErrUnexpectedEOF` as far as `errors.Is` is concerned.
+type TruncatedError struct {
+	// Offset is where the data that is missing should have started.
+	Offset int
+
+	// Expected is how many bytes were needed and Actual is how many there
+	// were.
+	Expected int
+	Actual   int
+}
+
+func (te *TruncatedError) Error() string {
+	return fmt.Sprintf("truncated at offset (%d): needed (%d) bytes but only (%d) available", te.Offset, te.Expected, te.Actual)
+}
+
+// Is returns true for `io.ErrUnexpectedEOF`.
+func (te *TruncatedError) Is(target error) bool {
+	return target == io.ErrUnexpectedEOF
+}
+
+// newChunkError returns a `*ChunkError` for the given cause.
+func newChunkError(offset int, type_ string, index int, cause error) *ChunkError {
+	return &ChunkError{
+		Offset: offset,
+		Type:   type_,
+		Index:  index,
+		Cause:  cause,
+	}
+}
@@ -0,0 +1,231 @@
+package pngstructure
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// parseTestAll parses the data with every entry-point that reads the whole
+// stream.
+func parseTestAll(data []byte) (errs map[string]error) {
+	pmp := NewPngMediaParser()
+
+	errs = make(map[string]error)
+
+	_, errs["ParseBytes"] = pmp.ParseBytes(data)
+	_, errs["ParseReader"] = pmp.ParseReader(bytes.NewReader(data))
+	_, errs["ParseLazy"] = pmp.ParseLazy(bytes.NewReader(data), int64(len(data)))
+
+	return errs
+}
+
+func TestChunkError_CrcMismatch(t *testing.T) {
+	data, err := ioutil.ReadFile(getTestBasicImageFilepath())
+	log.PanicIf(err)
+
+	cs := getTestBasicChunkSlice()
+
+	index := -1
+	for i, c := range cs.Chunks() {
+		if c.Type == TEXtChunkType {
+			index = i
+			break
+		}
+	}
+
+	expected := cs.Chunks()[index]
+	data[expected.Offset+8] ^= 0xff
+
+	for name, err := range parseTestAll(data) {
+		// A lazy parse only finds it once the chunk is loaded.
+		if name == "ParseLazy" {
+			log.PanicIf(err)
+
+			pmp := NewPngMediaParser()
+
+			lazy, err := pmp.ParseLazy(bytes.NewReader(data), int64(len(data)))
+			log.PanicIf(err)
+
+			err = lazy.Chunks()[index].Load()
+
+			var ce *ChunkError
+			if errors.As(err, &ce) != true || ce.Index != -1 || ce.Offset != expected.Offset {
+				t.Fatalf("%s error not correct: [%v]", name, err)
+			}
+
+			continue
+		}
+
+		if errors.Is(err, ErrCrcFailure) != true {
+			t.Fatalf("%s error not a CRC failure: [%v]", name, err)
+		} else if log.Is(err, ErrCrcFailure) != true {
+			t.Fatalf("%s error not a CRC failure for log.Is: [%v]", name, err)
+		} else if _, ok := err.(interface{ ErrorStack() string }); ok != true {
+			t.Fatalf("%s error has no stack", name)
+		}
+
+		var ce *ChunkError
+		if errors.As(err, &ce) != true {
+			t.Fatalf("%s error not a ChunkError: [%v]", name, err)
+		} else if ce.Offset != expected.Offset || ce.Type != TEXtChunkType || ce.Index != index {
+			t.Fatalf("%s error location not correct: %v", name, ce)
+		}
+
+		var cme *CrcMismatchError
+		if errors.As(err, &cme) != true {
+			t.Fatalf("%s error not a CrcMismatchError: [%v]", name, err)
+		} else if cme.Expected != expected.Crc || cme.Actual == expected.Crc {
+			t.Fatalf("%s CRCs not correct: %v", name, cme)
+		}
+	}
+}
+
+func TestChunkError_Truncated(t *testing.T) {
+	data, err := ioutil.ReadFile(getTestBasicImageFilepath())
+	log.PanicIf(err)
+
+	// In the middle of a chunk and in the middle of a header.
+	idat := getTestBasicChunkSlice().Index()[IDATChunkType][0]
+
+	for _, size := range []int{idat.Offset + 20, idat.Offset + 3} {
+		for name, err := range parseTestAll(data[:size]) {
+			if errors.Is(err, io.ErrUnexpectedEOF) != true {
+				t.Fatalf("%s error at (%d) not an unexpected EOF: [%v]", name, size, err)
+			}
+
+			var te *TruncatedError
+			if errors.As(err, &te) != true {
+				t.Fatalf("%s error at (%d) not a TruncatedError: [%v]", name, size, err)
+			} else if te.Offset > size || te.Actual >= te.Expected {
+				t.Fatalf("%s truncation at (%d) not correct: %v", name, size, te)
+			}
+		}
+	}
+}
+
+func TestPngMediaParser_Parse_TrailingData(t *testing.T) {
+	data, err := ioutil.ReadFile(getTestBasicImageFilepath())
+	log.PanicIf(err)
+
+	chunkCount := len(getTestBasicChunkSlice().Chunks())
+
+	trailers := [][]byte{
+		{1, 2, 3},
+		bytes.Repeat([]byte{0xff}, 100),
+	}
+
+	for i, trailer := range trailers {
+		withTrailer := append(append([]byte{}, data...), trailer...)
+
+		for name, err := range parseTestAll(withTrailer) {
+			if err != nil {
+				t.Fatalf("%s failed with trailer (%d): [%v]", name, i, err)
+			}
+		}
+
+		pmp := NewPngMediaParser()
+
+		intfc, err := pmp.ParseBytes(withTrailer)
+		log.PanicIf(err)
+
+		if len(intfc.(*ChunkSlice).Chunks()) != chunkCount {
+			t.Fatalf("chunk count not correct with trailer (%d)", i)
+		}
+	}
+}
+
+func TestChunkError_NotPng(t *testing.T) {
+	for name, err := range parseTestAll([]byte("GIF89a, not a PNG")) {
+		if errors.Is(err, ErrNotPng) != true {
+			t.Fatalf("%s error not ErrNotPng: [%v]", name, err)
+		}
+	}
+}
+
+func TestChunkError_Limit(t *testing.T) {
+	data := getTestEncodedChunkSlice(getTestImageChunkSlice(getTestGradientImage(40, 30)))
+
+	errs := parseTestWithOptions(data, &ParseOptions{MaxWidth: 10})
+	for name, err := range errs {
+		var ce *ChunkError
+		if errors.As(err, &ce) != true || ce.Type != IHDRChunkType || ce.Index != 0 || ce.Offset != len(PngSignature) {
+			t.Fatalf("%s error not correct: [%v]", name, err)
+		} else if errors.Is(err, ErrImageTooWide) != true {
+			t.Fatalf("%s error cause not correct: [%v]", name, err)
+		}
+	}
+}
+
+func TestPngSplitter_CrcMismatches(t *testing.T) {
+	data, err := ioutil.ReadFile(getTestBasicImageFilepath())
+	log.PanicIf(err)
+
+	expected := getTestBasicChunkSlice().Index()[IDATChunkType][0]
+	data[expected.Offset+8] ^= 0xff
+
+	ps := NewPngSplitter()
+	ps.DoCheckCrc(false)
+
+	err = ps.readHeader(bytes.NewReader(data))
+	log.PanicIf(err)
+
+	s := bufio.NewScanner(bytes.NewReader(data[len(PngSignature):]))
+	s.Buffer([]byte{}, len(data))
+	s.Split(ps.Split)
+
+	for s.Scan() != false {
+	}
+
+	log.PanicIf(s.Err())
+
+	mismatches := ps.CrcMismatches()
+	if len(mismatches) != 1 || len(ps.CrcErrors()) != 1 {
+		t.Fatalf("CRC mismatches not correct: %v", mismatches)
+	} else if mismatches[0].Offset != expected.Offset || mismatches[0].Type != IDATChunkType {
+		t.Fatalf("CRC mismatch not correct: %v", mismatches[0])
+	}
+}
+
+func TestChunkError_Wrapped(t *testing.T) {
+	ce := &ChunkError{Type: IHDRChunkType, Cause: &CrcMismatchError{}}
+
+	wrapped := log.Wrap(ce)
+
+	var actual *ChunkError
+	if log.Is(wrapped, ErrCrcFailure) != true {
+		t.Fatalf("cause not found with log.Is")
+	} else if errors.Is(wrapped, ErrCrcFailure) != true {
+		t.Fatalf("cause not found with errors.Is")
+	} else if errors.As(wrapped, &actual) != true || actual != ce {
+		t.Fatalf("chunk error not found with errors.As")
+	}
+}
+
+func ExampleChunkError() {
+	cs := getTestImageChunkSlice(getTestGradientImage(4, 4))
+	data := getTestEncodedChunkSlice(cs)
+
+	// Corrupt the IDAT.
+	idat := cs.Index()[IDATChunkType][0]
+	data[idat.Offset+8] ^= 0xff
+
+	pmp := NewPngMediaParser()
+
+	_, err := pmp.ParseBytes(data)
+
+	var ce *ChunkError
+	if errors.As(err, &ce) == true && errors.Is(err, ErrCrcFailure) == true {
+		fmt.Printf("damaged [%s] chunk at offset (%d)\n", ce.Type, ce.Offset)
+	}
+
+	// Output:
+	// damaged [IDAT] chunk at offset (33)
+}
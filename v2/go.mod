@@ -1,6 +1,6 @@
 module github.com/dsoprea/go-png-image-structure/v2
 
-go 1.12
+go 1.13
 
 // Development only
 // replace github.com/dsoprea/go-utility/v2 => ../../go-utility/v2
@@ -10,5 +10,6 @@ require (
 	github.com/dsoprea/go-exif/v3 v3.0.0-20210428042052-dca55bf8ca15
 	github.com/dsoprea/go-logging v0.0.0-20200517223158-a10564966e9d
 	github.com/dsoprea/go-utility/v2 v2.0.0-20200717064901-2fccff4aa15e
+	github.com/go-errors/errors v1.4.1 // indirect
 	golang.org/x/net v0.0.0-20200520182314-0ba52f642ac2 // indirect
 )
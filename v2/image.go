@@ -0,0 +1,214 @@
+package pngstructure
+
+import (
+	"image"
+
+	"encoding/binary"
+	"image/color"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// readSample returns the sample at the given index (pixel times channel count
+// plus channel) of a packed row.
+func readSample(row []byte, index int, bitDepth uint8) uint16 {
+	switch bitDepth {
+	case 8:
+		return uint16(row[index])
+	case 16:
+		return binary.BigEndian.Uint16(row[index*2:])
+	}
+
+	bit := index * int(bitDepth)
+	shift := uint(8 - int(bitDepth) - bit%8)
+	mask := byte(1<<bitDepth - 1)
+
+	return uint16((row[bit/8] >> shift) & mask)
+}
+
+// Image decodes the image from the chunks that we already have (IHDR, PLTE,
+// tRNS and IDAT), without going back to the original stream. The concrete
+// type is the same one that `image/png` would return: `*image.Paletted` for
+// indexed images, `*image.Gray` or `*image.Gray16` for opaque grayscale,
+// `*image.RGBA` or `*image.RGBA64` for opaque truecolor, and `*image.NRGBA`
+// or `*image.NRGBA64` for everything with transparency.
+func (cs *ChunkSlice) Image() (img image.Image, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	ihdr, rows, err := cs.PixelRows()
+	log.PanicIf(err)
+
+	cd := NewChunkDecoder()
+	cd.SetIhdr(ihdr)
+
+	index := cs.Index()
+
+	var palette color.Palette
+	if chunks, found := index[PLTEChunkType]; found == true {
+		decoded, err := cd.Decode(chunks[0])
+		log.PanicIf(err)
+
+		palette = decoded.(*ChunkPLTE).Palette
+	}
+
+	var trns *ChunkTRNS
+	if chunks, found := index[TRNSChunkType]; found == true {
+		decoded, err := cd.Decode(chunks[0])
+		log.PanicIf(err)
+
+		trns = decoded.(*ChunkTRNS)
+	}
+
+	bounds := image.Rect(0, 0, int(ihdr.Width), int(ihdr.Height))
+	bitDepth := ihdr.BitDepth
+	channels := channelCounts[ihdr.ColorType]
+
+	if ihdr.ColorType == ColorTypeIndexed {
+		if palette == nil {
+			log.Panicf("indexed image has no PLTE")
+		}
+
+		if trns != nil {
+			palette = trns.ApplyToPalette(palette)
+		}
+
+		// Like `image/png`, indices beyond the palette are opaque black
+		// rather than an error.
+		for len(palette) < 1<<bitDepth {
+			palette = append(palette, color.RGBA{0, 0, 0, 0xff})
+		}
+
+		paletted := image.NewPaletted(bounds, palette)
+		for y, row := range rows {
+			for x := 0; x < bounds.Dx(); x++ {
+				paletted.Pix[y*paletted.Stride+x] = uint8(readSample(row, x, bitDepth))
+			}
+		}
+
+		return paletted, nil
+	}
+
+	// Every other color-type goes through 16-bit, non-premultiplied values.
+
+	var set func(i int, r, g, b, a uint16)
+
+	hasAlpha := ihdr.ColorType == ColorTypeGrayscaleAlpha || ihdr.ColorType == ColorTypeRgba || trns != nil
+	isGray := ihdr.ColorType == ColorTypeGrayscale || ihdr.ColorType == ColorTypeGrayscaleAlpha
+
+	switch {
+	case hasAlpha == false && isGray == true && bitDepth == 16:
+		gray := image.NewGray16(bounds)
+		set = func(i int, r, g, b, a uint16) {
+			binary.BigEndian.PutUint16(gray.Pix[i*2:], r)
+		}
+
+		img = gray
+
+	case hasAlpha == false && isGray == true:
+		gray := image.NewGray(bounds)
+		set = func(i int, r, g, b, a uint16) {
+			gray.Pix[i] = uint8(r >> 8)
+		}
+
+		img = gray
+
+	case hasAlpha == false && bitDepth == 16:
+		rgba := image.NewRGBA64(bounds)
+		set = func(i int, r, g, b, a uint16) {
+			pix := rgba.Pix[i*8 : i*8+8]
+			binary.BigEndian.PutUint16(pix[0:], r)
+			binary.BigEndian.PutUint16(pix[2:], g)
+			binary.BigEndian.PutUint16(pix[4:], b)
+			binary.BigEndian.PutUint16(pix[6:], 0xffff)
+		}
+
+		img = rgba
+
+	case hasAlpha == false:
+		rgba := image.NewRGBA(bounds)
+		set = func(i int, r, g, b, a uint16) {
+			pix := rgba.Pix[i*4 : i*4+4]
+			pix[0], pix[1], pix[2], pix[3] = uint8(r>>8), uint8(g>>8), uint8(b>>8), 0xff
+		}
+
+		img = rgba
+
+	case bitDepth == 16:
+		nrgba := image.NewNRGBA64(bounds)
+		set = func(i int, r, g, b, a uint16) {
+			pix := nrgba.Pix[i*8 : i*8+8]
+			binary.BigEndian.PutUint16(pix[0:], r)
+			binary.BigEndian.PutUint16(pix[2:], g)
+			binary.BigEndian.PutUint16(pix[4:], b)
+			binary.BigEndian.PutUint16(pix[6:], a)
+		}
+
+		img = nrgba
+
+	default:
+		nrgba := image.NewNRGBA(bounds)
+		set = func(i int, r, g, b, a uint16) {
+			pix := nrgba.Pix[i*4 : i*4+4]
+			pix[0], pix[1], pix[2], pix[3] = uint8(r>>8), uint8(g>>8), uint8(b>>8), uint8(a>>8)
+		}
+
+		img = nrgba
+	}
+
+	width := bounds.Dx()
+	samples := make([]uint16, channels)
+
+	for y, row := range rows {
+		for x := 0; x < width; x++ {
+			for c := range samples {
+				samples[c] = readSample(row, x*channels+c, bitDepth)
+			}
+
+			var r, g, b, a uint16
+
+			// The tRNS comparison is against the raw (unscaled) samples.
+			a = 0xffff
+
+			switch ihdr.ColorType {
+			case ColorTypeGrayscale:
+				if trns != nil && samples[0] == trns.Gray {
+					a = 0
+				}
+
+				r = scaleSample(samples[0], bitDepth)
+				g, b = r, r
+
+			case ColorTypeGrayscaleAlpha:
+				r = scaleSample(samples[0], bitDepth)
+				g, b = r, r
+				a = scaleSample(samples[1], bitDepth)
+
+			case ColorTypeRgb:
+				if trns != nil && samples[0] == trns.Red && samples[1] == trns.Green && samples[2] == trns.Blue {
+					a = 0
+				}
+
+				r = scaleSample(samples[0], bitDepth)
+				g = scaleSample(samples[1], bitDepth)
+				b = scaleSample(samples[2], bitDepth)
+
+			case ColorTypeRgba:
+				r = scaleSample(samples[0], bitDepth)
+				g = scaleSample(samples[1], bitDepth)
+				b = scaleSample(samples[2], bitDepth)
+				a = scaleSample(samples[3], bitDepth)
+
+			default:
+				log.Panicf("color-type not valid: (%d)", ihdr.ColorType)
+			}
+
+			set(y*width+x, r, g, b, a)
+		}
+	}
+
+	return img, nil
+}
@@ -0,0 +1,409 @@
+package pngstructure
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"compress/flate"
+	"compress/zlib"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// Filter types, as stored at the start of each scanline.
+const (
+	FilterTypeNone    = uint8(0)
+	FilterTypeSub     = uint8(1)
+	FilterTypeUp      = uint8(2)
+	FilterTypeAverage = uint8(3)
+	FilterTypePaeth   = uint8(4)
+)
+
+var (
+	// channelCounts is the number of samples per pixel for each color-type.
+	channelCounts = map[uint8]int{
+		ColorTypeGrayscale:      1,
+		ColorTypeRgb:            3,
+		ColorTypeIndexed:        1,
+		ColorTypeGrayscaleAlpha: 2,
+		ColorTypeRgba:           4,
+	}
+)
+
+// BitsPerPixel returns the number of bits that each pixel takes in the image
+// data.
+func (ihdr *ChunkIHDR) BitsPerPixel() int {
+	return channelCounts[ihdr.ColorType] * int(ihdr.BitDepth)
+}
+
+// validate checks the fields that the layout of the image data depends on.
+func (ihdr *ChunkIHDR) validate() error {
+	if isValidBitDepth(ihdr.ColorType, ihdr.BitDepth) != true {
+		return log.Errorf("IHDR color-type (%d) and bit-depth (%d) not valid", ihdr.ColorType, ihdr.BitDepth)
+	} else if ihdr.InterlaceMethod != InterlaceMethodNone && ihdr.InterlaceMethod != InterlaceMethodAdam7 {
+		return log.Errorf("IHDR interlace-method not valid: (%d)", ihdr.InterlaceMethod)
+	}
+
+	return nil
+}
+
+// Stride returns the number of bytes in an (unfiltered) scanline of the given
+// width, not including the filter-type byte.
+func (ihdr *ChunkIHDR) Stride(width int) int {
+	return (width*ihdr.BitsPerPixel() + 7) / 8
+}
+
+// filterBytesPerPixel is the distance to the corresponding byte of the
+// previous pixel, as used by the filters. It is never less than one.
+func (ihdr *ChunkIHDR) filterBytesPerPixel() int {
+	return (ihdr.BitsPerPixel() + 7) / 8
+}
+
+// ImageData returns a reader of the inflated data of all of the IDAT chunks.
+// This is still filtered (and, possibly, interlaced). No more is inflated than
+// the IHDR describes; if there is more, reading past it fails with
+// `ErrImageDataTooLarge`. The caller must close it.
+func (cs *ChunkSlice) ImageData() (rc io.ReadCloser, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	ihdr, err := cs.decodeIhdr()
+	log.PanicIf(err)
+
+	readers := make([]io.Reader, 0)
+	for _, c := range cs.chunks {
+		if c.Type == IDATChunkType {
+			readers = append(readers, c.payloadReader())
+		}
+	}
+
+	if len(readers) == 0 {
+		log.Panicf("no IDAT chunks")
+	}
+
+	zr, err := zlib.NewReader(io.MultiReader(readers...))
+	log.PanicIf(err)
+
+	size := ihdr.imageDataSize()
+
+	rc = &imageDataReader{
+		zr:        zr,
+		size:      size,
+		remaining: size,
+	}
+
+	return rc, nil
+}
+
+// RechunkImageData merges all of the IDAT chunks and splits them again into
+// chunks of at most `maxSize` bytes, in the place of the first one. The
+// compressed stream can be split anywhere, so it is not inflated.
+func (cs *ChunkSlice) RechunkImageData(maxSize int) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if maxSize <= 0 || maxSize > MaxChunkLength {
+		log.Panicf("IDAT chunk size not valid: (%d)", maxSize)
+	}
+
+	b := new(bytes.Buffer)
+	for _, c := range cs.chunks {
+		if c.Type == IDATChunkType {
+			_, err := io.Copy(b, c.payloadReader())
+			log.PanicIf(err)
+		}
+	}
+
+	if b.Len() == 0 {
+		log.Panicf("no IDAT data")
+	}
+
+	cs.replaceIdat(splitIdat(b.Bytes(), maxSize))
+
+	return nil
+}
+
+// Scanline is one unfiltered row of image data.
+type Scanline struct {
+	// Row is the index of the row.
+	Row int
+
+	// FilterType is the filter that the row was stored with.
+	FilterType uint8
+
+	// Data is the unfiltered row, with the samples packed as in the image
+	// data.
+	Data []byte
+}
+
+func (s *Scanline) String() string {
+	return fmt.Sprintf("Scanline<ROW=(%d) FILTER=(%d) LEN=(%d)>", s.Row, s.FilterType, len(s.Data))
+}
+
+// ScanlineReader reads and unfilters consecutive scanlines from filtered image
+// data.
+type ScanlineReader struct {
+	r             io.Reader
+	height        int
+	stride        int
+	bytesPerPixel int
+
+	row      int
+	previous []byte
+}
+
+// NewScanlineReader returns a reader for an image (or interlace pass) of the
+// given dimensions whose pixels are laid out as described by the IHDR.
+func NewScanlineReader(r io.Reader, ihdr *ChunkIHDR, width, height int) *ScanlineReader {
+	stride := ihdr.Stride(width)
+
+	return &ScanlineReader{
+		r:             r,
+		height:        height,
+		stride:        stride,
+		bytesPerPixel: ihdr.filterBytesPerPixel(),
+		previous:      make([]byte, stride),
+	}
+}
+
+// Next returns the next scanline or `io.EOF` after the last one.
+func (sr *ScanlineReader) Next() (scanline *Scanline, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if sr.row >= sr.height {
+		return nil, io.EOF
+	}
+
+	raw := make([]byte, 1+sr.stride)
+
+	_, err = io.ReadFull(sr.r, raw)
+	if err == io.EOF {
+		log.Panic(io.ErrUnexpectedEOF)
+	}
+
+	log.PanicIf(err)
+
+	filterType := raw[0]
+	current := raw[1:]
+
+	err = unfilterScanline(filterType, current, sr.previous, sr.bytesPerPixel)
+	log.PanicIf(err)
+
+	scanline = &Scanline{
+		Row:        sr.row,
+		FilterType: filterType,
+		Data:       current,
+	}
+
+	sr.previous = current
+	sr.row++
+
+	return scanline, nil
+}
+
+// Close closes the underlying reader if it can be closed.
+func (sr *ScanlineReader) Close() error {
+	if closer, ok := sr.r.(io.Closer); ok == true {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// unfilterScanline reverses the filter in place. `previous` is the unfiltered
+// prior row (all zeros for the first row).
+func unfilterScanline(filterType uint8, current, previous []byte, bytesPerPixel int) error {
+	switch filterType {
+	case FilterTypeNone:
+
+	case FilterTypeSub:
+		for i := bytesPerPixel; i < len(current); i++ {
+			current[i] += current[i-bytesPerPixel]
+		}
+
+	case FilterTypeUp:
+		for i := range current {
+			current[i] += previous[i]
+		}
+
+	case FilterTypeAverage:
+		for i := range current {
+			left := 0
+			if i >= bytesPerPixel {
+				left = int(current[i-bytesPerPixel])
+			}
+
+			current[i] += uint8((left + int(previous[i])) / 2)
+		}
+
+	case FilterTypePaeth:
+		for i := range current {
+			var left, upperLeft uint8
+			if i >= bytesPerPixel {
+				left = current[i-bytesPerPixel]
+				upperLeft = previous[i-bytesPerPixel]
+			}
+
+			current[i] += paethPredictor(left, previous[i], upperLeft)
+		}
+
+	default:
+		return log.Errorf("filter-type not valid: (%d)", filterType)
+	}
+
+	return nil
+}
+
+// filterScanline applies the filter to `current` and writes the result to
+// `filtered`, which must be the same length. `previous` is the unfiltered
+// prior row (all zeros for the first row).
+func filterScanline(filterType uint8, filtered, current, previous []byte, bytesPerPixel int) error {
+	for i := range current {
+		var left, upperLeft uint8
+		if i >= bytesPerPixel {
+			left = current[i-bytesPerPixel]
+			upperLeft = previous[i-bytesPerPixel]
+		}
+
+		switch filterType {
+		case FilterTypeNone:
+			filtered[i] = current[i]
+		case FilterTypeSub:
+			filtered[i] = current[i] - left
+		case FilterTypeUp:
+			filtered[i] = current[i] - previous[i]
+		case FilterTypeAverage:
+			filtered[i] = current[i] - uint8((int(left)+int(previous[i]))/2)
+		case FilterTypePaeth:
+			filtered[i] = current[i] - paethPredictor(left, previous[i], upperLeft)
+		default:
+			return log.Errorf("filter-type not valid: (%d)", filterType)
+		}
+	}
+
+	return nil
+}
+
+// filterScanlineAdaptive filters the row with whichever filter gives the
+// smallest sum of absolute (signed) differences, the heuristic recommended by
+// the specification. Returns the filter-type followed by the filtered row.
+func filterScanlineAdaptive(current, previous []byte, bytesPerPixel int) []byte {
+	best := make([]byte, 1+len(current))
+	candidate := make([]byte, 1+len(current))
+	bestSum := -1
+
+	for filterType := FilterTypeNone; filterType <= FilterTypePaeth; filterType++ {
+		candidate[0] = filterType
+
+		// The filter-type is always valid.
+		filterScanline(filterType, candidate[1:], current, previous, bytesPerPixel)
+
+		sum := 0
+		for _, value := range candidate[1:] {
+			sum += abs(int(int8(value)))
+		}
+
+		if bestSum == -1 || sum < bestSum {
+			best, candidate = candidate, best
+			bestSum = sum
+		}
+	}
+
+	return best
+}
+
+// filterScanlineBruteForce filters the row with whichever filter compresses
+// the row (on its own) the smallest. This is much slower than the adaptive
+// heuristic but sometimes better. Returns the filter-type followed by the
+// filtered row.
+func filterScanlineBruteForce(current, previous []byte, bytesPerPixel int) []byte {
+	var best []byte
+	bestSize := -1
+
+	b := new(bytes.Buffer)
+	fw, _ := flate.NewWriter(b, flate.BestCompression)
+
+	for filterType := FilterTypeNone; filterType <= FilterTypePaeth; filterType++ {
+		candidate := make([]byte, 1+len(current))
+		candidate[0] = filterType
+
+		// The filter-type is always valid.
+		filterScanline(filterType, candidate[1:], current, previous, bytesPerPixel)
+
+		b.Reset()
+		fw.Reset(b)
+
+		// Writes to a buffer don't fail.
+		fw.Write(candidate)
+		fw.Close()
+
+		if bestSize == -1 || b.Len() < bestSize {
+			best = candidate
+			bestSize = b.Len()
+		}
+	}
+
+	return best
+}
+
+// paethPredictor returns whichever of the neighbors is closest to the linear
+// estimate.
+func paethPredictor(a, b, c uint8) uint8 {
+	p := int(a) + int(b) - int(c)
+
+	pa := abs(p - int(a))
+	pb := abs(p - int(b))
+	pc := abs(p - int(c))
+
+	if pa <= pb && pa <= pc {
+		return a
+	} else if pb <= pc {
+		return b
+	}
+
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
+
+// Scanlines returns a reader of the unfiltered scanlines of a non-interlaced
+// image. The caller must close it. Interlaced images are read with
+// `Adam7SubImages` or `PixelRows`.
+func (cs *ChunkSlice) Scanlines() (sr *ScanlineReader, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	ihdr, err := cs.decodeIhdr()
+	log.PanicIf(err)
+
+	if ihdr.InterlaceMethod != InterlaceMethodNone {
+		log.Panicf("image is interlaced")
+	}
+
+	rc, err := cs.ImageData()
+	log.PanicIf(err)
+
+	sr = NewScanlineReader(rc, ihdr, int(ihdr.Width), int(ihdr.Height))
+
+	return sr, nil
+}
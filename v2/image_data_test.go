@@ -0,0 +1,344 @@
+package pngstructure
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"image/color"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func getTestGradientImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{
+				R: uint8(x * 7),
+				G: uint8(y * 13),
+				B: uint8((x * y) % 251),
+				A: uint8(255 - x),
+			}
+
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func TestChunkIHDR_Stride(t *testing.T) {
+	cases := []struct {
+		ihdr   ChunkIHDR
+		width  int
+		stride int
+	}{
+		{ChunkIHDR{ColorType: ColorTypeRgba, BitDepth: 8}, 10, 40},
+		{ChunkIHDR{ColorType: ColorTypeRgb, BitDepth: 16}, 10, 60},
+		{ChunkIHDR{ColorType: ColorTypeGrayscale, BitDepth: 1}, 10, 2},
+		{ChunkIHDR{ColorType: ColorTypeIndexed, BitDepth: 4}, 3, 2},
+		{ChunkIHDR{ColorType: ColorTypeGrayscaleAlpha, BitDepth: 8}, 3, 6},
+	}
+
+	for _, tc := range cases {
+		if stride := tc.ihdr.Stride(tc.width); stride != tc.stride {
+			t.Fatalf("stride not correct for %s: (%d) != (%d)", &tc.ihdr, stride, tc.stride)
+		}
+	}
+}
+
+func TestChunkSlice_ImageData(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestGradientImage(20, 10))
+
+	rc, err := cs.ImageData()
+	log.PanicIf(err)
+
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(rc)
+	log.PanicIf(err)
+
+	// Each row has a filter-type byte.
+	if len(data) != 10*(1+20*4) {
+		t.Fatalf("inflated size not correct: (%d)", len(data))
+	}
+}
+
+func TestChunkSlice_RechunkImageData(t *testing.T) {
+	img := getTestGradientImage(40, 30)
+	cs := getTestImageChunkSlice(img)
+
+	original := make([]byte, 0)
+	for _, c := range cs.Index()[IDATChunkType] {
+		original = append(original, c.Data...)
+	}
+
+	err := cs.RechunkImageData(100)
+	log.PanicIf(err)
+
+	idats := cs.Index()[IDATChunkType]
+	if len(idats) != (len(original)+99)/100 {
+		t.Fatalf("IDAT count not correct: (%d)", len(idats))
+	}
+
+	rechunked := make([]byte, 0)
+	for _, c := range idats {
+		if len(c.Data) > 100 || int(c.Length) != len(c.Data) {
+			t.Fatalf("IDAT length not correct: %s", c)
+		} else if c.CheckCrc32() != true {
+			t.Fatalf("IDAT CRC not correct: %s", c)
+		}
+
+		rechunked = append(rechunked, c.Data...)
+	}
+
+	if bytes.Equal(rechunked, original) != true {
+		t.Fatalf("IDAT data changed")
+	}
+
+	// They must still be contiguous and before IEND.
+	chunks := cs.Chunks()
+	first := len(chunks) - 1 - len(idats)
+	for i, c := range chunks[first : len(chunks)-1] {
+		if c.Type != IDATChunkType {
+			t.Fatalf("chunk (%d) not an IDAT: %s", first+i, c)
+		}
+	}
+
+	assertTestImagesEqual(t, decodeTestChunkSlice(cs), img)
+
+	// And merge them again.
+	err = cs.RechunkImageData(MaxChunkLength)
+	log.PanicIf(err)
+
+	idats = cs.Index()[IDATChunkType]
+	if len(idats) != 1 || bytes.Equal(idats[0].Data, original) != true {
+		t.Fatalf("IDATs not merged")
+	}
+
+	assertTestImagesEqual(t, decodeTestChunkSlice(cs), img)
+}
+
+func TestChunkSlice_RechunkImageData_InvalidSize(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestGradientImage(4, 4))
+
+	for _, size := range []int{0, -1, MaxChunkLength + 1} {
+		if err := cs.RechunkImageData(size); err == nil {
+			t.Fatalf("expected error for size (%d)", size)
+		}
+	}
+}
+
+func TestChunkSlice_Scanlines(t *testing.T) {
+	img := getTestGradientImage(40, 30)
+	cs := getTestImageChunkSlice(img)
+
+	sr, err := cs.Scanlines()
+	log.PanicIf(err)
+
+	defer sr.Close()
+
+	for y := 0; ; y++ {
+		scanline, err := sr.Next()
+		if err == io.EOF {
+			if y != 30 {
+				t.Fatalf("row count not correct: (%d)", y)
+			}
+
+			break
+		}
+
+		log.PanicIf(err)
+
+		if scanline.Row != y {
+			t.Fatalf("row not correct: (%d) != (%d)", scanline.Row, y)
+		}
+
+		expected := img.Pix[y*img.Stride : y*img.Stride+40*4]
+		if string(scanline.Data) != string(expected) {
+			t.Fatalf("row (%d) not unfiltered correctly (filter-type %d)", y, scanline.FilterType)
+		}
+	}
+}
+
+func TestChunkSlice_Scanlines_Rgb(t *testing.T) {
+	filepath := path.Join(assetsPath, "Selection_058.png")
+
+	pmp := NewPngMediaParser()
+
+	intfc, err := pmp.ParseFile(filepath)
+	log.PanicIf(err)
+
+	cs := intfc.(*ChunkSlice)
+	img := decodeTestChunkSlice(cs)
+
+	sr, err := cs.Scanlines()
+	log.PanicIf(err)
+
+	defer sr.Close()
+
+	for {
+		scanline, err := sr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		y := scanline.Row
+		for x := 0; x < img.Bounds().Dx(); x += 97 {
+			r, g, b, _ := img.At(x, y).RGBA()
+			actual := scanline.Data[x*3 : x*3+3]
+
+			if actual[0] != uint8(r>>8) || actual[1] != uint8(g>>8) || actual[2] != uint8(b>>8) {
+				t.Fatalf("pixel (%d, %d) not correct", x, y)
+			}
+		}
+	}
+}
+
+func TestChunkSlice_Scanlines_Interlaced(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	_, err := cs.Scanlines()
+	if err == nil {
+		t.Fatalf("expected error for interlaced image")
+	}
+}
+
+func TestChunkSlice_Scanlines_InvalidIhdr(t *testing.T) {
+	invalid := []*ChunkIHDR{
+		{Width: 40, Height: 30, ColorType: ColorTypeRgba, BitDepth: 4},
+		{Width: 40, Height: 30, ColorType: 5, BitDepth: 8},
+		{Width: 40, Height: 30, ColorType: ColorTypeRgba, BitDepth: 8, InterlaceMethod: 2},
+	}
+
+	ce := NewChunkEncoder()
+
+	for i, ihdr := range invalid {
+		cs := getTestImageChunkSlice(getTestGradientImage(40, 30))
+
+		c, err := ce.Encode(ihdr)
+		log.PanicIf(err)
+
+		cs.chunks[0] = c
+
+		_, err = cs.Scanlines()
+		if err == nil {
+			t.Fatalf("expected error for invalid IHDR (%d)", i)
+		}
+
+		_, _, err = cs.PixelRows()
+		if err == nil {
+			t.Fatalf("expected error from PixelRows for invalid IHDR (%d)", i)
+		}
+	}
+}
+
+func TestScanlineReader_Next_Truncated(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestGradientImage(4, 3))
+
+	rc, err := cs.ImageData()
+	log.PanicIf(err)
+
+	data, err := ioutil.ReadAll(rc)
+	log.PanicIf(err)
+
+	ihdr := &ChunkIHDR{ColorType: ColorTypeRgba, BitDepth: 8}
+
+	// Claim an extra row.
+	sr := NewScanlineReader(bytes.NewReader(data), ihdr, 4, 4)
+
+	for i := 0; i < 3; i++ {
+		_, err := sr.Next()
+		log.PanicIf(err)
+	}
+
+	_, err = sr.Next()
+	if err == nil || err == io.EOF {
+		t.Fatalf("expected error for truncated data: %v", err)
+	}
+}
+
+func TestUnfilterScanline(t *testing.T) {
+	previous := []byte{10, 20, 30, 40}
+
+	cases := []struct {
+		filterType uint8
+		filtered   []byte
+		expected   []byte
+	}{
+		{FilterTypeNone, []byte{1, 2, 3, 4}, []byte{1, 2, 3, 4}},
+		{FilterTypeSub, []byte{1, 2, 3, 4}, []byte{1, 2, 4, 6}},
+		{FilterTypeUp, []byte{1, 2, 3, 4}, []byte{11, 22, 33, 44}},
+		{FilterTypeAverage, []byte{1, 2, 3, 4}, []byte{6, 12, 3 + (6+30)/2, 4 + (12+40)/2}},
+		{FilterTypePaeth, []byte{1, 2, 3, 4}, []byte{11, 22, 3 + 30, 4 + 40}},
+	}
+
+	for _, tc := range cases {
+		current := append([]byte{}, tc.filtered...)
+
+		err := unfilterScanline(tc.filterType, current, previous, 2)
+		log.PanicIf(err)
+
+		if string(current) != string(tc.expected) {
+			t.Fatalf("filter-type (%d) not reversed correctly: %v != %v", tc.filterType, current, tc.expected)
+		}
+	}
+
+	err := unfilterScanline(5, []byte{0}, []byte{0}, 1)
+	if err == nil {
+		t.Fatalf("expected error for filter-type")
+	}
+}
+
+func ExampleChunkSlice_Scanlines() {
+	cs := getTestImageChunkSlice(getTestGradientImage(4, 3))
+
+	sr, err := cs.Scanlines()
+	log.PanicIf(err)
+
+	defer sr.Close()
+
+	for {
+		scanline, err := sr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		fmt.Printf("row (%d): %d bytes\n", scanline.Row, len(scanline.Data))
+	}
+
+	// Output:
+	// row (0): 16 bytes
+	// row (1): 16 bytes
+	// row (2): 16 bytes
+}
+
+func ExampleChunkSlice_RechunkImageData() {
+	cs := getTestImageChunkSlice(getTestGradientImage(40, 30))
+
+	err := cs.RechunkImageData(256)
+	log.PanicIf(err)
+
+	idats := cs.Index()[IDATChunkType]
+
+	fits := true
+	for _, c := range idats {
+		if c.Length > 256 {
+			fits = false
+		}
+	}
+
+	fmt.Printf("split: %v fits: %v\n", len(idats) > 1, fits)
+
+	// Output:
+	// split: true fits: true
+}
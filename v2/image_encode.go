@@ -0,0 +1,509 @@
+package pngstructure
+
+import (
+	"bytes"
+	"image"
+
+	"compress/zlib"
+	"encoding/binary"
+	"image/color"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// FilterStrategy determines how the filter-type of each scanline is chosen
+// when encoding.
+type FilterStrategy int
+
+const (
+	// FilterStrategyAdaptive picks, per row, the filter with the smallest
+	// sum of absolute differences (the heuristic recommended by the
+	// specification and used by libpng).
+	FilterStrategyAdaptive FilterStrategy = iota
+
+	// The fixed strategies use the same filter for every row.
+	FilterStrategyNone
+	FilterStrategySub
+	FilterStrategyUp
+	FilterStrategyAverage
+	FilterStrategyPaeth
+
+	// FilterStrategyBruteForce picks, per row, the filter that compresses
+	// the row the smallest. It is much slower.
+	FilterStrategyBruteForce
+)
+
+const (
+	// defaultIdatChunkSize is the most image data that we put in one IDAT
+	// chunk (the same as libpng).
+	defaultIdatChunkSize = 8192
+)
+
+var (
+	// fixedFilterTypes are the filter-types of the fixed strategies.
+	fixedFilterTypes = map[FilterStrategy]uint8{
+		FilterStrategyNone:    FilterTypeNone,
+		FilterStrategySub:     FilterTypeSub,
+		FilterStrategyUp:      FilterTypeUp,
+		FilterStrategyAverage: FilterTypeAverage,
+		FilterStrategyPaeth:   FilterTypePaeth,
+	}
+
+	// colorSpaceChunkTypes are unsafe-to-copy chunks that we know remain
+	// valid when the pixels change, since they only describe how to interpret
+	// the colors.
+	colorSpaceChunkTypes = map[string]bool{
+		GAMAChunkType: true,
+		CHRMChunkType: true,
+		SRGBChunkType: true,
+		ICCPChunkType: true,
+		CICPChunkType: true,
+		MDCVChunkType: true,
+		CLLIChunkType: true,
+	}
+
+	// colorModelChunkTypes are the color-space chunks that are written for
+	// either a grayscale or a color image (e.g. an ICC profile of one can't
+	// be used with the other), so they don't survive a change between the
+	// two.
+	colorModelChunkTypes = map[string]bool{
+		CHRMChunkType: true,
+		ICCPChunkType: true,
+		CICPChunkType: true,
+	}
+)
+
+// isGrayColorType returns true for the grayscale color-types.
+func isGrayColorType(colorType uint8) bool {
+	return colorType == ColorTypeGrayscale || colorType == ColorTypeGrayscaleAlpha
+}
+
+// ImageEncodingOptions controls how pixels are encoded into IDAT chunks.
+type ImageEncodingOptions struct {
+	// CompressionLevel is a `compress/zlib` level. Unless
+	// `IsCompressionLevelSet` is true, zero means the default (best
+	// compression) rather than `zlib.NoCompression`.
+	CompressionLevel int
+
+	// IsCompressionLevelSet means that `CompressionLevel` is used as given,
+	// even if it is zero.
+	IsCompressionLevelSet bool
+
+	FilterStrategy FilterStrategy
+
+	// IdatChunkSize is the most compressed data to put into one IDAT chunk.
+	// Zero means the default.
+	IdatChunkSize int
+}
+
+// DefaultImageEncodingOptions returns the options that are used when none are
+// given: best compression, adaptive filtering and 8K IDAT chunks.
+func DefaultImageEncodingOptions() *ImageEncodingOptions {
+	return &ImageEncodingOptions{
+		CompressionLevel:      zlib.BestCompression,
+		IsCompressionLevelSet: true,
+		FilterStrategy:        FilterStrategyAdaptive,
+		IdatChunkSize:         defaultIdatChunkSize,
+	}
+}
+
+// IsSafeToCopy returns true if the chunk's type says that it may be copied
+// into a file whose image data has changed without understanding it.
+func (c *Chunk) IsSafeToCopy() bool {
+	return len(c.Type) == 4 && c.Type[3]&0x20 != 0
+}
+
+// IsCritical returns true if the chunk's type says that it is critical.
+func (c *Chunk) IsCritical() bool {
+	return len(c.Type) == 4 && c.Type[0]&0x20 == 0
+}
+
+// filterRows filters consecutive rows (of one image or pass) and appends them
+// to the buffer.
+func filterRows(b *bytes.Buffer, ihdr *ChunkIHDR, rows [][]byte, strategy FilterStrategy) (err error) {
+	bytesPerPixel := ihdr.filterBytesPerPixel()
+
+	var previous []byte
+	for _, row := range rows {
+		if previous == nil {
+			previous = make([]byte, len(row))
+		}
+
+		if strategy == FilterStrategyAdaptive {
+			b.Write(filterScanlineAdaptive(row, previous, bytesPerPixel))
+		} else if strategy == FilterStrategyBruteForce {
+			b.Write(filterScanlineBruteForce(row, previous, bytesPerPixel))
+		} else {
+			filterType, found := fixedFilterTypes[strategy]
+			if found == false {
+				return log.Errorf("filter strategy not valid: (%d)", strategy)
+			}
+
+			filtered := make([]byte, 1+len(row))
+			filtered[0] = filterType
+
+			err := filterScanline(filterType, filtered[1:], row, previous, bytesPerPixel)
+			if err != nil {
+				return err
+			}
+
+			b.Write(filtered)
+		}
+
+		previous = row
+	}
+
+	return nil
+}
+
+// encodeImageData filters (and, if the IHDR says to, interlaces) the rows and
+// returns the uncompressed image data.
+func encodeImageData(ihdr *ChunkIHDR, rows [][]byte, strategy FilterStrategy) (data []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	b := new(bytes.Buffer)
+
+	switch ihdr.InterlaceMethod {
+	case InterlaceMethodNone:
+		err := filterRows(b, ihdr, rows, strategy)
+		log.PanicIf(err)
+
+	case InterlaceMethodAdam7:
+		for _, passRows := range interlace(ihdr, rows) {
+			err := filterRows(b, ihdr, passRows, strategy)
+			log.PanicIf(err)
+		}
+
+	default:
+		log.Panicf("interlace-method not valid: (%d)", ihdr.InterlaceMethod)
+	}
+
+	return b.Bytes(), nil
+}
+
+// splitIdat divides compressed image data into IDAT chunks of at most the
+// given size.
+func splitIdat(deflated []byte, chunkSize int) (idats []*Chunk) {
+	idats = make([]*Chunk, 0)
+	for len(deflated) > 0 {
+		size := chunkSize
+		if size > len(deflated) {
+			size = len(deflated)
+		}
+
+		idats = append(idats, NewChunk(IDATChunkType, deflated[:size]))
+		deflated = deflated[size:]
+	}
+
+	return idats
+}
+
+// replaceIdat replaces the IDAT chunks. The new ones take the place of the
+// old ones or, if there weren't any, go before IEND (which is added if
+// missing).
+func (cs *ChunkSlice) replaceIdat(idats []*Chunk) {
+	i := cs.removeChunks(func(c *Chunk) bool {
+		return c.Type == IDATChunkType
+	})
+
+	if i == -1 {
+		last := cs.chunks[len(cs.chunks)-1]
+		if last.Type != IENDChunkType {
+			cs.chunks = append(cs.chunks, NewChunk(IENDChunkType, nil))
+		}
+
+		i = len(cs.chunks) - 1
+	}
+
+	cs.chunks = append(cs.chunks[:i], append(idats, cs.chunks[i:]...)...)
+}
+
+// encodeImageChunks returns the IHDR and IDAT chunks for the given image. If
+// `options` is nil, the defaults are used.
+func encodeImageChunks(ihdr *ChunkIHDR, rows [][]byte, options *ImageEncodingOptions) (ihdrChunk *Chunk, idats []*Chunk, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if options == nil {
+		options = DefaultImageEncodingOptions()
+	}
+
+	chunkSize := options.IdatChunkSize
+	if chunkSize == 0 {
+		chunkSize = defaultIdatChunkSize
+	} else if chunkSize < 0 {
+		log.Panicf("IDAT chunk size not valid: (%d)", chunkSize)
+	}
+
+	level := options.CompressionLevel
+	if level == 0 && options.IsCompressionLevelSet == false {
+		level = zlib.BestCompression
+	}
+
+	data, err := encodeImageData(ihdr, rows, options.FilterStrategy)
+	log.PanicIf(err)
+
+	deflated, err := deflateLevel(data, level)
+	log.PanicIf(err)
+
+	ce := NewChunkEncoder()
+
+	ihdrChunk, err = ce.Encode(ihdr)
+	log.PanicIf(err)
+
+	return ihdrChunk, splitIdat(deflated, chunkSize), nil
+}
+
+// setImageData replaces the IHDR and the IDAT chunks with the given image.
+// If `options` is nil, the defaults are used.
+func (cs *ChunkSlice) setImageData(ihdr *ChunkIHDR, rows [][]byte, options *ImageEncodingOptions) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	ihdrChunk, idats, err := encodeImageChunks(ihdr, rows, options)
+	log.PanicIf(err)
+
+	cs.chunks[0] = ihdrChunk
+	cs.replaceIdat(idats)
+
+	return nil
+}
+
+// opaque returns true if every pixel of the image is opaque.
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok == true {
+		return o.Opaque()
+	}
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// encodePixels chooses the encoding for the image the same way that
+// `image/png` does and returns the IHDR, the packed rows, and the PLTE and
+// tRNS chunks (if required).
+func encodePixels(img image.Image) (ihdr *ChunkIHDR, rows [][]byte, plte, trns interface{}) {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	ihdr = &ChunkIHDR{
+		Width:  uint32(width),
+		Height: uint32(height),
+	}
+
+	var pixel func(row []byte, x int, c color.Color)
+
+	switch t := img.(type) {
+	case *image.Paletted:
+		ihdr.ColorType = ColorTypeIndexed
+
+		switch {
+		case len(t.Palette) <= 2:
+			ihdr.BitDepth = 1
+		case len(t.Palette) <= 4:
+			ihdr.BitDepth = 2
+		case len(t.Palette) <= 16:
+			ihdr.BitDepth = 4
+		default:
+			ihdr.BitDepth = 8
+		}
+
+		palette := make(color.Palette, len(t.Palette))
+		alphas := make([]uint8, len(t.Palette))
+		lastTranslucent := -1
+
+		for i, c := range t.Palette {
+			nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+			palette[i] = color.RGBA{nrgba.R, nrgba.G, nrgba.B, 0xff}
+			alphas[i] = nrgba.A
+
+			if nrgba.A != 0xff {
+				lastTranslucent = i
+			}
+		}
+
+		plte = &ChunkPLTE{Palette: palette}
+
+		if lastTranslucent != -1 {
+			trns = &ChunkTRNS{
+				ColorType: ColorTypeIndexed,
+				Alphas:    alphas[:lastTranslucent+1],
+			}
+		}
+
+	case *image.Gray:
+		ihdr.ColorType = ColorTypeGrayscale
+		ihdr.BitDepth = 8
+
+		pixel = func(row []byte, x int, c color.Color) {
+			row[x] = color.GrayModel.Convert(c).(color.Gray).Y
+		}
+
+	case *image.Gray16:
+		ihdr.ColorType = ColorTypeGrayscale
+		ihdr.BitDepth = 16
+
+		pixel = func(row []byte, x int, c color.Color) {
+			binary.BigEndian.PutUint16(row[x*2:], color.Gray16Model.Convert(c).(color.Gray16).Y)
+		}
+
+	default:
+		isOpaque := opaque(img)
+
+		ihdr.ColorType = ColorTypeRgba
+		if isOpaque == true {
+			ihdr.ColorType = ColorTypeRgb
+		}
+
+		channels := channelCounts[ihdr.ColorType]
+
+		switch img.(type) {
+		case *image.RGBA64, *image.NRGBA64:
+			ihdr.BitDepth = 16
+
+			pixel = func(row []byte, x int, c color.Color) {
+				nrgba := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+				samples := []uint16{nrgba.R, nrgba.G, nrgba.B, nrgba.A}
+
+				for i := 0; i < channels; i++ {
+					binary.BigEndian.PutUint16(row[(x*channels+i)*2:], samples[i])
+				}
+			}
+
+		default:
+			ihdr.BitDepth = 8
+
+			pixel = func(row []byte, x int, c color.Color) {
+				nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+				copy(row[x*channels:x*channels+channels], []byte{nrgba.R, nrgba.G, nrgba.B, nrgba.A})
+			}
+		}
+	}
+
+	stride := ihdr.Stride(width)
+
+	rows = make([][]byte, height)
+	for y := range rows {
+		row := make([]byte, stride)
+
+		if paletted, ok := img.(*image.Paletted); ok == true {
+			for x := 0; x < width; x++ {
+				// Pack the index at the top of the byte, as the first pixel
+				// of a row would be.
+				index := paletted.ColorIndexAt(bounds.Min.X+x, bounds.Min.Y+y)
+				copyPixel(row, x, []byte{index << (8 - ihdr.BitDepth)}, 0, int(ihdr.BitDepth))
+			}
+		} else {
+			for x := 0; x < width; x++ {
+				pixel(row, x, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+			}
+		}
+
+		rows[y] = row
+	}
+
+	return ihdr, rows, plte, trns
+}
+
+// SetImage replaces the pixels with the given image. The IHDR and IDAT chunks
+// are rewritten, as are PLTE and tRNS (which are only written when the image
+// needs them). The interlace method is kept. Every critical and safe-to-copy
+// chunk is kept as-is, as are the color-space chunks (gAMA, cHRM, sRGB, iCCP,
+// cICP, mDCv and cLLi), except that cHRM, iCCP and cICP are dropped if the
+// image changes between grayscale and color. Every other chunk is unsafe to
+// copy (e.g. sBIT, bKGD, hIST, tIME, and the APNG chunks) and is dropped,
+// since it may no longer be correct. Nothing is changed if the image can't be
+// encoded. If `options` is nil, the defaults are used.
+func (cs *ChunkSlice) SetImage(img image.Image, options *ImageEncodingOptions) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	bounds := img.Bounds()
+	if bounds.Empty() == true {
+		log.Panicf("image is empty")
+	}
+
+	// The IHDR of a new chunk-slice might be blank.
+	var original *ChunkIHDR
+	if cs.chunks[0].Length > 0 {
+		original, err = cs.decodeIhdr()
+		log.PanicIf(err)
+	}
+
+	ihdr, rows, plte, trns := encodePixels(img)
+	if original != nil {
+		ihdr.InterlaceMethod = original.InterlaceMethod
+	}
+
+	// Encode everything before changing anything.
+
+	ihdrChunk, idats, err := encodeImageChunks(ihdr, rows, options)
+	log.PanicIf(err)
+
+	ce := NewChunkEncoder()
+
+	paletteChunks := make([]*Chunk, 0, 2)
+	for _, decoded := range []interface{}{plte, trns} {
+		if decoded == nil {
+			continue
+		}
+
+		c, err := ce.Encode(decoded)
+		log.PanicIf(err)
+
+		paletteChunks = append(paletteChunks, c)
+	}
+
+	isColorModelChanged := original != nil && isGrayColorType(original.ColorType) != isGrayColorType(ihdr.ColorType)
+
+	cs.removeChunks(func(c *Chunk) bool {
+		switch c.Type {
+		case IHDRChunkType, IDATChunkType, IENDChunkType:
+			return false
+		case PLTEChunkType, TRNSChunkType:
+			return true
+		}
+
+		if colorModelChunkTypes[c.Type] == true && isColorModelChanged == true {
+			return true
+		}
+
+		if c.IsCritical() == true || c.IsSafeToCopy() == true || colorSpaceChunkTypes[c.Type] == true {
+			return false
+		}
+
+		return true
+	})
+
+	cs.chunks[0] = ihdrChunk
+	cs.replaceIdat(idats)
+
+	// PLTE must come before tRNS.
+	for _, c := range paletteChunks {
+		cs.insertChunk(c, IDATChunkType)
+	}
+
+	return nil
+}
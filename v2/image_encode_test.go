@@ -0,0 +1,381 @@
+package pngstructure
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"testing"
+
+	"compress/zlib"
+	"image/color"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func TestChunk_IsSafeToCopy(t *testing.T) {
+	cases := map[string][2]bool{
+		"IHDR": {false, true},
+		"tEXt": {true, false},
+		"gAMA": {false, false},
+		"vpAg": {true, false},
+	}
+
+	for type_, expected := range cases {
+		c := &Chunk{Type: type_}
+
+		if c.IsSafeToCopy() != expected[0] || c.IsCritical() != expected[1] {
+			t.Fatalf("chunk [%s] properties not correct", type_)
+		}
+	}
+}
+
+func TestChunkSlice_SetImage(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	img := getTestGradientImage(30, 20)
+
+	err := cs.SetImage(img, nil)
+	log.PanicIf(err)
+
+	assertTestImagesEqual(t, decodeTestChunkSlice(cs), img)
+
+	ihdr, err := cs.decodeIhdr()
+	log.PanicIf(err)
+
+	if ihdr.Width != 30 || ihdr.Height != 20 {
+		t.Fatalf("IHDR not updated: %s", ihdr)
+	} else if ihdr.InterlaceMethod != InterlaceMethodAdam7 {
+		t.Fatalf("interlace-method not kept")
+	}
+
+	index := cs.Index()
+
+	kept := []string{EXifChunkType, TEXtChunkType, ZTXtChunkType, GAMAChunkType, CHRMChunkType, SRGBChunkType, PHYSChunkType, OFFSChunkType, "vpAg"}
+	for _, type_ := range kept {
+		if _, found := index[type_]; found == false {
+			t.Fatalf("chunk [%s] not kept", type_)
+		}
+	}
+
+	dropped := []string{SBITChunkType, BKGDChunkType, TIMEChunkType, PCALChunkType, SCALChunkType, "sTER"}
+	for _, type_ := range dropped {
+		if _, found := index[type_]; found == true {
+			t.Fatalf("chunk [%s] not dropped", type_)
+		}
+	}
+}
+
+func TestChunkSlice_SetImage_Paletted(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestGradientImage(4, 4))
+
+	img := getTestPalettedImage(10, 10)
+	img.Palette[2] = color.NRGBA{0, 0, 0xff, 0x40}
+
+	err := cs.SetImage(img, nil)
+	log.PanicIf(err)
+
+	assertTestImageMatchesStandard(t, cs)
+	assertTestImagesEqual(t, decodeTestChunkSlice(cs), img)
+
+	index := cs.Index()
+	if len(index[PLTEChunkType]) != 1 || len(index[TRNSChunkType]) != 1 {
+		t.Fatalf("PLTE and tRNS not written")
+	}
+
+	// Switching back to truecolor drops them.
+	err = cs.SetImage(getTestGradientImage(4, 4), nil)
+	log.PanicIf(err)
+
+	index = cs.Index()
+	if _, found := index[PLTEChunkType]; found == true {
+		t.Fatalf("PLTE not removed")
+	} else if _, found := index[TRNSChunkType]; found == true {
+		t.Fatalf("tRNS not removed")
+	}
+}
+
+func TestChunkSlice_SetImage_Types(t *testing.T) {
+	gray16 := image.NewGray16(image.Rect(0, 0, 5, 5))
+	for i := range gray16.Pix {
+		gray16.Pix[i] = uint8(i * 11)
+	}
+
+	opaque := image.NewRGBA(image.Rect(0, 0, 5, 5))
+	for i := range opaque.Pix {
+		opaque.Pix[i] = 0xff - uint8(i)
+		if i%4 == 3 {
+			opaque.Pix[i] = 0xff
+		}
+	}
+
+	expectedColorTypes := []uint8{ColorTypeGrayscale, ColorTypeRgb}
+
+	for i, img := range []image.Image{gray16, opaque} {
+		cs := getTestImageChunkSlice(getTestGradientImage(4, 4))
+
+		err := cs.SetImage(img, nil)
+		log.PanicIf(err)
+
+		ihdr, err := cs.decodeIhdr()
+		log.PanicIf(err)
+
+		if ihdr.ColorType != expectedColorTypes[i] {
+			t.Fatalf("color-type not correct: %s", ihdr)
+		}
+
+		assertTestImageMatchesStandard(t, cs)
+		assertTestImagesEqual(t, decodeTestChunkSlice(cs), img)
+	}
+}
+
+func TestChunkSlice_SetImage_ColorModelChanged(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestGradientImage(4, 4))
+
+	err := cs.SetIccProfile("Test profile", getTestIccProfile())
+	log.PanicIf(err)
+
+	ce := NewChunkEncoder()
+
+	for _, decoded := range []interface{}{&ChunkGAMA{Gamma: 0.45455}, &ChunkCHRM{WhitePointX: 0.3127, WhitePointY: 0.329, RedX: 0.64, RedY: 0.33, GreenX: 0.3, GreenY: 0.6, BlueX: 0.15, BlueY: 0.06}} {
+		c, err := ce.Encode(decoded)
+		log.PanicIf(err)
+
+		cs.insertChunk(c, IDATChunkType)
+	}
+
+	// Staying in color keeps them.
+	err = cs.SetImage(getTestGradientImage(5, 5), nil)
+	log.PanicIf(err)
+
+	index := cs.Index()
+	for _, type_ := range []string{ICCPChunkType, CHRMChunkType, GAMAChunkType} {
+		if _, found := index[type_]; found == false {
+			t.Fatalf("chunk [%s] not kept", type_)
+		}
+	}
+
+	err = cs.SetImage(image.NewGray(image.Rect(0, 0, 5, 5)), nil)
+	log.PanicIf(err)
+
+	index = cs.Index()
+	for _, type_ := range []string{ICCPChunkType, CHRMChunkType} {
+		if _, found := index[type_]; found == true {
+			t.Fatalf("chunk [%s] not dropped", type_)
+		}
+	}
+
+	if _, found := index[GAMAChunkType]; found == false {
+		t.Fatalf("gAMA not kept")
+	}
+}
+
+func TestChunkSlice_SetImage_NotEncodable(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	original := cs.Chunks()
+	originalChunks := make([]*Chunk, len(original))
+	copy(originalChunks, original)
+
+	palette := make(color.Palette, 300)
+	for i := range palette {
+		palette[i] = color.NRGBA{uint8(i), uint8(i >> 8), 0, 0xff}
+	}
+
+	paletted := image.NewPaletted(image.Rect(0, 0, 4, 4), palette)
+
+	options := DefaultImageEncodingOptions()
+	options.IdatChunkSize = -1
+
+	attempts := []struct {
+		img     image.Image
+		options *ImageEncodingOptions
+	}{
+		{paletted, nil},
+		{getTestGradientImage(4, 4), options},
+	}
+
+	for i, attempt := range attempts {
+		err := cs.SetImage(attempt.img, attempt.options)
+		if err == nil {
+			t.Fatalf("expected error (%d)", i)
+		}
+
+		chunks := cs.Chunks()
+		if len(chunks) != len(originalChunks) {
+			t.Fatalf("chunks changed (%d): (%d) != (%d)", i, len(chunks), len(originalChunks))
+		}
+
+		for j, c := range chunks {
+			if c != originalChunks[j] {
+				t.Fatalf("chunk (%d) changed (%d): %s", j, i, c)
+			}
+		}
+	}
+}
+
+func TestChunkSlice_SetImage_Options(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestGradientImage(4, 4))
+
+	options := DefaultImageEncodingOptions()
+	options.FilterStrategy = FilterStrategySub
+	options.IdatChunkSize = 100
+
+	img := getTestGradientImage(40, 40)
+
+	err := cs.SetImage(img, options)
+	log.PanicIf(err)
+
+	idats := cs.Index()[IDATChunkType]
+	if len(idats) < 2 {
+		t.Fatalf("IDAT not split")
+	}
+
+	for _, c := range idats {
+		if len(c.Data) > 100 {
+			t.Fatalf("IDAT too large: (%d)", len(c.Data))
+		}
+	}
+
+	sr, err := cs.Scanlines()
+	log.PanicIf(err)
+
+	defer sr.Close()
+
+	for {
+		scanline, err := sr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		if scanline.FilterType != FilterTypeSub {
+			t.Fatalf("row (%d) filter-type not correct: (%d)", scanline.Row, scanline.FilterType)
+		}
+	}
+
+	assertTestImagesEqual(t, decodeTestChunkSlice(cs), img)
+
+	options.FilterStrategy = FilterStrategy(99)
+
+	err = cs.SetImage(img, options)
+	if err == nil {
+		t.Fatalf("expected error for filter strategy")
+	}
+}
+
+func TestChunkSlice_SetImage_ZeroCompressionLevel(t *testing.T) {
+	img := getTestGradientImage(40, 40)
+
+	idatSize := func(options *ImageEncodingOptions) int {
+		cs := getTestImageChunkSlice(getTestGradientImage(4, 4))
+
+		err := cs.SetImage(img, options)
+		log.PanicIf(err)
+
+		size := 0
+		for _, c := range cs.Index()[IDATChunkType] {
+			size += len(c.Data)
+		}
+
+		return size
+	}
+
+	options := DefaultImageEncodingOptions()
+	options.IdatChunkSize = 100
+
+	// Only the chunk size is given, so the default level should be used
+	// rather than no compression.
+	actual := idatSize(&ImageEncodingOptions{IdatChunkSize: 100})
+	expected := idatSize(options)
+
+	if actual != expected {
+		t.Fatalf("zero compression-level not the default: (%d) != (%d)", actual, expected)
+	}
+}
+
+func TestChunkSlice_SetImage_NoCompression(t *testing.T) {
+	img := getTestGradientImage(40, 40)
+
+	cs := getTestImageChunkSlice(getTestGradientImage(4, 4))
+
+	options := DefaultImageEncodingOptions()
+	options.CompressionLevel = zlib.NoCompression
+
+	err := cs.SetImage(img, options)
+	log.PanicIf(err)
+
+	ihdr, rows, err := cs.PixelRows()
+	log.PanicIf(err)
+
+	// Stored deflate blocks are larger than the filtered rows.
+	rawSize := len(rows) * (ihdr.Stride(int(ihdr.Width)) + 1)
+
+	size := 0
+	for _, c := range cs.Index()[IDATChunkType] {
+		size += len(c.Data)
+	}
+
+	if size <= rawSize {
+		t.Fatalf("image data compressed: (%d) <= (%d)", size, rawSize)
+	}
+
+	assertTestImagesEqual(t, decodeTestChunkSlice(cs), img)
+}
+
+func TestChunkSlice_SetImage_BruteForce(t *testing.T) {
+	img := getTestGradientImage(30, 30)
+
+	options := DefaultImageEncodingOptions()
+	options.FilterStrategy = FilterStrategyBruteForce
+
+	bruteForce := getTestImageChunkSlice(img)
+
+	err := bruteForce.SetImage(img, options)
+	log.PanicIf(err)
+
+	assertTestImagesEqual(t, decodeTestChunkSlice(bruteForce), img)
+
+	options.FilterStrategy = FilterStrategyNone
+
+	none := getTestImageChunkSlice(img)
+
+	err = none.SetImage(img, options)
+	log.PanicIf(err)
+
+	if bruteForce.encodedSize() > none.encodedSize() {
+		t.Fatalf("brute force larger than no filtering: (%d) > (%d)", bruteForce.encodedSize(), none.encodedSize())
+	}
+}
+
+func TestChunkSlice_SetImage_New(t *testing.T) {
+	cs := NewPngChunkSlice()
+
+	img := getTestGradientImage(6, 6)
+
+	err := cs.SetImage(img, nil)
+	log.PanicIf(err)
+
+	assertTestImagesEqual(t, decodeTestChunkSlice(cs), img)
+}
+
+func ExampleChunkSlice_SetImage() {
+	pmp := NewPngMediaParser()
+
+	intfc, err := pmp.ParseFile(getTestExifImageFilepath())
+	log.PanicIf(err)
+
+	cs := intfc.(*ChunkSlice)
+
+	err = cs.SetImage(getTestGradientImage(30, 20), nil)
+	log.PanicIf(err)
+
+	img, err := cs.Image()
+	log.PanicIf(err)
+
+	_, _, err = cs.Exif()
+	fmt.Printf("%v EXIF-ERROR=[%v]\n", img.Bounds(), err)
+
+	// Output:
+	// (0,0)-(30,20) EXIF-ERROR=[<nil>]
+}
@@ -0,0 +1,155 @@
+package pngstructure
+
+import (
+	"fmt"
+	"image"
+	"path"
+	"reflect"
+	"testing"
+
+	"image/color"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// assertTestImageMatchesStandard checks that our decoding matches
+// `image/png`, including the concrete type.
+func assertTestImageMatchesStandard(t *testing.T, cs *ChunkSlice) {
+	expected := decodeTestChunkSlice(cs)
+
+	actual, err := cs.Image()
+	log.PanicIf(err)
+
+	if reflect.TypeOf(actual) != reflect.TypeOf(expected) {
+		t.Fatalf("image type not correct: [%v] != [%v]", reflect.TypeOf(actual), reflect.TypeOf(expected))
+	}
+
+	assertTestImagesEqual(t, actual, expected)
+}
+
+func TestChunkSlice_Image(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 9, 7))
+	gray16 := image.NewGray16(image.Rect(0, 0, 9, 7))
+	rgba64 := image.NewRGBA64(image.Rect(0, 0, 9, 7))
+	nrgba64 := image.NewNRGBA64(image.Rect(0, 0, 9, 7))
+
+	for y := 0; y < 7; y++ {
+		for x := 0; x < 9; x++ {
+			v := uint16(x*7001 + y*3001)
+
+			gray.SetGray(x, y, color.Gray{uint8(v >> 8)})
+			gray16.SetGray16(x, y, color.Gray16{v})
+			rgba64.SetRGBA64(x, y, color.RGBA64{v, v / 2, v / 3, 0xffff})
+			nrgba64.SetNRGBA64(x, y, color.NRGBA64{v, v / 2, v / 3, uint16(x * 1000)})
+		}
+	}
+
+	twoColors := getTestPalettedImage(11, 5)
+	twoColors.Palette = twoColors.Palette[:2]
+	for i := range twoColors.Pix {
+		twoColors.Pix[i] %= 2
+	}
+
+	images := []image.Image{
+		gray,
+		gray16,
+		rgba64,
+		nrgba64,
+		getTestGradientImage(9, 7),
+		getTestPalettedImage(9, 7),
+		twoColors,
+	}
+
+	for _, img := range images {
+		cs := getTestImageChunkSlice(img)
+		assertTestImageMatchesStandard(t, cs)
+
+		err := cs.SetInterlaceMethod(InterlaceMethodAdam7)
+		log.PanicIf(err)
+
+		assertTestImageMatchesStandard(t, cs)
+	}
+}
+
+func TestChunkSlice_Image_Files(t *testing.T) {
+	assertTestImageMatchesStandard(t, getTestBasicChunkSlice())
+
+	filepath := path.Join(assetsPath, "Selection_058.png")
+
+	pmp := NewPngMediaParser()
+
+	intfc, err := pmp.ParseFile(filepath)
+	log.PanicIf(err)
+
+	assertTestImageMatchesStandard(t, intfc.(*ChunkSlice))
+}
+
+func TestChunkSlice_Image_Transparency(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 4, 4))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 16)
+	}
+
+	cs := getTestImageChunkSlice(gray)
+
+	ce := NewChunkEncoder()
+
+	c, err := ce.Encode(&ChunkTRNS{ColorType: ColorTypeGrayscale, Gray: 32})
+	log.PanicIf(err)
+
+	cs.insertChunk(c, IDATChunkType)
+
+	assertTestImageMatchesStandard(t, cs)
+
+	img, err := cs.Image()
+	log.PanicIf(err)
+
+	if color.NRGBAModel.Convert(img.At(2, 0)).(color.NRGBA).A != 0 {
+		t.Fatalf("transparent sample not transparent")
+	} else if color.NRGBAModel.Convert(img.At(3, 0)).(color.NRGBA).A != 0xff {
+		t.Fatalf("opaque sample not opaque")
+	}
+
+	// Truecolor.
+	rgb := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range rgb.Pix {
+		rgb.Pix[i] = uint8(i)
+		if i%4 == 3 {
+			rgb.Pix[i] = 0xff
+		}
+	}
+
+	cs = getTestImageChunkSlice(rgb)
+
+	c, err = ce.Encode(&ChunkTRNS{ColorType: ColorTypeRgb, Red: 4, Green: 5, Blue: 6})
+	log.PanicIf(err)
+
+	cs.insertChunk(c, IDATChunkType)
+
+	assertTestImageMatchesStandard(t, cs)
+}
+
+func TestChunkSlice_Image_NoPalette(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestPalettedImage(4, 4))
+
+	cs.removeChunks(func(c *Chunk) bool {
+		return c.Type == PLTEChunkType
+	})
+
+	_, err := cs.Image()
+	if err == nil {
+		t.Fatalf("expected error for missing PLTE")
+	}
+}
+
+func ExampleChunkSlice_Image() {
+	cs := getTestBasicChunkSlice()
+
+	img, err := cs.Image()
+	log.PanicIf(err)
+
+	fmt.Printf("%T %v\n", img, img.Bounds())
+
+	// Output:
+	// *image.NRGBA (0,0)-(91,69)
+}
@@ -0,0 +1,337 @@
+package pngstructure
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// Interlace methods, as stored in IHDR.
+const (
+	InterlaceMethodNone  = uint8(0)
+	InterlaceMethodAdam7 = uint8(1)
+)
+
+var (
+	// adam7Layout is the x-offset, y-offset, x-step and y-step of each of the
+	// seven passes.
+	adam7Layout = [7][4]int{
+		{0, 0, 8, 8},
+		{4, 0, 8, 8},
+		{0, 4, 4, 8},
+		{2, 0, 4, 4},
+		{0, 2, 2, 4},
+		{1, 0, 2, 2},
+		{0, 1, 1, 2},
+	}
+)
+
+// Adam7Pass describes which pixels of the full image one interlace pass
+// holds.
+type Adam7Pass struct {
+	Index int
+
+	XOffset int
+	YOffset int
+	XStep   int
+	YStep   int
+
+	// Width and Height are the dimensions of the sub-image. Either may be
+	// zero for small images, in which case the pass has no data at all.
+	Width  int
+	Height int
+}
+
+func (ap Adam7Pass) String() string {
+	return fmt.Sprintf("Adam7Pass<INDEX=(%d) WIDTH=(%d) HEIGHT=(%d)>", ap.Index, ap.Width, ap.Height)
+}
+
+// IsEmpty returns true if the pass has no pixels.
+func (ap Adam7Pass) IsEmpty() bool {
+	return ap.Width == 0 || ap.Height == 0
+}
+
+// passExtent returns the number of positions from `offset` in steps of
+// `step` that fall inside of `size`.
+func passExtent(size, offset, step int) int {
+	if size <= offset {
+		return 0
+	}
+
+	return (size - offset + step - 1) / step
+}
+
+// Adam7Passes returns the seven passes for an image of the given dimensions.
+func Adam7Passes(width, height int) []Adam7Pass {
+	passes := make([]Adam7Pass, len(adam7Layout))
+	for i, layout := range adam7Layout {
+		passes[i] = Adam7Pass{
+			Index:   i,
+			XOffset: layout[0],
+			YOffset: layout[1],
+			XStep:   layout[2],
+			YStep:   layout[3],
+			Width:   passExtent(width, layout[0], layout[2]),
+			Height:  passExtent(height, layout[1], layout[3]),
+		}
+	}
+
+	return passes
+}
+
+// copyPixel copies one pixel between packed rows.
+func copyPixel(dst []byte, dstX int, src []byte, srcX int, bitsPerPixel int) {
+	if bitsPerPixel >= 8 {
+		n := bitsPerPixel / 8
+		copy(dst[dstX*n:dstX*n+n], src[srcX*n:srcX*n+n])
+
+		return
+	}
+
+	// Sub-byte pixels are packed from the most-significant bit.
+	mask := byte(1<<uint(bitsPerPixel) - 1)
+
+	srcBit := srcX * bitsPerPixel
+	srcShift := uint(8 - bitsPerPixel - srcBit%8)
+	value := (src[srcBit/8] >> srcShift) & mask
+
+	dstBit := dstX * bitsPerPixel
+	dstShift := uint(8 - bitsPerPixel - dstBit%8)
+	dst[dstBit/8] = dst[dstBit/8]&^(mask<<dstShift) | value<<dstShift
+}
+
+// InterlacedSubImage is the unfiltered data of one Adam7 pass.
+type InterlacedSubImage struct {
+	Pass      Adam7Pass
+	Scanlines []*Scanline
+}
+
+func (isi *InterlacedSubImage) String() string {
+	return fmt.Sprintf("InterlacedSubImage<PASS=(%d) WIDTH=(%d) HEIGHT=(%d)>", isi.Pass.Index, isi.Pass.Width, isi.Pass.Height)
+}
+
+// readSubImages reads all seven passes from the filtered image data.
+func readSubImages(r io.Reader, ihdr *ChunkIHDR) (subImages []*InterlacedSubImage, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	passes := Adam7Passes(int(ihdr.Width), int(ihdr.Height))
+
+	subImages = make([]*InterlacedSubImage, len(passes))
+	for i, pass := range passes {
+		scanlines, err := readScanlines(r, ihdr, pass.Width, pass.Height)
+		log.PanicIf(err)
+
+		subImages[i] = &InterlacedSubImage{
+			Pass:      pass,
+			Scanlines: scanlines,
+		}
+	}
+
+	return subImages, nil
+}
+
+// readScanlines reads all of the scanlines of an image (or pass) of the given
+// dimensions. An empty pass has no scanlines (nor any data).
+func readScanlines(r io.Reader, ihdr *ChunkIHDR, width, height int) (scanlines []*Scanline, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	scanlines = make([]*Scanline, 0)
+
+	if width == 0 || height == 0 {
+		return scanlines, nil
+	}
+
+	sr := NewScanlineReader(r, ihdr, width, height)
+
+	for {
+		scanline, err := sr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		scanlines = append(scanlines, scanline)
+	}
+
+	return scanlines, nil
+}
+
+// deinterlace assembles the full image from the passes.
+func deinterlace(ihdr *ChunkIHDR, subImages []*InterlacedSubImage) (rows [][]byte) {
+	bitsPerPixel := ihdr.BitsPerPixel()
+	stride := ihdr.Stride(int(ihdr.Width))
+
+	rows = make([][]byte, ihdr.Height)
+	for y := range rows {
+		rows[y] = make([]byte, stride)
+	}
+
+	for _, subImage := range subImages {
+		pass := subImage.Pass
+
+		for _, scanline := range subImage.Scanlines {
+			row := rows[pass.YOffset+scanline.Row*pass.YStep]
+
+			for x := 0; x < pass.Width; x++ {
+				copyPixel(row, pass.XOffset+x*pass.XStep, scanline.Data, x, bitsPerPixel)
+			}
+		}
+	}
+
+	return rows
+}
+
+// interlace splits the full image into the rows of each pass.
+func interlace(ihdr *ChunkIHDR, rows [][]byte) (passRows [][][]byte) {
+	bitsPerPixel := ihdr.BitsPerPixel()
+	passes := Adam7Passes(int(ihdr.Width), int(ihdr.Height))
+
+	passRows = make([][][]byte, len(passes))
+	for i, pass := range passes {
+		if pass.IsEmpty() == true {
+			continue
+		}
+
+		stride := ihdr.Stride(pass.Width)
+
+		passRows[i] = make([][]byte, pass.Height)
+		for y := range passRows[i] {
+			passRow := make([]byte, stride)
+			row := rows[pass.YOffset+y*pass.YStep]
+
+			for x := 0; x < pass.Width; x++ {
+				copyPixel(passRow, x, row, pass.XOffset+x*pass.XStep, bitsPerPixel)
+			}
+
+			passRows[i][y] = passRow
+		}
+	}
+
+	return passRows
+}
+
+// decodeIhdr decodes the IHDR, which is always the first chunk, and makes
+// sure that the image data can be laid out from it.
+func (cs *ChunkSlice) decodeIhdr() (ihdr *ChunkIHDR, err error) {
+	if len(cs.chunks) == 0 || cs.chunks[0].Type != IHDRChunkType {
+		return nil, ErrNoIhdr
+	}
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(cs.chunks[0])
+	if err != nil {
+		return nil, err
+	}
+
+	ihdr = decoded.(*ChunkIHDR)
+
+	err = ihdr.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return ihdr, nil
+}
+
+// Adam7SubImages returns the seven unfiltered sub-images of an interlaced
+// image, including any empty ones.
+func (cs *ChunkSlice) Adam7SubImages() (subImages []*InterlacedSubImage, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	ihdr, err := cs.decodeIhdr()
+	log.PanicIf(err)
+
+	if ihdr.InterlaceMethod != InterlaceMethodAdam7 {
+		log.Panicf("image is not interlaced")
+	}
+
+	rc, err := cs.ImageData()
+	log.PanicIf(err)
+
+	defer rc.Close()
+
+	subImages, err = readSubImages(rc, ihdr)
+	log.PanicIf(err)
+
+	return subImages, nil
+}
+
+// PixelRows returns the unfiltered rows of the full image, de-interlacing if
+// necessary. The samples are packed as in the image data.
+func (cs *ChunkSlice) PixelRows() (ihdr *ChunkIHDR, rows [][]byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	ihdr, err = cs.decodeIhdr()
+	log.PanicIf(err)
+
+	rc, err := cs.ImageData()
+	log.PanicIf(err)
+
+	defer rc.Close()
+
+	switch ihdr.InterlaceMethod {
+	case InterlaceMethodNone:
+		scanlines, err := readScanlines(rc, ihdr, int(ihdr.Width), int(ihdr.Height))
+		log.PanicIf(err)
+
+		rows = make([][]byte, len(scanlines))
+		for i, scanline := range scanlines {
+			rows[i] = scanline.Data
+		}
+
+	case InterlaceMethodAdam7:
+		subImages, err := readSubImages(rc, ihdr)
+		log.PanicIf(err)
+
+		rows = deinterlace(ihdr, subImages)
+
+	default:
+		log.Panicf("interlace-method not valid: (%d)", ihdr.InterlaceMethod)
+	}
+
+	return ihdr, rows, nil
+}
+
+// SetInterlaceMethod re-encodes the image data with the given interlace
+// method, using the default encoding options. This works on the raw samples;
+// no `image.Image` is involved and the samples are unchanged.
+func (cs *ChunkSlice) SetInterlaceMethod(interlaceMethod uint8) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if interlaceMethod != InterlaceMethodNone && interlaceMethod != InterlaceMethodAdam7 {
+		log.Panicf("interlace-method not valid: (%d)", interlaceMethod)
+	}
+
+	ihdr, rows, err := cs.PixelRows()
+	log.PanicIf(err)
+
+	ihdr.InterlaceMethod = interlaceMethod
+
+	err = cs.setImageData(ihdr, rows, nil)
+	log.PanicIf(err)
+
+	return nil
+}
@@ -0,0 +1,204 @@
+package pngstructure
+
+import (
+	"fmt"
+	"image"
+	"reflect"
+	"testing"
+
+	"image/color"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func getTestPalettedImage(width, height int) *image.Paletted {
+	palette := color.Palette{
+		color.NRGBA{0xff, 0, 0, 0xff},
+		color.NRGBA{0, 0xff, 0, 0xff},
+		color.NRGBA{0, 0, 0xff, 0xff},
+		color.NRGBA{0xff, 0xff, 0, 0xff},
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetColorIndex(x, y, uint8((x*3+y)%len(palette)))
+		}
+	}
+
+	return img
+}
+
+func assertTestImagesEqual(t *testing.T, actual, expected image.Image) {
+	if actual.Bounds() != expected.Bounds() {
+		t.Fatalf("bounds not equal: %v != %v", actual.Bounds(), expected.Bounds())
+	}
+
+	for y := expected.Bounds().Min.Y; y < expected.Bounds().Max.Y; y++ {
+		for x := expected.Bounds().Min.X; x < expected.Bounds().Max.X; x++ {
+			a := color.NRGBA64Model.Convert(actual.At(x, y))
+			e := color.NRGBA64Model.Convert(expected.At(x, y))
+
+			if a != e {
+				t.Fatalf("pixel (%d, %d) not equal: %v != %v", x, y, a, e)
+			}
+		}
+	}
+}
+
+func TestAdam7Passes(t *testing.T) {
+	passes := Adam7Passes(1, 1)
+
+	for i, pass := range passes {
+		if pass.IsEmpty() != (i != 0) {
+			t.Fatalf("pass (%d) emptiness not correct: %s", i, pass)
+		}
+	}
+
+	passes = Adam7Passes(91, 69)
+
+	expected := [][2]int{{12, 9}, {11, 9}, {23, 9}, {23, 18}, {46, 17}, {45, 35}, {91, 34}}
+	for i, pass := range passes {
+		if pass.Width != expected[i][0] || pass.Height != expected[i][1] {
+			t.Fatalf("pass (%d) dimensions not correct: %s", i, pass)
+		}
+	}
+}
+
+func TestCopyPixel_Packed(t *testing.T) {
+	src := []byte{0xb4} // 10 11 01 00
+	dst := []byte{0xff}
+
+	copyPixel(dst, 3, src, 1, 2)
+	if dst[0] != 0xff {
+		t.Fatalf("pixel not copied correctly: (%02x)", dst[0])
+	}
+
+	copyPixel(dst, 0, src, 3, 2)
+	if dst[0] != 0x3f {
+		t.Fatalf("pixel not copied correctly: (%02x)", dst[0])
+	}
+}
+
+func TestChunkSlice_Adam7SubImages(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	subImages, err := cs.Adam7SubImages()
+	log.PanicIf(err)
+
+	if len(subImages) != 7 {
+		t.Fatalf("sub-image count not correct: (%d)", len(subImages))
+	}
+
+	img := decodeTestChunkSlice(cs).(*image.NRGBA)
+
+	for _, subImage := range subImages {
+		pass := subImage.Pass
+
+		if len(subImage.Scanlines) != pass.Height {
+			t.Fatalf("pass (%d) scanline count not correct: (%d)", pass.Index, len(subImage.Scanlines))
+		}
+
+		// Spot-check the last pixel of each row.
+		for _, scanline := range subImage.Scanlines {
+			x := pass.XOffset + (pass.Width-1)*pass.XStep
+			y := pass.YOffset + scanline.Row*pass.YStep
+
+			actual := scanline.Data[(pass.Width-1)*4 : pass.Width*4]
+			expected := img.Pix[img.PixOffset(x, y) : img.PixOffset(x, y)+4]
+
+			if reflect.DeepEqual(actual, expected) != true {
+				t.Fatalf("pass (%d) pixel (%d, %d) not correct", pass.Index, x, y)
+			}
+		}
+	}
+}
+
+func TestChunkSlice_Adam7SubImages_NotInterlaced(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestGradientImage(4, 4))
+
+	_, err := cs.Adam7SubImages()
+	if err == nil {
+		t.Fatalf("expected error for non-interlaced image")
+	}
+}
+
+func TestChunkSlice_PixelRows_Interlaced(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	ihdr, rows, err := cs.PixelRows()
+	log.PanicIf(err)
+
+	img := decodeTestChunkSlice(cs).(*image.NRGBA)
+
+	for y, row := range rows {
+		expected := img.Pix[y*img.Stride : y*img.Stride+int(ihdr.Width)*4]
+		if reflect.DeepEqual(row, expected) != true {
+			t.Fatalf("row (%d) not correct", y)
+		}
+	}
+}
+
+func TestChunkSlice_SetInterlaceMethod(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+	original := decodeTestChunkSlice(cs)
+
+	err := cs.SetInterlaceMethod(InterlaceMethodNone)
+	log.PanicIf(err)
+
+	ihdr, err := cs.decodeIhdr()
+	log.PanicIf(err)
+
+	if ihdr.InterlaceMethod != InterlaceMethodNone {
+		t.Fatalf("IHDR not updated")
+	}
+
+	assertTestImagesEqual(t, decodeTestChunkSlice(cs), original)
+
+	// The other chunks are untouched.
+	if _, found := cs.Index()[EXifChunkType]; found == false {
+		t.Fatalf("eXIf chunk lost")
+	}
+
+	err = cs.SetInterlaceMethod(InterlaceMethodAdam7)
+	log.PanicIf(err)
+
+	assertTestImagesEqual(t, decodeTestChunkSlice(cs), original)
+}
+
+func TestChunkSlice_SetInterlaceMethod_Packed(t *testing.T) {
+	img := getTestPalettedImage(13, 11)
+	cs := getTestImageChunkSlice(img)
+
+	ihdr, err := cs.decodeIhdr()
+	log.PanicIf(err)
+
+	if ihdr.BitDepth != 2 {
+		t.Fatalf("expected a 2-bit image: %s", ihdr)
+	}
+
+	err = cs.SetInterlaceMethod(InterlaceMethodAdam7)
+	log.PanicIf(err)
+
+	assertTestImagesEqual(t, decodeTestChunkSlice(cs), img)
+
+	err = cs.SetInterlaceMethod(InterlaceMethodNone)
+	log.PanicIf(err)
+
+	assertTestImagesEqual(t, decodeTestChunkSlice(cs), img)
+}
+
+func ExampleChunkSlice_SetInterlaceMethod() {
+	cs := getTestBasicChunkSlice()
+
+	err := cs.SetInterlaceMethod(InterlaceMethodNone)
+	log.PanicIf(err)
+
+	ihdr, rows, err := cs.PixelRows()
+	log.PanicIf(err)
+
+	fmt.Printf("interlace-method (%d): %d rows\n", ihdr.InterlaceMethod, len(rows))
+
+	// Output:
+	// interlace-method (0): 69 rows
+}
@@ -0,0 +1,251 @@
+package pngstructure
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	"encoding/binary"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// mappedFile is a read-only memory-mapping of a whole file. Reads fail once it
+// has been closed rather than touching memory that is no longer mapped.
+type mappedFile struct {
+	mutex sync.RWMutex
+	data  []byte
+}
+
+// ReadAt reads from the mapped memory. Returns `os.ErrClosed` after `Close`.
+func (mf *mappedFile) ReadAt(p []byte, offset int64) (n int, err error) {
+	mf.mutex.RLock()
+	defer mf.mutex.RUnlock()
+
+	if mf.data == nil {
+		return 0, os.ErrClosed
+	} else if offset < 0 {
+		return 0, log.Errorf("offset not valid: (%d)", offset)
+	} else if offset >= int64(len(mf.data)) {
+		return 0, io.EOF
+	}
+
+	n = copy(p, mf.data[offset:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// Close unmaps the file. It waits for any reads in progress.
+func (mf *mappedFile) Close() error {
+	mf.mutex.Lock()
+	defer mf.mutex.Unlock()
+
+	if mf.data == nil {
+		return nil
+	}
+
+	data := mf.data
+	mf.data = nil
+
+	return munmap(data)
+}
+
+// readFullAt reads `len(p)` bytes at the offset. `io.ReaderAt` may return
+// `io.EOF` along with a full read that ends at the end of the data, which is
+// not an error here.
+func readFullAt(ra io.ReaderAt, p []byte, offset int64) (n int, err error) {
+	n, err = ra.ReadAt(p, offset)
+	if err == io.EOF && n == len(p) {
+		return n, nil
+	}
+
+	return n, err
+}
+
+// IsLazy returns true if the payload of the chunk has not been loaded from
+// its source yet.
+func (c *Chunk) IsLazy() bool {
+	return c.source != nil && c.Data == nil && c.Length > 0
+}
+
+// Load reads the payload of a lazy chunk from its source and checks the CRC.
+// It does nothing if the payload is already loaded.
+func (c *Chunk) Load() (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if c.IsLazy() == false {
+		return nil
+	}
+
+	data := make([]byte, c.Length)
+
+	_, err = readFullAt(c.source, data, int64(c.Offset)+8)
+	log.PanicIf(err)
+
+	c.Data = data
+
+	if actual := calculateCrc32(c); actual != c.Crc {
+		c.Data = nil
+
+		cme := &CrcMismatchError{Expected: c.Crc, Actual: actual}
+		log.Panic(newChunkError(c.Offset, c.Type, -1, cme))
+	}
+
+	return nil
+}
+
+// payloadReader returns a reader of the payload that doesn't load a lazy
+// chunk.
+func (c *Chunk) payloadReader() io.Reader {
+	if c.IsLazy() == true {
+		return io.NewSectionReader(c.source, int64(c.Offset)+8, int64(c.Length))
+	}
+
+	return bytes.NewReader(c.Data)
+}
+
+// ParseLazy reads only the chunk headers and CRCs. The payloads are loaded
+// from `ra` when first needed (see `Chunk.Load`), so `ra` must remain valid
+// for as long as the chunks are used. CRCs are checked when the payload is
+// loaded rather than here. `WriteTo` copies chunks that were never loaded
+// straight from `ra`.
+func (pmp *PngMediaParser) ParseLazy(ra io.ReaderAt, size int64) (cs *ChunkSlice, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	signature := make([]byte, len(PngSignature))
+
+	_, err = readFullAt(ra, signature, 0)
+	if err == io.EOF {
+		log.Panic(ErrNotPng)
+	}
+
+	log.PanicIf(err)
+
+	if bytes.Equal(signature, PngSignature[:]) == false {
+		log.Panic(ErrNotPng)
+	}
+
+	limiter := newChunkLimiter(pmp.options)
+
+	chunks := make([]*Chunk, 0)
+	offset := int64(len(PngSignature))
+	header := make([]byte, 8)
+	raw := make([]byte, 4)
+
+	for offset < size {
+		n, err := readFullAt(ra, header, offset)
+		if err == io.EOF {
+			log.Panic(&TruncatedError{Offset: int(offset), Expected: len(header), Actual: n})
+		}
+
+		log.PanicIf(err)
+
+		length := binary.BigEndian.Uint32(header[:4])
+		type_ := string(header[4:8])
+		index := len(chunks)
+
+		err = limiter.checkHeader(type_, length)
+		if err == nil {
+			err = limiter.countChunk(type_)
+		}
+
+		if err != nil {
+			log.Panic(newChunkError(int(offset), type_, index, err))
+		}
+
+		crcOffset := offset + 8 + int64(length)
+		if crcOffset+4 > size {
+			te := &TruncatedError{Offset: int(offset) + 8, Expected: int(length) + 4, Actual: int(size - offset - 8)}
+			log.Panic(newChunkError(int(offset), type_, index, te))
+		}
+
+		_, err = readFullAt(ra, raw, crcOffset)
+		log.PanicIf(err)
+
+		c := &Chunk{
+			Offset: int(offset),
+			Length: length,
+			Type:   type_,
+			Crc:    binary.BigEndian.Uint32(raw),
+			source: ra,
+		}
+
+		err = limiter.checkData(c)
+		if err != nil {
+			log.Panic(newChunkError(c.Offset, type_, index, err))
+		}
+
+		chunks = append(chunks, c)
+		offset = crcOffset + 4
+
+		if type_ == IENDChunkType {
+			break
+		}
+	}
+
+	if len(chunks) == 0 {
+		log.Panic(&TruncatedError{Offset: int(offset), Expected: 8, Actual: 0})
+	}
+
+	return NewChunkSlice(chunks), nil
+}
+
+// ParseFileLazy opens the file and parses it with `ParseLazy`. If `doMmap` is
+// true and the platform supports it, the file is memory-mapped. The closer
+// must be called once the chunks are no longer needed, after which loading
+// the chunks that were never loaded fails with `os.ErrClosed`.
+func (pmp *PngMediaParser) ParseFileLazy(filepath string, doMmap bool) (cs *ChunkSlice, closer io.Closer, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	f, err := os.Open(filepath)
+	log.PanicIf(err)
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		log.Panic(err)
+	}
+
+	var ra io.ReaderAt = f
+	closer = f
+
+	if doMmap == true && stat.Size() > 0 {
+		mapped, err := mmapFile(f, stat.Size())
+		if err != nil {
+			f.Close()
+			log.Panic(err)
+		}
+
+		// The mapping is still valid after the file is closed.
+		if mapped != nil {
+			f.Close()
+
+			ra = mapped
+			closer = mapped
+		}
+	}
+
+	cs, err = pmp.ParseLazy(ra, stat.Size())
+	if err != nil {
+		closer.Close()
+		log.Panic(err)
+	}
+
+	return cs, closer, nil
+}
@@ -0,0 +1,398 @@
+package pngstructure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// countingReaderAt counts how many bytes are read.
+type countingReaderAt struct {
+	ra    io.ReaderAt
+	count int
+}
+
+func (cra *countingReaderAt) ReadAt(p []byte, offset int64) (n int, err error) {
+	n, err = cra.ra.ReadAt(p, offset)
+	cra.count += n
+
+	return n, err
+}
+
+// eofReaderAt returns `io.EOF` with every read that reaches the end of the
+// data, even if it is a full read, as `io.ReaderAt` allows.
+type eofReaderAt struct {
+	data []byte
+}
+
+func (era *eofReaderAt) ReadAt(p []byte, offset int64) (n int, err error) {
+	if offset >= int64(len(era.data)) {
+		return 0, io.EOF
+	}
+
+	n = copy(p, era.data[offset:])
+	if offset+int64(n) == int64(len(era.data)) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func getTestLazyChunkSlice(filepath string) (cs *ChunkSlice, cra *countingReaderAt, data []byte) {
+	data, err := ioutil.ReadFile(filepath)
+	log.PanicIf(err)
+
+	cra = &countingReaderAt{
+		ra: bytes.NewReader(data),
+	}
+
+	pmp := NewPngMediaParser()
+
+	cs, err = pmp.ParseLazy(cra, int64(len(data)))
+	log.PanicIf(err)
+
+	return cs, cra, data
+}
+
+func TestPngMediaParser_ParseLazy(t *testing.T) {
+	cs, cra, data := getTestLazyChunkSlice(getTestBasicImageFilepath())
+
+	expected := getTestBasicChunkSlice().Chunks()
+	actual := cs.Chunks()
+
+	if len(actual) != len(expected) {
+		t.Fatalf("chunk count not correct: (%d) != (%d)", len(actual), len(expected))
+	}
+
+	for i, c := range actual {
+		e := expected[i]
+		if c.Type != e.Type || c.Offset != e.Offset || c.Length != e.Length || c.Crc != e.Crc {
+			t.Fatalf("chunk (%d) not correct: %s != %s", i, c, e)
+		} else if c.Length > 0 && c.IsLazy() != true {
+			t.Fatalf("chunk (%d) not lazy: %s", i, c)
+		}
+	}
+
+	if cra.count >= len(data)/2 {
+		t.Fatalf("too much read while parsing: (%d) of (%d)", cra.count, len(data))
+	}
+
+	// Load one.
+	c := cs.Index()[TEXtChunkType][0]
+
+	err := c.Load()
+	log.PanicIf(err)
+
+	if c.IsLazy() != false {
+		t.Fatalf("chunk still lazy after loading")
+	}
+
+	for _, e := range expected {
+		if e.Offset == c.Offset && bytes.Equal(e.Data, c.Data) != true {
+			t.Fatalf("loaded data not correct")
+		}
+	}
+}
+
+func TestPngMediaParser_ParseLazy_Exif(t *testing.T) {
+	cs, cra, data := getTestLazyChunkSlice(getTestExifImageFilepath())
+
+	_, _, err := cs.Exif()
+	log.PanicIf(err)
+
+	// None of the image data was read.
+	for _, c := range cs.Index()[IDATChunkType] {
+		if c.IsLazy() != true {
+			t.Fatalf("IDAT was loaded")
+		}
+	}
+
+	if cra.count >= len(data)/2 {
+		t.Fatalf("too much read: (%d) of (%d)", cra.count, len(data))
+	}
+}
+
+func TestPngMediaParser_ParseLazy_Image(t *testing.T) {
+	cs, _, _ := getTestLazyChunkSlice(getTestBasicImageFilepath())
+
+	assertTestImageMatchesStandard(t, cs)
+
+	// The image data is streamed from the source rather than loaded.
+	for _, c := range cs.Index()[IDATChunkType] {
+		if c.IsLazy() != true {
+			t.Fatalf("IDAT was loaded")
+		}
+	}
+}
+
+// getTestLazyBytesChunkSlice writes the chunks and parses them back lazily.
+func getTestLazyBytesChunkSlice(cs *ChunkSlice) *ChunkSlice {
+	b := new(bytes.Buffer)
+
+	err := cs.WriteTo(b)
+	log.PanicIf(err)
+
+	pmp := NewPngMediaParser()
+
+	lazyCs, err := pmp.ParseLazy(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	log.PanicIf(err)
+
+	return lazyCs
+}
+
+func TestAssembleAnimation_Lazy(t *testing.T) {
+	images := getTestAnimationFrameImages()
+
+	frames := make([]*ChunkSlice, len(images))
+	for i, img := range images {
+		frames[i] = getTestLazyBytesChunkSlice(getTestImageChunkSlice(img))
+	}
+
+	delays := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 30 * time.Millisecond}
+
+	cs, err := AssembleAnimation(frames, delays, 0)
+	log.PanicIf(err)
+
+	for _, c := range cs.Index()[FDATChunkType] {
+		if c.Length <= 4 {
+			t.Fatalf("fdAT has no frame data: %s", c)
+		}
+	}
+
+	// Round-trip it so that nothing still refers to the lazy frames.
+	b := new(bytes.Buffer)
+
+	err = cs.WriteTo(b)
+	log.PanicIf(err)
+
+	pmp := NewPngMediaParser()
+
+	intfc, err := pmp.ParseBytes(b.Bytes())
+	log.PanicIf(err)
+
+	extracted, err := intfc.(*ChunkSlice).ExtractFrames(false)
+	log.PanicIf(err)
+
+	for i, frameCs := range extracted {
+		assertTestImagesEqual(t, decodeTestChunkSlice(frameCs), images[i])
+	}
+}
+
+func TestChunkSlice_ExtractFrames_Lazy(t *testing.T) {
+	expected := getTestAnimatedChunkSlice()
+	cs := getTestLazyBytesChunkSlice(expected)
+
+	for _, composite := range []bool{false, true} {
+		expectedFrames, err := expected.ExtractFrames(composite)
+		log.PanicIf(err)
+
+		frames, err := cs.ExtractFrames(composite)
+		log.PanicIf(err)
+
+		if len(frames) != len(expectedFrames) {
+			t.Fatalf("frame count not correct: (%d)", len(frames))
+		}
+
+		for i, frameCs := range frames {
+			assertTestImagesEqual(t, decodeTestChunkSlice(frameCs), decodeTestChunkSlice(expectedFrames[i]))
+		}
+	}
+}
+
+func TestChunkSlice_WriteTo_Lazy(t *testing.T) {
+	cs, _, data := getTestLazyChunkSlice(getTestBasicImageFilepath())
+
+	b := new(bytes.Buffer)
+
+	err := cs.WriteTo(b)
+	log.PanicIf(err)
+
+	if bytes.Equal(b.Bytes(), data) != true {
+		t.Fatalf("untouched lazy chunks not written as-is")
+	}
+
+	err = cs.SetText("Comment", "lazy")
+	log.PanicIf(err)
+
+	b = new(bytes.Buffer)
+
+	err = cs.WriteTo(b)
+	log.PanicIf(err)
+
+	pmp := NewPngMediaParser()
+
+	intfc, err := pmp.ParseBytes(b.Bytes())
+	log.PanicIf(err)
+
+	written := intfc.(*ChunkSlice)
+
+	text, err := written.GetText()
+	log.PanicIf(err)
+
+	if text["Comment"] != "lazy" {
+		t.Fatalf("text not written: %v", text)
+	}
+
+	assertTestImagesEqual(t, decodeTestChunkSlice(written), decodeTestChunkSlice(getTestBasicChunkSlice()))
+}
+
+func TestChunk_Load_CrcFailure(t *testing.T) {
+	data, err := ioutil.ReadFile(getTestBasicImageFilepath())
+	log.PanicIf(err)
+
+	expected := getTestBasicChunkSlice().Index()[TEXtChunkType][0]
+	data[expected.Offset+8] ^= 0xff
+
+	pmp := NewPngMediaParser()
+
+	cs, err := pmp.ParseLazy(bytes.NewReader(data), int64(len(data)))
+	log.PanicIf(err)
+
+	c := cs.Index()[TEXtChunkType][0]
+
+	err = c.Load()
+	if log.Is(err, ErrCrcFailure) != true {
+		t.Fatalf("expected CRC failure: [%v]", err)
+	} else if c.IsLazy() != true {
+		t.Fatalf("chunk should still be lazy")
+	}
+}
+
+func TestPngMediaParser_ParseLazy_EofWithFullRead(t *testing.T) {
+	data, err := ioutil.ReadFile(getTestBasicImageFilepath())
+	log.PanicIf(err)
+
+	pmp := NewPngMediaParser()
+
+	// The last read is the CRC of the IEND, which ends at the end of the data.
+	cs, err := pmp.ParseLazy(&eofReaderAt{data: data}, int64(len(data)))
+	log.PanicIf(err)
+
+	chunks := cs.Chunks()
+	if chunks[len(chunks)-1].Type != IENDChunkType {
+		t.Fatalf("IEND not parsed")
+	}
+
+	for _, c := range chunks {
+		err := c.Load()
+		log.PanicIf(err)
+	}
+
+	b := new(bytes.Buffer)
+
+	err = cs.WriteTo(b)
+	log.PanicIf(err)
+
+	if bytes.Equal(b.Bytes(), data) != true {
+		t.Fatalf("data not correct")
+	}
+}
+
+func TestPngMediaParser_ParseLazy_Invalid(t *testing.T) {
+	data, err := ioutil.ReadFile(getTestBasicImageFilepath())
+	log.PanicIf(err)
+
+	pmp := NewPngMediaParser()
+
+	_, err = pmp.ParseLazy(bytes.NewReader(data[:100]), 100)
+	if err == nil {
+		t.Fatalf("expected error for truncated data")
+	}
+
+	_, err = pmp.ParseLazy(bytes.NewReader([]byte("not a png")), 9)
+	if log.Is(err, ErrNotPng) != true {
+		t.Fatalf("expected ErrNotPng: [%v]", err)
+	}
+}
+
+func TestPngMediaParser_ParseFileLazy(t *testing.T) {
+	pmp := NewPngMediaParser()
+
+	for _, doMmap := range []bool{false, true} {
+		cs, closer, err := pmp.ParseFileLazy(getTestBasicImageFilepath(), doMmap)
+		log.PanicIf(err)
+
+		assertTestImageMatchesStandard(t, cs)
+
+		err = closer.Close()
+		log.PanicIf(err)
+	}
+}
+
+func TestChunk_Load_AfterClose(t *testing.T) {
+	pmp := NewPngMediaParser()
+
+	for _, doMmap := range []bool{false, true} {
+		cs, closer, err := pmp.ParseFileLazy(getTestBasicImageFilepath(), doMmap)
+		log.PanicIf(err)
+
+		err = closer.Close()
+		log.PanicIf(err)
+
+		c := cs.Index()[IDATChunkType][0]
+
+		err = c.Load()
+		if err == nil {
+			t.Fatalf("expected error loading after close (mmap: %v)", doMmap)
+		} else if errors.Is(err, os.ErrClosed) != true {
+			t.Fatalf("expected os.ErrClosed (mmap: %v): %v", doMmap, err)
+		}
+
+		// Closing again is harmless.
+		err = closer.Close()
+		if doMmap == true && err != nil {
+			t.Fatalf("second close failed: %v", err)
+		}
+	}
+}
+
+func TestMappedFile_ReadAt(t *testing.T) {
+	mf := &mappedFile{data: []byte("abcdef")}
+
+	p := make([]byte, 4)
+
+	n, err := mf.ReadAt(p, 1)
+	if err != nil || n != 4 || string(p) != "bcde" {
+		t.Fatalf("read not correct: (%d) [%s] %v", n, p, err)
+	}
+
+	n, err = mf.ReadAt(p, 4)
+	if err != io.EOF || n != 2 || string(p[:n]) != "ef" {
+		t.Fatalf("short read not correct: (%d) [%s] %v", n, p[:n], err)
+	}
+
+	// This memory was never mapped, so mark it closed rather than unmapping
+	// it.
+	mf.data = nil
+
+	_, err = mf.ReadAt(p, 0)
+	if err != os.ErrClosed {
+		t.Fatalf("expected os.ErrClosed: %v", err)
+	}
+}
+
+func ExamplePngMediaParser_ParseFileLazy() {
+	pmp := NewPngMediaParser()
+
+	cs, closer, err := pmp.ParseFileLazy(getTestExifImageFilepath(), true)
+	log.PanicIf(err)
+
+	defer closer.Close()
+
+	// Only the eXIf chunk is read.
+	rootIfd, _, err := cs.Exif()
+	log.PanicIf(err)
+
+	fmt.Printf("%s\n", rootIfd.IfdIdentity())
+
+	// Output:
+	// IFD
+}
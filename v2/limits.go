@@ -0,0 +1,292 @@
+package pngstructure
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"compress/zlib"
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+)
+
+var (
+	// ErrChunkTooLong indicates a chunk length beyond the limit (or beyond
+	// what the specification allows).
+	ErrChunkTooLong = errors.New("chunk too long")
+
+	// ErrTooManyChunks indicates more chunks than the limit.
+	ErrTooManyChunks = errors.New("too many chunks")
+
+	// ErrTooManyChunksOfType indicates more chunks of one type than the limit
+	// for that type.
+	ErrTooManyChunksOfType = errors.New("too many chunks of type")
+
+	// ErrImageTooWide indicates an IHDR width beyond the limit.
+	ErrImageTooWide = errors.New("image too wide")
+
+	// ErrImageTooTall indicates an IHDR height beyond the limit.
+	ErrImageTooTall = errors.New("image too tall")
+
+	// ErrTooManyPixels indicates an IHDR width times height beyond the limit.
+	ErrTooManyPixels = errors.New("too many pixels")
+
+	// ErrInflatedChunkTooLarge indicates a zTXt, iTXt or iCCP chunk whose
+	// compressed data inflates to more than the limit.
+	ErrInflatedChunkTooLarge = errors.New("inflated chunk too large")
+
+	// ErrImageDataTooLarge indicates image data that inflates to more than
+	// the limit.
+	ErrImageDataTooLarge = errors.New("inflated image data too large")
+)
+
+// ParseOptions limits what the parser will accept so that untrusted images
+// can't exhaust memory. Zero means unlimited for every field.
+type ParseOptions struct {
+	// MaxChunkLength is the largest chunk data length. The specification's
+	// limit (`MaxChunkLength`) is always enforced, even without options.
+	MaxChunkLength uint32
+
+	// MaxChunkCount is the most chunks, of all types.
+	MaxChunkCount int
+
+	// MaxChunkCountPerType is the most chunks of each given type.
+	MaxChunkCountPerType map[string]int
+
+	MaxWidth      uint32
+	MaxHeight     uint32
+	MaxPixelCount uint64
+
+	// MaxInflatedSize is the most that the compressed data of one zTXt, iTXt
+	// or iCCP chunk may inflate to. The data is inflated only up to the
+	// limit.
+	MaxInflatedSize int64
+
+	// MaxImageDataSize is the most that the image data (all of the IDATs
+	// together) may inflate to. This is calculated from the IHDR (it's
+	// exactly what a decoder will read), so no image data is inflated.
+	// `ChunkSlice.ImageData` never inflates more than that either.
+	MaxImageDataSize int64
+}
+
+// chunkLimiter enforces the parse options while chunks are read.
+type chunkLimiter struct {
+	options *ParseOptions
+
+	count        int
+	countPerType map[string]int
+}
+
+func newChunkLimiter(options *ParseOptions) *chunkLimiter {
+	if options == nil {
+		options = new(ParseOptions)
+	}
+
+	return &chunkLimiter{
+		options:      options,
+		countPerType: make(map[string]int),
+	}
+}
+
+// checkHeader checks the chunk length before any of the data is read. This
+// doesn't count the chunk and may be called more than once for the same one.
+func (cl *chunkLimiter) checkHeader(type_ string, length uint32) error {
+	if length > MaxChunkLength {
+		return log.Errorf("%w: [%s] length (%d) beyond the maximum that PNG allows (%d)", ErrChunkTooLong, type_, length, MaxChunkLength)
+	} else if cl.options.MaxChunkLength > 0 && length > cl.options.MaxChunkLength {
+		return log.Errorf("%w: [%s] length (%d) beyond the limit (%d)", ErrChunkTooLong, type_, length, cl.options.MaxChunkLength)
+	}
+
+	return nil
+}
+
+// countChunk counts the chunk against the total and per-type limits.
+func (cl *chunkLimiter) countChunk(type_ string) error {
+	cl.count++
+	cl.countPerType[type_]++
+
+	if cl.options.MaxChunkCount > 0 && cl.count > cl.options.MaxChunkCount {
+		return log.Errorf("%w: more than (%d)", ErrTooManyChunks, cl.options.MaxChunkCount)
+	}
+
+	if limit, found := cl.options.MaxChunkCountPerType[type_]; found == true && cl.countPerType[type_] > limit {
+		return log.Errorf("%w: more than (%d) [%s] chunks", ErrTooManyChunksOfType, limit, type_)
+	}
+
+	return nil
+}
+
+// checkData checks the contents of the chunks that a limit applies to. Lazy
+// chunks are only loaded if one does.
+func (cl *chunkLimiter) checkData(c *Chunk) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	options := cl.options
+
+	switch c.Type {
+	case IHDRChunkType:
+		if options.MaxWidth == 0 && options.MaxHeight == 0 && options.MaxPixelCount == 0 && options.MaxImageDataSize == 0 {
+			return nil
+		}
+
+		cd := NewChunkDecoder()
+
+		decoded, err := cd.Decode(c)
+		log.PanicIf(err)
+
+		ihdr := decoded.(*ChunkIHDR)
+
+		if options.MaxWidth > 0 && ihdr.Width > options.MaxWidth {
+			log.Panicf("%w: (%d) > (%d)", ErrImageTooWide, ihdr.Width, options.MaxWidth)
+		} else if options.MaxHeight > 0 && ihdr.Height > options.MaxHeight {
+			log.Panicf("%w: (%d) > (%d)", ErrImageTooTall, ihdr.Height, options.MaxHeight)
+		}
+
+		pixelCount := uint64(ihdr.Width) * uint64(ihdr.Height)
+		if options.MaxPixelCount > 0 && pixelCount > options.MaxPixelCount {
+			log.Panicf("%w: (%d) > (%d)", ErrTooManyPixels, pixelCount, options.MaxPixelCount)
+		}
+
+		if options.MaxImageDataSize > 0 {
+			size := ihdr.imageDataSize()
+			if size > uint64(options.MaxImageDataSize) {
+				log.Panicf("%w: (%d) > (%d)", ErrImageDataTooLarge, size, options.MaxImageDataSize)
+			}
+		}
+
+	case ZTXtChunkType, ITXtChunkType, ICCPChunkType:
+		if options.MaxInflatedSize == 0 {
+			return nil
+		}
+
+		err := c.Load()
+		log.PanicIf(err)
+
+		compressed, found := compressedPortion(c)
+		if found == true && inflatedSizeExceeds(compressed, options.MaxInflatedSize) == true {
+			log.Panicf("%w: [%s] inflates to more than (%d)", ErrInflatedChunkTooLarge, c.Type, options.MaxInflatedSize)
+		}
+	}
+
+	return nil
+}
+
+// imageDataSize returns the size of the inflated image data: every row (of
+// every pass, if interlaced) plus its filter-type byte.
+func (ihdr *ChunkIHDR) imageDataSize() uint64 {
+	bitsPerPixel := uint64(ihdr.BitsPerPixel())
+
+	rowsSize := func(width, height uint64) uint64 {
+		if width == 0 || height == 0 {
+			return 0
+		}
+
+		return height * (1 + (width*bitsPerPixel+7)/8)
+	}
+
+	if ihdr.InterlaceMethod != InterlaceMethodAdam7 {
+		return rowsSize(uint64(ihdr.Width), uint64(ihdr.Height))
+	}
+
+	size := uint64(0)
+	for _, pass := range Adam7Passes(int(ihdr.Width), int(ihdr.Height)) {
+		size += rowsSize(uint64(pass.Width), uint64(pass.Height))
+	}
+
+	return size
+}
+
+// imageDataReader inflates the image data but fails rather than inflating
+// more than the IHDR says that there is, so a decompression bomb can't be
+// read to the end.
+type imageDataReader struct {
+	zr        io.ReadCloser
+	size      uint64
+	remaining uint64
+}
+
+// Read returns `ErrImageDataTooLarge` if there is more data after what the
+// IHDR accounts for.
+func (idr *imageDataReader) Read(p []byte) (n int, err error) {
+	if idr.remaining == 0 {
+		extra := make([]byte, 1)
+
+		n, err := io.ReadFull(idr.zr, extra)
+		if n > 0 {
+			return 0, log.Errorf("%w: more than the (%d) bytes that the IHDR describes", ErrImageDataTooLarge, idr.size)
+		}
+
+		return 0, err
+	}
+
+	if uint64(len(p)) > idr.remaining {
+		p = p[:idr.remaining]
+	}
+
+	n, err = idr.zr.Read(p)
+	idr.remaining -= uint64(n)
+
+	return n, err
+}
+
+// Close closes the zlib reader.
+func (idr *imageDataReader) Close() error {
+	return idr.zr.Close()
+}
+
+// compressedPortion returns the compressed data of a zTXt, iTXt or iCCP
+// chunk. `found` is false if the chunk is malformed or (for iTXt) not
+// compressed; decoding will report the former.
+func compressedPortion(c *Chunk) (compressed []byte, found bool) {
+	_, rest, err := splitNull(c.Data)
+	if err != nil || len(rest) < 1 {
+		return nil, false
+	}
+
+	if c.Type != ITXtChunkType {
+		return rest[1:], true
+	}
+
+	if len(rest) < 2 || rest[0] != 1 {
+		return nil, false
+	}
+
+	_, rest, err = splitNull(rest[2:])
+	if err != nil {
+		return nil, false
+	}
+
+	_, text, err := splitNull(rest)
+	if err != nil {
+		return nil, false
+	}
+
+	return text, true
+}
+
+// inflatedSizeExceeds returns true if the zlib stream inflates to more than
+// `maxSize` bytes. No more than that is inflated. A corrupt stream is left for
+// decoding to report.
+func inflatedSizeExceeds(compressed []byte, maxSize int64) bool {
+	zr, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return false
+	}
+
+	defer zr.Close()
+
+	n, _ := io.CopyN(ioutil.Discard, zr, maxSize+1)
+
+	return n > maxSize
+}
+
+// SetParseOptions sets the limits that the parser enforces. Nil means no
+// limits besides what the specification requires.
+func (pmp *PngMediaParser) SetParseOptions(options *ParseOptions) {
+	pmp.options = options
+}
@@ -0,0 +1,233 @@
+package pngstructure
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"encoding/binary"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// getTestEncodedChunkSlice returns the PNG stream for the chunks.
+func getTestEncodedChunkSlice(cs *ChunkSlice) []byte {
+	b := new(bytes.Buffer)
+
+	err := cs.WriteTo(b)
+	log.PanicIf(err)
+
+	return b.Bytes()
+}
+
+// parseTestWithOptions parses the data with every parse entry-point and
+// returns the errors.
+func parseTestWithOptions(data []byte, options *ParseOptions) (errs map[string]error) {
+	pmp := NewPngMediaParser()
+	pmp.SetParseOptions(options)
+
+	errs = make(map[string]error)
+
+	_, errs["ParseBytes"] = pmp.ParseBytes(data)
+	_, errs["ParseReader"] = pmp.ParseReader(bytes.NewReader(data))
+	_, errs["ParseLazy"] = pmp.ParseLazy(bytes.NewReader(data), int64(len(data)))
+
+	return errs
+}
+
+func assertTestParseLimit(t *testing.T, data []byte, options *ParseOptions, expected error) {
+	for name, err := range parseTestWithOptions(data, options) {
+		if expected == nil && err != nil {
+			t.Fatalf("%s failed: [%v]", name, err)
+		} else if expected != nil && log.Is(err, expected) != true {
+			t.Fatalf("%s did not fail with [%v]: [%v]", name, expected, err)
+		}
+	}
+}
+
+func TestParseOptions_ChunkLength(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestGradientImage(40, 30))
+	data := getTestEncodedChunkSlice(cs)
+
+	idat := cs.Index()[IDATChunkType][0]
+
+	assertTestParseLimit(t, data, &ParseOptions{MaxChunkLength: idat.Length}, nil)
+	assertTestParseLimit(t, data, &ParseOptions{MaxChunkLength: idat.Length - 1}, ErrChunkTooLong)
+
+	// The specification's limit is always enforced. Claim a huge IDAT.
+	binary.BigEndian.PutUint32(data[idat.Offset:], MaxChunkLength+1)
+
+	assertTestParseLimit(t, data, nil, ErrChunkTooLong)
+}
+
+func TestParseOptions_ChunkCount(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestGradientImage(40, 30))
+
+	err := cs.RechunkImageData(10)
+	log.PanicIf(err)
+
+	data := getTestEncodedChunkSlice(cs)
+
+	count := len(cs.Chunks())
+	idatCount := len(cs.Index()[IDATChunkType])
+
+	assertTestParseLimit(t, data, &ParseOptions{MaxChunkCount: count}, nil)
+	assertTestParseLimit(t, data, &ParseOptions{MaxChunkCount: count - 1}, ErrTooManyChunks)
+
+	perType := map[string]int{IDATChunkType: idatCount}
+	assertTestParseLimit(t, data, &ParseOptions{MaxChunkCountPerType: perType}, nil)
+
+	perType[IDATChunkType] = idatCount - 1
+	assertTestParseLimit(t, data, &ParseOptions{MaxChunkCountPerType: perType}, ErrTooManyChunksOfType)
+}
+
+func TestParseOptions_Dimensions(t *testing.T) {
+	data := getTestEncodedChunkSlice(getTestImageChunkSlice(getTestGradientImage(40, 30)))
+
+	assertTestParseLimit(t, data, &ParseOptions{MaxWidth: 40, MaxHeight: 30, MaxPixelCount: 1200}, nil)
+	assertTestParseLimit(t, data, &ParseOptions{MaxWidth: 39}, ErrImageTooWide)
+	assertTestParseLimit(t, data, &ParseOptions{MaxHeight: 29}, ErrImageTooTall)
+	assertTestParseLimit(t, data, &ParseOptions{MaxPixelCount: 1199}, ErrTooManyPixels)
+}
+
+func TestParseOptions_ImageDataSize(t *testing.T) {
+	data := getTestEncodedChunkSlice(getTestImageChunkSlice(getTestGradientImage(40, 30)))
+
+	// Each row has a filter-type byte.
+	size := int64(30 * (1 + 40*4))
+
+	assertTestParseLimit(t, data, &ParseOptions{MaxImageDataSize: size}, nil)
+	assertTestParseLimit(t, data, &ParseOptions{MaxImageDataSize: size - 1}, ErrImageDataTooLarge)
+}
+
+func TestChunkIHDR_imageDataSize(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	ihdr, err := cs.decodeIhdr()
+	log.PanicIf(err)
+
+	if ihdr.InterlaceMethod != InterlaceMethodAdam7 {
+		t.Fatalf("test image not interlaced")
+	}
+
+	rc, err := cs.ImageData()
+	log.PanicIf(err)
+
+	defer rc.Close()
+
+	b := new(bytes.Buffer)
+
+	_, err = b.ReadFrom(rc)
+	log.PanicIf(err)
+
+	if ihdr.imageDataSize() != uint64(b.Len()) {
+		t.Fatalf("image data size not correct: (%d) != (%d)", ihdr.imageDataSize(), b.Len())
+	}
+}
+
+func TestChunkSlice_ImageData_Bomb(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestGradientImage(1, 1))
+
+	ihdr, err := cs.decodeIhdr()
+	log.PanicIf(err)
+
+	// The IHDR describes a few bytes, but the image data inflates to far
+	// more.
+	deflated, err := deflate(make([]byte, 10*1024*1024))
+	log.PanicIf(err)
+
+	cs.replaceIdat(splitIdat(deflated, defaultIdatChunkSize))
+
+	rc, err := cs.ImageData()
+	log.PanicIf(err)
+
+	defer rc.Close()
+
+	b := new(bytes.Buffer)
+
+	_, err = b.ReadFrom(rc)
+	if err == nil {
+		t.Fatalf("expected error for too much image data")
+	} else if log.Is(err, ErrImageDataTooLarge) != true {
+		t.Fatalf("expected ErrImageDataTooLarge: %v", err)
+	} else if uint64(b.Len()) != ihdr.imageDataSize() {
+		t.Fatalf("more than the IHDR describes was returned: (%d)", b.Len())
+	}
+
+	// Reading just the rows is fine.
+	_, rows, err := cs.PixelRows()
+	log.PanicIf(err)
+
+	if len(rows) != 1 || len(rows[0]) != ihdr.Stride(1) {
+		t.Fatalf("rows not correct")
+	}
+}
+
+func TestParseOptions_InflatedSize(t *testing.T) {
+	text := strings.Repeat("bomb ", 20000)
+
+	decodedChunks := []interface{}{
+		&ChunkCompressedText{
+			Keyword: "Comment",
+			Text:    text,
+		},
+		&ChunkInternationalText{
+			Keyword:    "Comment",
+			Compressed: true,
+			Text:       text,
+		},
+		&ChunkICCP{
+			ProfileName: "profile",
+			Profile:     []byte(text),
+		},
+	}
+
+	ce := NewChunkEncoder()
+
+	for _, decoded := range decodedChunks {
+		c, err := ce.Encode(decoded)
+		log.PanicIf(err)
+
+		cs := getTestImageChunkSlice(getTestGradientImage(4, 4))
+		cs.insertChunk(c, IDATChunkType)
+
+		data := getTestEncodedChunkSlice(cs)
+
+		assertTestParseLimit(t, data, &ParseOptions{MaxInflatedSize: int64(len(text))}, nil)
+		assertTestParseLimit(t, data, &ParseOptions{MaxInflatedSize: int64(len(text)) - 1}, ErrInflatedChunkTooLarge)
+	}
+}
+
+func TestPngMediaParser_ParseStream_Limits(t *testing.T) {
+	data := getTestEncodedChunkSlice(getTestImageChunkSlice(getTestGradientImage(4, 4)))
+
+	pmp := NewPngMediaParser()
+	pmp.SetParseOptions(&ParseOptions{MaxChunkCount: 2})
+
+	err := pmp.ParseStream(bytes.NewReader(data), func(sc *StreamedChunk) error {
+		return nil
+	})
+
+	if log.Is(err, ErrTooManyChunks) != true {
+		t.Fatalf("expected ErrTooManyChunks: [%v]", err)
+	}
+}
+
+func ExamplePngMediaParser_SetParseOptions() {
+	data := getTestEncodedChunkSlice(getTestImageChunkSlice(getTestGradientImage(40, 30)))
+
+	pmp := NewPngMediaParser()
+
+	pmp.SetParseOptions(&ParseOptions{
+		MaxPixelCount:    1000,
+		MaxInflatedSize:  1024 * 1024,
+		MaxImageDataSize: 64 * 1024 * 1024,
+	})
+
+	_, err := pmp.ParseBytes(data)
+	fmt.Printf("%v\n", log.Is(err, ErrTooManyPixels))
+
+	// Output:
+	// true
+}
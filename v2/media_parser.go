@@ -3,6 +3,7 @@ package pngstructure
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"image"
 	"io"
 	"os"
@@ -13,8 +14,16 @@ import (
 	"github.com/dsoprea/go-utility/v2/image"
 )
 
+var (
+	// ErrMaxSizeExceeded indicates that a stream is larger than the maximum
+	// that was set with `SetMaxSize`.
+	ErrMaxSizeExceeded = errors.New("stream larger than the maximum size")
+)
+
 // PngMediaParser knows how to parse a PNG stream.
 type PngMediaParser struct {
+	maxSize int64
+	options *ParseOptions
 }
 
 // NewPngMediaParser returns a new `PngMediaParser` struct.
@@ -36,6 +45,7 @@ func (pmp *PngMediaParser) Parse(rs io.ReadSeeker, size int) (mc riimage.MediaCo
 	// TODO(dustin): Add test
 
 	ps := NewPngSplitter()
+	ps.SetParseOptions(pmp.options)
 
 	err = ps.readHeader(rs)
 	log.PanicIf(err)
@@ -56,6 +66,58 @@ func (pmp *PngMediaParser) Parse(rs io.ReadSeeker, size int) (mc riimage.MediaCo
 	return ps.Chunks(), nil
 }
 
+// SetMaxSize sets the largest stream that `ParseReader` will accept. Zero (the
+// default) is unlimited.
+func (pmp *PngMediaParser) SetMaxSize(maxSize int64) {
+	pmp.maxSize = maxSize
+}
+
+// ParseReader parses a PNG stream that can't seek and whose size isn't known
+// ahead of time (e.g. an HTTP body or a pipe). Each chunk is read directly
+// into its own buffer, so, unlike `Parse`, the stream is never buffered as a
+// whole. If a maximum size was set, parsing stops with `ErrMaxSizeExceeded`
+// before a chunk that would exceed it is read.
+func (pmp *PngMediaParser) ParseReader(r io.Reader) (cs *ChunkSlice, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	csr, err := NewChunkStreamReader(r)
+	log.PanicIf(err)
+
+	csr.SetParseOptions(pmp.options)
+
+	chunks := make([]*Chunk, 0)
+	for {
+		sc, err := csr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		end := int64(sc.Offset) + 8 + int64(sc.Length) + 4
+		if pmp.maxSize > 0 && end > pmp.maxSize {
+			log.Panicf("%w: chunk [%s] ends at (%d) but the maximum is (%d)", ErrMaxSizeExceeded, sc.Type, end, pmp.maxSize)
+		}
+
+		c, err := sc.Chunk()
+		log.PanicIf(err)
+
+		err = csr.limiter.checkData(c)
+		if err != nil {
+			log.Panic(newChunkError(c.Offset, c.Type, len(chunks), err))
+		}
+
+		chunks = append(chunks, c)
+	}
+
+	// This fails if the first chunk isn't an IHDR.
+	return NewChunkSlice(chunks), nil
+}
+
 // ParseFile parses a PNG stream given a file-path.
 func (pmp *PngMediaParser) ParseFile(filepath string) (mc riimage.MediaContext, err error) {
 	defer func() {
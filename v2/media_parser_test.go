@@ -1,11 +1,14 @@
 package pngstructure
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"path"
 	"testing"
 
 	"io/ioutil"
+	"testing/iotest"
 
 	"github.com/dsoprea/go-logging"
 )
@@ -19,6 +22,69 @@ func TestPngMediaParser_ParseFile(t *testing.T) {
 	log.PanicIf(err)
 }
 
+// onlyReader hides everything but `Read` (e.g. `Seek`).
+type onlyReader struct {
+	r io.Reader
+}
+
+func (or onlyReader) Read(p []byte) (n int, err error) {
+	return or.r.Read(p)
+}
+
+func TestPngMediaParser_ParseReader(t *testing.T) {
+	data, err := ioutil.ReadFile(getTestBasicImageFilepath())
+	log.PanicIf(err)
+
+	pmp := NewPngMediaParser()
+
+	cs, err := pmp.ParseReader(onlyReader{iotest.OneByteReader(bytes.NewReader(data))})
+	log.PanicIf(err)
+
+	expected := getTestBasicChunkSlice().Chunks()
+	actual := cs.Chunks()
+
+	if len(actual) != len(expected) {
+		t.Fatalf("chunk count not correct: (%d) != (%d)", len(actual), len(expected))
+	}
+
+	for i, c := range actual {
+		e := expected[i]
+		if c.Type != e.Type || c.Offset != e.Offset || c.Length != e.Length || c.Crc != e.Crc || bytes.Equal(c.Data, e.Data) != true {
+			t.Fatalf("chunk (%d) not correct: %s != %s", i, c, e)
+		}
+	}
+}
+
+func TestPngMediaParser_ParseReader_MaxSize(t *testing.T) {
+	data, err := ioutil.ReadFile(getTestBasicImageFilepath())
+	log.PanicIf(err)
+
+	pmp := NewPngMediaParser()
+	pmp.SetMaxSize(int64(len(data)))
+
+	_, err = pmp.ParseReader(onlyReader{bytes.NewReader(data)})
+	log.PanicIf(err)
+
+	pmp.SetMaxSize(int64(len(data)) - 1)
+
+	_, err = pmp.ParseReader(onlyReader{bytes.NewReader(data)})
+	if log.Is(err, ErrMaxSizeExceeded) != true {
+		t.Fatalf("expected ErrMaxSizeExceeded: [%v]", err)
+	}
+}
+
+func TestPngMediaParser_ParseReader_Truncated(t *testing.T) {
+	data, err := ioutil.ReadFile(getTestBasicImageFilepath())
+	log.PanicIf(err)
+
+	pmp := NewPngMediaParser()
+
+	_, err = pmp.ParseReader(bytes.NewReader(data[:len(data)/2]))
+	if err == nil {
+		t.Fatalf("expected error for truncated stream")
+	}
+}
+
 func TestPngMediaParser_LooksLikeFormat(t *testing.T) {
 	filepath := path.Join(assetsPath, "libpng.png")
 
@@ -46,3 +112,21 @@ func ExamplePngMediaParser_LooksLikeFormat() {
 	// Output:
 	// true
 }
+
+func ExamplePngMediaParser_ParseReader() {
+	data, err := ioutil.ReadFile(getTestBasicImageFilepath())
+	log.PanicIf(err)
+
+	pmp := NewPngMediaParser()
+
+	// Refuse anything over 10MB.
+	pmp.SetMaxSize(10 * 1024 * 1024)
+
+	cs, err := pmp.ParseReader(bytes.NewReader(data))
+	log.PanicIf(err)
+
+	fmt.Printf("%s\n", cs.Chunks()[0].Type)
+
+	// Output:
+	// IHDR
+}
@@ -0,0 +1,19 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package pngstructure
+
+import (
+	"os"
+)
+
+// mmapFile is not supported on this platform. Returns nil so that the file is
+// read normally.
+func mmapFile(f *os.File, size int64) (mf *mappedFile, err error) {
+	return nil, nil
+}
+
+// munmap does nothing since nothing is ever mapped.
+func munmap(data []byte) error {
+	return nil
+}
@@ -0,0 +1,34 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package pngstructure
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// mmapFile maps the file into memory.
+func mmapFile(f *os.File, size int64) (mf *mappedFile, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	log.PanicIf(err)
+
+	mf = &mappedFile{
+		data: data,
+	}
+
+	return mf, nil
+}
+
+// munmap unmaps memory returned by `mmapFile`.
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
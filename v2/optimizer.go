@@ -0,0 +1,607 @@
+package pngstructure
+
+import (
+	"fmt"
+	"image"
+	"sort"
+
+	"compress/zlib"
+	"encoding/binary"
+	"image/color"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// AncillaryChunkPolicy determines which ancillary chunks the optimizer keeps.
+type AncillaryChunkPolicy int
+
+const (
+	// AncillaryChunkPolicyKeep keeps every ancillary chunk that is still
+	// valid after optimizing.
+	AncillaryChunkPolicyKeep AncillaryChunkPolicy = iota
+
+	// AncillaryChunkPolicyStripMetadata also removes the text, EXIF and
+	// modification-time chunks.
+	AncillaryChunkPolicyStripMetadata
+
+	// AncillaryChunkPolicyStripAll removes every ancillary chunk except the
+	// ones that determine how the image looks (tRNS and the color-space
+	// chunks) and the APNG chunks.
+	AncillaryChunkPolicyStripAll
+)
+
+var (
+	// metadataChunkTypes are the chunks that
+	// `AncillaryChunkPolicyStripMetadata` removes.
+	metadataChunkTypes = map[string]bool{
+		TEXtChunkType: true,
+		ZTXtChunkType: true,
+		ITXtChunkType: true,
+		EXifChunkType: true,
+		TIMEChunkType: true,
+	}
+
+	// appearanceChunkTypes are the ancillary chunks that
+	// `AncillaryChunkPolicyStripAll` keeps (in addition to the color-space
+	// chunks).
+	appearanceChunkTypes = map[string]bool{
+		TRNSChunkType: true,
+		ACTLChunkType: true,
+		FCTLChunkType: true,
+		FDATChunkType: true,
+	}
+)
+
+// OptimizeOptions controls what the optimizer tries. Every combination of
+// encoding, filter strategy and compression level is tried and the smallest
+// is kept. `compress/flate` always uses a 32K window, so, unlike optipng, the
+// window size is not varied.
+type OptimizeOptions struct {
+	FilterStrategies []FilterStrategy
+
+	// CompressionLevels are `compress/zlib` levels and are used as given
+	// (zero is `zlib.NoCompression`).
+	CompressionLevels []int
+
+	// ReduceColorType allows RGBA to RGB (and gray+alpha to gray) when every
+	// pixel is opaque, truecolor to grayscale when every pixel is gray, and
+	// truecolor to indexed when there are at most 256 colors.
+	ReduceColorType bool
+
+	// ReduceBitDepth allows 16-bit to 8-bit when every low byte is the same
+	// as its high byte.
+	ReduceBitDepth bool
+
+	AncillaryChunkPolicy AncillaryChunkPolicy
+}
+
+// DefaultOptimizeOptions returns options that try every filter strategy
+// except brute force, default and best compression, and every reduction,
+// while keeping the ancillary chunks.
+func DefaultOptimizeOptions() *OptimizeOptions {
+	return &OptimizeOptions{
+		FilterStrategies: []FilterStrategy{
+			FilterStrategyNone,
+			FilterStrategySub,
+			FilterStrategyUp,
+			FilterStrategyAverage,
+			FilterStrategyPaeth,
+			FilterStrategyAdaptive,
+		},
+		CompressionLevels: []int{
+			zlib.DefaultCompression,
+			zlib.BestCompression,
+		},
+		ReduceColorType:      true,
+		ReduceBitDepth:       true,
+		AncillaryChunkPolicy: AncillaryChunkPolicyKeep,
+	}
+}
+
+// OptimizationReport describes the result of optimizing.
+type OptimizationReport struct {
+	OriginalSize  int
+	OptimizedSize int
+
+	// ColorType and BitDepth are the encoding that was chosen.
+	ColorType uint8
+	BitDepth  uint8
+
+	FilterStrategy   FilterStrategy
+	CompressionLevel int
+
+	// IsImageDataChanged is false if nothing that was tried improved on the
+	// original image data (though chunks may still have been stripped).
+	IsImageDataChanged bool
+
+	// RemovedChunkTypes are the types of the chunks that were removed.
+	RemovedChunkTypes []string
+}
+
+func (or *OptimizationReport) String() string {
+	return fmt.Sprintf("OptimizationReport<ORIGINAL=(%d) OPTIMIZED=(%d) SAVED=(%d)>", or.OriginalSize, or.OptimizedSize, or.BytesSaved())
+}
+
+// BytesSaved returns how much smaller the file is.
+func (or *OptimizationReport) BytesSaved() int {
+	return or.OriginalSize - or.OptimizedSize
+}
+
+// encodedSize returns the size of the PNG stream.
+func (cs *ChunkSlice) encodedSize() int {
+	size := len(PngSignature)
+	for _, c := range cs.chunks {
+		size += 12 + int(c.Length)
+	}
+
+	return size
+}
+
+// optimizationCandidate is one lossless encoding of the pixels.
+type optimizationCandidate struct {
+	ihdr *ChunkIHDR
+	rows [][]byte
+
+	// plte and trns are nil if not required.
+	plte *ChunkPLTE
+	trns *ChunkTRNS
+
+	// isOriginal is true for the encoding that the image already has (whose
+	// PLTE and tRNS chunks are kept as they are).
+	isOriginal bool
+}
+
+// exactNRGBA64 converts a color produced by `ChunkSlice.Image` without the
+// rounding that going through premultiplied alpha would introduce.
+func exactNRGBA64(c color.Color) color.NRGBA64 {
+	switch t := c.(type) {
+	case color.NRGBA:
+		return color.NRGBA64{uint16(t.R) * 0x101, uint16(t.G) * 0x101, uint16(t.B) * 0x101, uint16(t.A) * 0x101}
+	case color.NRGBA64:
+		return t
+	case color.Gray:
+		v := uint16(t.Y) * 0x101
+		return color.NRGBA64{v, v, v, 0xffff}
+	case color.Gray16:
+		return color.NRGBA64{t.Y, t.Y, t.Y, 0xffff}
+	}
+
+	// Everything else that we produce is opaque, so there is no rounding.
+	return color.NRGBA64Model.Convert(c).(color.NRGBA64)
+}
+
+// is8Bit returns true if the 16-bit sample has no more information than its
+// high byte.
+func is8Bit(value uint16) bool {
+	return value>>8 == value&0xff
+}
+
+// reducedCandidates returns the smallest truecolor/grayscale encoding and, if
+// there are few enough colors, an indexed encoding.
+func reducedCandidates(img image.Image, options *OptimizeOptions, original *ChunkIHDR) (candidates []*optimizationCandidate) {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	pixels := make([]color.NRGBA64, width*height)
+
+	isOpaque := true
+	isGray := true
+	isAll8Bit := true
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := exactNRGBA64(img.At(bounds.Min.X+x, bounds.Min.Y+y))
+			pixels[y*width+x] = c
+
+			if c.A != 0xffff {
+				isOpaque = false
+			}
+
+			if c.R != c.G || c.G != c.B {
+				isGray = false
+			}
+
+			if is8Bit(c.R) == false || is8Bit(c.G) == false || is8Bit(c.B) == false || is8Bit(c.A) == false {
+				isAll8Bit = false
+			}
+		}
+	}
+
+	hasAlpha := original.ColorType == ColorTypeRgba || original.ColorType == ColorTypeGrayscaleAlpha || isOpaque == false
+	isTruecolor := original.ColorType == ColorTypeRgb || original.ColorType == ColorTypeRgba || original.ColorType == ColorTypeIndexed
+
+	if options.ReduceColorType == true {
+		hasAlpha = isOpaque == false
+		isTruecolor = isGray == false
+	} else if original.ColorType == ColorTypeIndexed || (hasAlpha == true && original.ColorType != ColorTypeRgba && original.ColorType != ColorTypeGrayscaleAlpha) {
+		// Only the bit-depth may change, and there is no way to express a
+		// palette or a tRNS color-key with fewer bits.
+		return nil
+	}
+
+	bitDepth := uint8(8)
+	if original.BitDepth == 16 && (options.ReduceBitDepth == false || isAll8Bit == false) {
+		bitDepth = 16
+	}
+
+	var colorType uint8
+	switch {
+	case isTruecolor == true && hasAlpha == true:
+		colorType = ColorTypeRgba
+	case isTruecolor == true:
+		colorType = ColorTypeRgb
+	case hasAlpha == true:
+		colorType = ColorTypeGrayscaleAlpha
+	default:
+		colorType = ColorTypeGrayscale
+	}
+
+	// The original is already covered, and a grayscale original below eight
+	// bits is already smaller than anything that we would produce here.
+	isSameEncoding := colorType == original.ColorType && bitDepth == original.BitDepth
+	isPackedGray := original.ColorType == ColorTypeGrayscale && original.BitDepth < 8
+
+	if isSameEncoding == false && isPackedGray == false {
+		candidate := &optimizationCandidate{
+			ihdr: &ChunkIHDR{
+				Width:           original.Width,
+				Height:          original.Height,
+				BitDepth:        bitDepth,
+				ColorType:       colorType,
+				InterlaceMethod: original.InterlaceMethod,
+			},
+		}
+
+		channels := channelCounts[colorType]
+		stride := candidate.ihdr.Stride(width)
+
+		candidate.rows = make([][]byte, height)
+		for y := range candidate.rows {
+			row := make([]byte, stride)
+
+			for x := 0; x < width; x++ {
+				c := pixels[y*width+x]
+
+				var samples []uint16
+				switch colorType {
+				case ColorTypeGrayscale:
+					samples = []uint16{c.R}
+				case ColorTypeGrayscaleAlpha:
+					samples = []uint16{c.R, c.A}
+				case ColorTypeRgb:
+					samples = []uint16{c.R, c.G, c.B}
+				default:
+					samples = []uint16{c.R, c.G, c.B, c.A}
+				}
+
+				for i, sample := range samples {
+					if bitDepth == 16 {
+						binary.BigEndian.PutUint16(row[(x*channels+i)*2:], sample)
+					} else {
+						row[x*channels+i] = uint8(sample >> 8)
+					}
+				}
+			}
+
+			candidate.rows[y] = row
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	if options.ReduceColorType == false || isAll8Bit == false || original.ColorType == ColorTypeIndexed {
+		return candidates
+	}
+
+	// Collect the colors, giving up once there are too many for a palette.
+
+	indices := make(map[color.NRGBA64]int)
+	for _, c := range pixels {
+		if _, found := indices[c]; found == false {
+			if len(indices) == maxPaletteEntries {
+				return candidates
+			}
+
+			indices[c] = len(indices)
+		}
+	}
+
+	// Put the translucent entries first so that the tRNS is as short as
+	// possible, and otherwise keep the order stable.
+
+	colors := make([]color.NRGBA64, len(indices))
+	for c, i := range indices {
+		colors[i] = c
+	}
+
+	sort.SliceStable(colors, func(i, j int) bool {
+		return colors[i].A != 0xffff && colors[j].A == 0xffff
+	})
+
+	palette := make(color.Palette, len(colors))
+	alphas := make([]uint8, 0)
+
+	for i, c := range colors {
+		palette[i] = color.RGBA{uint8(c.R >> 8), uint8(c.G >> 8), uint8(c.B >> 8), 0xff}
+		indices[c] = i
+
+		if c.A != 0xffff {
+			alphas = append(alphas, uint8(c.A>>8))
+		}
+	}
+
+	paletteBitDepth := uint8(8)
+	switch {
+	case len(palette) <= 2:
+		paletteBitDepth = 1
+	case len(palette) <= 4:
+		paletteBitDepth = 2
+	case len(palette) <= 16:
+		paletteBitDepth = 4
+	}
+
+	candidate := &optimizationCandidate{
+		ihdr: &ChunkIHDR{
+			Width:           original.Width,
+			Height:          original.Height,
+			BitDepth:        paletteBitDepth,
+			ColorType:       ColorTypeIndexed,
+			InterlaceMethod: original.InterlaceMethod,
+		},
+		plte: &ChunkPLTE{
+			Palette: palette,
+		},
+	}
+
+	if len(alphas) > 0 {
+		candidate.trns = &ChunkTRNS{
+			ColorType: ColorTypeIndexed,
+			Alphas:    alphas,
+		}
+	}
+
+	stride := candidate.ihdr.Stride(width)
+
+	candidate.rows = make([][]byte, height)
+	for y := range candidate.rows {
+		row := make([]byte, stride)
+
+		for x := 0; x < width; x++ {
+			index := uint8(indices[pixels[y*width+x]])
+			copyPixel(row, x, []byte{index << (8 - paletteBitDepth)}, 0, int(paletteBitDepth))
+		}
+
+		candidate.rows[y] = row
+	}
+
+	candidates = append(candidates, candidate)
+
+	return candidates
+}
+
+// Optimize losslessly re-encodes the image as small as it can. If the
+// encoding (color-type or bit-depth) changes, the chunks that are unsafe to
+// copy are dropped as `SetImage` would. An image with an iCCP, cHRM or cICP
+// chunk is not switched between grayscale and color, since those chunks are
+// written for one or the other. Animated images are only recompressed since
+// the frames share the encoding of the default image.
+func (cs *ChunkSlice) Optimize(options *OptimizeOptions) (report *OptimizationReport, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if options == nil {
+		options = DefaultOptimizeOptions()
+	}
+
+	if len(options.FilterStrategies) == 0 || len(options.CompressionLevels) == 0 {
+		log.Panicf("at least one filter strategy and compression level is required")
+	}
+
+	report = &OptimizationReport{
+		OriginalSize:      cs.encodedSize(),
+		RemovedChunkTypes: make([]string, 0),
+	}
+
+	removeChunks := func(filter func(c *Chunk) bool) {
+		cs.removeChunks(func(c *Chunk) bool {
+			if filter(c) == true {
+				report.RemovedChunkTypes = append(report.RemovedChunkTypes, c.Type)
+				return true
+			}
+
+			return false
+		})
+	}
+
+	// The chunks are only stripped once everything that can fail has
+	// succeeded so that the image is left alone on error.
+
+	var isStripped func(c *Chunk) bool
+
+	switch options.AncillaryChunkPolicy {
+	case AncillaryChunkPolicyKeep:
+
+	case AncillaryChunkPolicyStripMetadata:
+		isStripped = func(c *Chunk) bool {
+			return metadataChunkTypes[c.Type] == true
+		}
+
+	case AncillaryChunkPolicyStripAll:
+		isStripped = func(c *Chunk) bool {
+			return c.IsCritical() == false && appearanceChunkTypes[c.Type] == false && colorSpaceChunkTypes[c.Type] == false
+		}
+
+	default:
+		log.Panicf("ancillary chunk policy not valid: (%d)", options.AncillaryChunkPolicy)
+	}
+
+	ihdr, rows, err := cs.PixelRows()
+	log.PanicIf(err)
+
+	candidates := []*optimizationCandidate{
+		{
+			ihdr:       ihdr,
+			rows:       rows,
+			isOriginal: true,
+		},
+	}
+
+	_, isAnimated := cs.Index()[ACTLChunkType]
+
+	if isAnimated == false && (options.ReduceColorType == true || options.ReduceBitDepth == true) {
+		img, err := cs.Image()
+		log.PanicIf(err)
+
+		// An ICC profile (or cHRM or cICP) is written for either grayscale
+		// or color, so don't switch between the two if there is one.
+		hasColorModelChunk := false
+		for _, c := range cs.chunks {
+			if colorModelChunkTypes[c.Type] == true {
+				hasColorModelChunk = true
+				break
+			}
+		}
+
+		for _, candidate := range reducedCandidates(img, options, ihdr) {
+			if hasColorModelChunk == true && isGrayColorType(candidate.ihdr.ColorType) != isGrayColorType(ihdr.ColorType) {
+				continue
+			}
+
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	// Find the smallest combination. The PLTE and tRNS count towards the
+	// size.
+
+	ce := NewChunkEncoder()
+
+	idatSize := 0
+	for _, c := range cs.chunks {
+		if c.Type == IDATChunkType {
+			idatSize += 12 + int(c.Length)
+		}
+	}
+
+	bestSize := -1
+	var best *optimizationCandidate
+	var bestDeflated []byte
+
+	for _, candidate := range candidates {
+		overhead := 0
+		if candidate.isOriginal == false {
+			decodedChunks := make([]interface{}, 0)
+			if candidate.plte != nil {
+				decodedChunks = append(decodedChunks, candidate.plte)
+			}
+
+			if candidate.trns != nil {
+				decodedChunks = append(decodedChunks, candidate.trns)
+			}
+
+			for _, decoded := range decodedChunks {
+				c, err := ce.Encode(decoded)
+				log.PanicIf(err)
+
+				overhead += 12 + int(c.Length)
+			}
+
+			for _, type_ := range []string{PLTEChunkType, TRNSChunkType} {
+				for _, c := range cs.Index()[type_] {
+					overhead -= 12 + int(c.Length)
+				}
+			}
+		}
+
+		for _, strategy := range options.FilterStrategies {
+			data, err := encodeImageData(candidate.ihdr, candidate.rows, strategy)
+			log.PanicIf(err)
+
+			for _, level := range options.CompressionLevels {
+				deflated, err := deflateLevel(data, level)
+				log.PanicIf(err)
+
+				// The deflated data will be split into IDATs of the default
+				// size.
+				chunkCount := (len(deflated) + defaultIdatChunkSize - 1) / defaultIdatChunkSize
+				size := len(deflated) + 12*chunkCount + overhead
+
+				if bestSize == -1 || size < bestSize {
+					best = candidate
+					bestSize = size
+					bestDeflated = deflated
+
+					report.FilterStrategy = strategy
+					report.CompressionLevel = level
+				}
+			}
+		}
+	}
+
+	var ihdrChunk *Chunk
+	newChunks := make([]*Chunk, 0)
+
+	if bestSize < idatSize && best.isOriginal == false {
+		ihdrChunk, err = ce.Encode(best.ihdr)
+		log.PanicIf(err)
+
+		// PLTE must come before tRNS.
+		if best.plte != nil {
+			c, err := ce.Encode(best.plte)
+			log.PanicIf(err)
+
+			newChunks = append(newChunks, c)
+		}
+
+		if best.trns != nil {
+			c, err := ce.Encode(best.trns)
+			log.PanicIf(err)
+
+			newChunks = append(newChunks, c)
+		}
+	}
+
+	// Nothing can fail from here on.
+
+	if isStripped != nil {
+		removeChunks(isStripped)
+	}
+
+	report.ColorType = ihdr.ColorType
+	report.BitDepth = ihdr.BitDepth
+
+	if bestSize < idatSize {
+		report.IsImageDataChanged = true
+		report.ColorType = best.ihdr.ColorType
+		report.BitDepth = best.ihdr.BitDepth
+
+		if best.isOriginal == false {
+			removeChunks(func(c *Chunk) bool {
+				switch c.Type {
+				case IHDRChunkType, IDATChunkType, IENDChunkType:
+					return false
+				case PLTEChunkType, TRNSChunkType:
+					return true
+				}
+
+				return c.IsCritical() == false && c.IsSafeToCopy() == false && colorSpaceChunkTypes[c.Type] == false
+			})
+
+			cs.chunks[0] = ihdrChunk
+
+			for _, c := range newChunks {
+				cs.insertChunk(c, IDATChunkType)
+			}
+		}
+
+		cs.replaceIdat(splitIdat(bestDeflated, defaultIdatChunkSize))
+	}
+
+	report.OptimizedSize = cs.encodedSize()
+
+	return report, nil
+}
@@ -0,0 +1,330 @@
+package pngstructure
+
+import (
+	"fmt"
+	"image"
+	"reflect"
+	"testing"
+
+	"compress/zlib"
+	"image/color"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// getTestReducibleImage returns a 16-bit, opaque image that only has a few
+// shades of gray.
+func getTestReducibleImage(width, height int) *image.NRGBA64 {
+	img := image.NewNRGBA64(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint16((x/4+y/4)%3) * 0x4040
+			img.SetNRGBA64(x, y, color.NRGBA64{v, v, v, 0xffff})
+		}
+	}
+
+	return img
+}
+
+func TestChunkSlice_Optimize(t *testing.T) {
+	img := getTestGradientImage(40, 30)
+	cs := getTestImageChunkSlice(img)
+
+	report, err := cs.Optimize(nil)
+	log.PanicIf(err)
+
+	if report.OriginalSize <= 0 || report.OptimizedSize > report.OriginalSize {
+		t.Fatalf("sizes not correct: %s", report)
+	} else if report.OptimizedSize != cs.encodedSize() {
+		t.Fatalf("optimized size not correct: (%d) != (%d)", report.OptimizedSize, cs.encodedSize())
+	} else if report.ColorType != ColorTypeRgba || report.BitDepth != 8 {
+		t.Fatalf("encoding should not have changed: (%d) (%d)", report.ColorType, report.BitDepth)
+	}
+
+	assertTestImagesEqual(t, decodeTestChunkSlice(cs), img)
+}
+
+func TestChunkSlice_Optimize_Reduce(t *testing.T) {
+	img := getTestReducibleImage(64, 64)
+	cs := getTestImageChunkSlice(img)
+
+	ihdr, err := cs.decodeIhdr()
+	log.PanicIf(err)
+
+	if ihdr.ColorType != ColorTypeRgb || ihdr.BitDepth != 16 {
+		t.Fatalf("test image not encoded as expected: %s", ihdr)
+	}
+
+	report, err := cs.Optimize(nil)
+	log.PanicIf(err)
+
+	if report.IsImageDataChanged != true || report.BytesSaved() <= 0 {
+		t.Fatalf("image not optimized: %s", report)
+	}
+
+	ihdr, err = cs.decodeIhdr()
+	log.PanicIf(err)
+
+	if ihdr.BitDepth >= 8 || (ihdr.ColorType != ColorTypeIndexed && ihdr.ColorType != ColorTypeGrayscale) {
+		t.Fatalf("encoding not reduced: %s", ihdr)
+	} else if ihdr.ColorType != report.ColorType || ihdr.BitDepth != report.BitDepth {
+		t.Fatalf("report does not match IHDR: %s", ihdr)
+	}
+
+	assertTestImageMatchesStandard(t, cs)
+	assertTestImagesEqual(t, decodeTestChunkSlice(cs), img)
+}
+
+func TestChunkSlice_Optimize_IccProfile(t *testing.T) {
+	// Too many shades for a palette, so only grayscale would be smaller.
+	img := image.NewNRGBA64(image.Rect(0, 0, 40, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			v := uint16(x*1000 + y*77)
+			img.SetNRGBA64(x, y, color.NRGBA64{v, v, v, 0xffff})
+		}
+	}
+
+	for _, hasProfile := range []bool{false, true} {
+		cs := getTestImageChunkSlice(img)
+
+		if hasProfile == true {
+			err := cs.SetIccProfile("Test profile", getTestIccProfile())
+			log.PanicIf(err)
+		}
+
+		_, err := cs.Optimize(nil)
+		log.PanicIf(err)
+
+		ihdr, err := cs.decodeIhdr()
+		log.PanicIf(err)
+
+		if hasProfile == false {
+			if ihdr.ColorType != ColorTypeGrayscale {
+				t.Fatalf("image not reduced to grayscale: %s", ihdr)
+			}
+
+			continue
+		}
+
+		if ihdr.ColorType != ColorTypeRgb {
+			t.Fatalf("RGB profile should prevent grayscale: %s", ihdr)
+		} else if _, found := cs.Index()[ICCPChunkType]; found == false {
+			t.Fatalf("iCCP not kept")
+		}
+
+		assertTestImagesEqual(t, decodeTestChunkSlice(cs), img)
+	}
+}
+
+func TestChunkSlice_Optimize_Palette_Translucent(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 30, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 30; x++ {
+			c := color.NRGBA{0xff, 0, 0, 0xff}
+			if (x+y)%5 == 0 {
+				c = color.NRGBA{0, 0xff, 0, 0x80}
+			} else if x == y {
+				c = color.NRGBA{0, 0, 0, 0}
+			}
+
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	cs := getTestImageChunkSlice(img)
+
+	_, err := cs.Optimize(nil)
+	log.PanicIf(err)
+
+	ihdr, err := cs.decodeIhdr()
+	log.PanicIf(err)
+
+	if ihdr.ColorType != ColorTypeIndexed || ihdr.BitDepth != 2 {
+		t.Fatalf("image not converted to a palette: %s", ihdr)
+	}
+
+	// The translucent entries come first.
+	trns := cs.Index()[TRNSChunkType]
+	if len(trns) != 1 || len(trns[0].Data) != 2 {
+		t.Fatalf("tRNS not correct")
+	}
+
+	assertTestImageMatchesStandard(t, cs)
+	assertTestImagesEqual(t, decodeTestChunkSlice(cs), img)
+}
+
+func TestChunkSlice_Optimize_NoReductions(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestReducibleImage(64, 64))
+
+	options := DefaultOptimizeOptions()
+	options.ReduceColorType = false
+	options.ReduceBitDepth = false
+
+	report, err := cs.Optimize(options)
+	log.PanicIf(err)
+
+	ihdr, err := cs.decodeIhdr()
+	log.PanicIf(err)
+
+	if ihdr.ColorType != ColorTypeRgb || ihdr.BitDepth != 16 {
+		t.Fatalf("encoding changed: %s", ihdr)
+	} else if report.OptimizedSize > report.OriginalSize {
+		t.Fatalf("image got bigger: %s", report)
+	}
+
+	// Only the bit-depth.
+	options.ReduceBitDepth = true
+
+	_, err = cs.Optimize(options)
+	log.PanicIf(err)
+
+	ihdr, err = cs.decodeIhdr()
+	log.PanicIf(err)
+
+	if ihdr.ColorType != ColorTypeRgb || ihdr.BitDepth != 8 {
+		t.Fatalf("bit-depth not reduced: %s", ihdr)
+	}
+}
+
+func TestChunkSlice_Optimize_NeverGrows(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestGradientImage(20, 20))
+
+	_, err := cs.Optimize(nil)
+	log.PanicIf(err)
+
+	before := cs.encodedSize()
+
+	// Nothing is better than what we already have.
+	options := DefaultOptimizeOptions()
+	options.FilterStrategies = []FilterStrategy{FilterStrategyNone}
+	options.CompressionLevels = []int{zlib.NoCompression}
+
+	report, err := cs.Optimize(options)
+	log.PanicIf(err)
+
+	if report.IsImageDataChanged != false {
+		t.Fatalf("image data should not have changed")
+	} else if cs.encodedSize() != before || report.BytesSaved() != 0 {
+		t.Fatalf("size changed: %s", report)
+	}
+}
+
+func TestChunkSlice_Optimize_AncillaryChunkPolicy(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	options := DefaultOptimizeOptions()
+	options.AncillaryChunkPolicy = AncillaryChunkPolicyStripMetadata
+
+	report, err := cs.Optimize(options)
+	log.PanicIf(err)
+
+	index := cs.Index()
+	for type_ := range metadataChunkTypes {
+		if _, found := index[type_]; found == true {
+			t.Fatalf("chunk [%s] not stripped", type_)
+		}
+	}
+
+	if _, found := index[PHYSChunkType]; found == false {
+		t.Fatalf("pHYs should have been kept")
+	} else if len(report.RemovedChunkTypes) == 0 {
+		t.Fatalf("removed chunks not reported")
+	}
+
+	options.AncillaryChunkPolicy = AncillaryChunkPolicyStripAll
+
+	_, err = cs.Optimize(options)
+	log.PanicIf(err)
+
+	for _, c := range cs.Chunks() {
+		if c.IsCritical() == false && appearanceChunkTypes[c.Type] == false && colorSpaceChunkTypes[c.Type] == false {
+			t.Fatalf("chunk [%s] not stripped", c.Type)
+		}
+	}
+
+	if _, found := cs.Index()[GAMAChunkType]; found == false {
+		t.Fatalf("gAMA should have been kept")
+	}
+
+	ihdr, err := cs.decodeIhdr()
+	log.PanicIf(err)
+
+	if ihdr.InterlaceMethod != InterlaceMethodAdam7 {
+		t.Fatalf("interlace-method not kept")
+	}
+
+	assertTestImageMatchesStandard(t, cs)
+}
+
+func TestChunkSlice_Optimize_Error_ChunksKept(t *testing.T) {
+	cs := getTestBasicChunkSlice()
+
+	// Corrupt the image data so that the pixels can't be read.
+	cs.replaceIdat(splitIdat([]byte("not deflated"), defaultIdatChunkSize))
+
+	original := make([]*Chunk, len(cs.Chunks()))
+	copy(original, cs.Chunks())
+
+	options := DefaultOptimizeOptions()
+	options.AncillaryChunkPolicy = AncillaryChunkPolicyStripAll
+
+	_, err := cs.Optimize(options)
+	if err == nil {
+		t.Fatalf("expected error for corrupt image data")
+	} else if reflect.DeepEqual(cs.Chunks(), original) != true {
+		t.Fatalf("chunks changed on error")
+	}
+}
+
+func TestChunkSlice_Optimize_Animated(t *testing.T) {
+	cs := getTestAnimatedChunkSlice()
+
+	ihdr, err := cs.decodeIhdr()
+	log.PanicIf(err)
+
+	_, err = cs.Optimize(nil)
+	log.PanicIf(err)
+
+	optimizedIhdr, err := cs.decodeIhdr()
+	log.PanicIf(err)
+
+	if optimizedIhdr.ColorType != ihdr.ColorType || optimizedIhdr.BitDepth != ihdr.BitDepth {
+		t.Fatalf("encoding of animated image changed: %s", optimizedIhdr)
+	}
+
+	err = cs.ValidateAnimation()
+	log.PanicIf(err)
+}
+
+func TestChunkSlice_Optimize_InvalidOptions(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestGradientImage(4, 4))
+
+	options := DefaultOptimizeOptions()
+	options.CompressionLevels = nil
+
+	_, err := cs.Optimize(options)
+	if err == nil {
+		t.Fatalf("expected error for no compression levels")
+	}
+
+	options = DefaultOptimizeOptions()
+	options.AncillaryChunkPolicy = AncillaryChunkPolicy(99)
+
+	_, err = cs.Optimize(options)
+	if err == nil {
+		t.Fatalf("expected error for policy")
+	}
+}
+
+func ExampleChunkSlice_Optimize() {
+	cs := getTestImageChunkSlice(getTestReducibleImage(64, 64))
+
+	report, err := cs.Optimize(nil)
+	log.PanicIf(err)
+
+	fmt.Printf("smaller: %v\n", report.BytesSaved() > 0)
+
+	// Output:
+	// smaller: true
+}
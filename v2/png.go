@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"encoding/binary"
 	"hash/crc32"
@@ -19,6 +20,37 @@ var (
 	PngSignature  = [8]byte{137, 'P', 'N', 'G', '\r', '\n', 26, '\n'}
 	EXifChunkType = "eXIf"
 	IHDRChunkType = "IHDR"
+	IDATChunkType = "IDAT"
+	IENDChunkType = "IEND"
+	TEXtChunkType = "tEXt"
+	ZTXtChunkType = "zTXt"
+	ITXtChunkType = "iTXt"
+	ICCPChunkType = "iCCP"
+	SRGBChunkType = "sRGB"
+	PLTEChunkType = "PLTE"
+	GAMAChunkType = "gAMA"
+	CHRMChunkType = "cHRM"
+	CICPChunkType = "cICP"
+	MDCVChunkType = "mDCv"
+	CLLIChunkType = "cLLi"
+	TRNSChunkType = "tRNS"
+	BKGDChunkType = "bKGD"
+	HISTChunkType = "hIST"
+	SPLTChunkType = "sPLT"
+	PHYSChunkType = "pHYs"
+	OFFSChunkType = "oFFs"
+	SCALChunkType = "sCAL"
+	PCALChunkType = "pCAL"
+	TIMEChunkType = "tIME"
+	SBITChunkType = "sBIT"
+	ACTLChunkType = "acTL"
+	FCTLChunkType = "fcTL"
+	FDATChunkType = "fdAT"
+)
+
+const (
+	// MaxChunkLength is the largest data length that a chunk may have.
+	MaxChunkLength = 1<<31 - 1
 )
 
 var (
@@ -29,6 +61,8 @@ var (
 // ChunkSlice encapsulates a slice of chunks.
 type ChunkSlice struct {
 	chunks []*Chunk
+
+	doUpdateModificationTime bool
 }
 
 func NewChunkSlice(chunks []*Chunk) *ChunkSlice {
@@ -71,6 +105,11 @@ func (cs *ChunkSlice) WriteTo(w io.Writer) (err error) {
 		}
 	}()
 
+	if cs.doUpdateModificationTime == true {
+		err := cs.SetModificationTime(time.Now())
+		log.PanicIf(err)
+	}
+
 	_, err = w.Write(PngSignature[:])
 	log.PanicIf(err)
 
@@ -83,6 +122,12 @@ func (cs *ChunkSlice) WriteTo(w io.Writer) (err error) {
 	return nil
 }
 
+// DoUpdateModificationTime sets whether `WriteTo` should stamp the current
+// time into the tIME chunk (like libpng does).
+func (cs *ChunkSlice) DoUpdateModificationTime(doUpdate bool) {
+	cs.doUpdateModificationTime = doUpdate
+}
+
 // Index returns a map of chunk types to chunk slices, grouping all like chunks.
 func (cs *ChunkSlice) Index() (index map[string][]*Chunk) {
 	index = make(map[string][]*Chunk)
@@ -97,6 +142,89 @@ func (cs *ChunkSlice) Index() (index map[string][]*Chunk) {
 	return index
 }
 
+// insertChunk inserts the given chunk immediately before the first chunk
+// having one of the given types. If none of those are present, it is inserted
+// before the IEND chunk or, failing that, at the end.
+func (cs *ChunkSlice) insertChunk(c *Chunk, beforeTypes ...string) {
+	beforeTypes = append(beforeTypes, IENDChunkType)
+
+	for i, existing := range cs.chunks {
+		for _, type_ := range beforeTypes {
+			if existing.Type == type_ {
+				cs.insertChunkAt(c, i)
+				return
+			}
+		}
+	}
+
+	cs.chunks = append(cs.chunks, c)
+}
+
+// insertChunkAt inserts the given chunk at the given position.
+func (cs *ChunkSlice) insertChunkAt(c *Chunk, i int) {
+	cs.chunks = append(cs.chunks[:i], append([]*Chunk{c}, cs.chunks[i:]...)...)
+}
+
+// replaceChunk replaces the first chunk of the same type (and drops any others
+// of that type) or, if there aren't any, inserts it as `insertChunk` would.
+func (cs *ChunkSlice) replaceChunk(c *Chunk, beforeTypes ...string) {
+	cs.replaceMatchingChunks(c, func(existing *Chunk) bool {
+		return existing.Type == c.Type
+	}, beforeTypes...)
+}
+
+// replaceMatchingChunks replaces the first chunk that the filter matches (and
+// drops any others that it matches). The new chunk takes the place of the old
+// one unless that was after the first of `beforeTypes`, in which case (or if
+// there was none) it is inserted as `insertChunk` would.
+func (cs *ChunkSlice) replaceMatchingChunks(c *Chunk, filter func(c *Chunk) bool, beforeTypes ...string) {
+	i := cs.removeChunks(filter)
+
+	for j := 0; j < i; j++ {
+		existing := cs.chunks[j]
+		if existing.Type == IENDChunkType {
+			i = -1
+			break
+		}
+
+		for _, type_ := range beforeTypes {
+			if existing.Type == type_ {
+				i = -1
+				break
+			}
+		}
+	}
+
+	if i != -1 {
+		cs.insertChunkAt(c, i)
+	} else {
+		cs.insertChunk(c, beforeTypes...)
+	}
+}
+
+// removeChunks removes every chunk that the given filter matches and returns
+// the position of the first one removed (or -1 if none were removed).
+func (cs *ChunkSlice) removeChunks(filter func(c *Chunk) bool) (first int) {
+	first = -1
+
+	kept := make([]*Chunk, 0, len(cs.chunks))
+	for i, c := range cs.chunks {
+		if filter(c) == true {
+			if first == -1 {
+				first = i
+			}
+
+			continue
+		}
+
+		kept = append(kept, c)
+	}
+
+	cs.chunks = kept
+
+	return first
+}
+
 // FindExif returns the the segment that hosts the EXIF data.
 func (cs *ChunkSlice) FindExif() (chunk *Chunk, err error) {
 	defer func() {
@@ -133,6 +261,9 @@ func (cs *ChunkSlice) Exif() (rootIfd *exif.Ifd, data []byte, err error) {
 
 	ti := exif.NewTagIndex()
 
+	err = chunk.Load()
+	log.PanicIf(err)
+
 	// TODO(dustin): Refactor and support `exif.GetExifData()`.
 
 	_, index, err := exif.Collect(im, ti, chunk.Data)
@@ -209,8 +340,14 @@ type PngSplitter struct {
 	chunks        []*Chunk
 	currentOffset int
 
-	doCheckCrc bool
-	crcErrors  []string
+	doCheckCrc    bool
+	crcErrors     []string
+	crcMismatches []*ChunkError
+
+	limiter *chunkLimiter
+
+	// isDone is set once IEND has been read. Whatever follows it is ignored.
+	isDone bool
 }
 
 func (ps *PngSplitter) Chunks() *ChunkSlice {
@@ -225,11 +362,25 @@ func (ps *PngSplitter) CrcErrors() []string {
 	return ps.crcErrors
 }
 
+// CrcMismatches returns where each CRC mismatch was found. Each unwraps to a
+// `*CrcMismatchError`.
+func (ps *PngSplitter) CrcMismatches() []*ChunkError {
+	return ps.crcMismatches
+}
+
+// SetParseOptions sets the limits to enforce. Nil means no limits besides
+// what the specification requires.
+func (ps *PngSplitter) SetParseOptions(options *ParseOptions) {
+	ps.limiter = newChunkLimiter(options)
+}
+
 func NewPngSplitter() *PngSplitter {
 	return &PngSplitter{
-		chunks:     make([]*Chunk, 0),
-		doCheckCrc: true,
-		crcErrors:  make([]string, 0),
+		chunks:        make([]*Chunk, 0),
+		doCheckCrc:    true,
+		crcErrors:     make([]string, 0),
+		crcMismatches: make([]*ChunkError, 0),
+		limiter:       newChunkLimiter(nil),
 	}
 }
 
@@ -240,6 +391,24 @@ type Chunk struct {
 	Type   string
 	Data   []byte
 	Crc    uint32
+
+	// source is where the payload is loaded from if the chunk was parsed
+	// lazily.
+	source io.ReaderAt
+}
+
+// NewChunk returns a new chunk of the given type wrapping the given data. The
+// length and CRC are calculated.
+func NewChunk(type_ string, data []byte) *Chunk {
+	c := &Chunk{
+		Type:   type_,
+		Data:   data,
+		Length: uint32(len(data)),
+	}
+
+	c.UpdateCrc32()
+
+	return c
 }
 
 func (c *Chunk) String() string {
@@ -250,7 +419,9 @@ func calculateCrc32(chunk *Chunk) uint32 {
 	c := crc32.NewIEEE()
 
 	c.Write([]byte(chunk.Type))
-	c.Write(chunk.Data)
+
+	// A read failure of a lazy chunk just produces a mismatch.
+	io.Copy(c, chunk.payloadReader())
 
 	return c.Sum32()
 }
@@ -273,6 +444,9 @@ func (c *Chunk) Bytes() []byte {
 		}
 	}()
 
+	err := c.Load()
+	log.PanicIf(err)
+
 	if len(c.Data) != int(c.Length) {
 		log.Panicf("length of data not correct")
 	}
@@ -280,7 +454,7 @@ func (c *Chunk) Bytes() []byte {
 	preallocated := make([]byte, 0, 4+4+c.Length+4)
 	b := bytes.NewBuffer(preallocated)
 
-	err := binary.Write(b, binary.BigEndian, c.Length)
+	err = binary.Write(b, binary.BigEndian, c.Length)
 	log.PanicIf(err)
 
 	_, err = b.Write([]byte(c.Type))
@@ -297,7 +471,8 @@ func (c *Chunk) Bytes() []byte {
 	return b.Bytes()
 }
 
-// Write encodes and writes the bytes for this chunk.
+// Write encodes and writes the bytes for this chunk. A lazy chunk that was
+// never loaded is copied as-is from its source.
 func (c *Chunk) WriteTo(w io.Writer) (count int, err error) {
 	defer func() {
 		if state := recover(); state != nil {
@@ -305,6 +480,15 @@ func (c *Chunk) WriteTo(w io.Writer) (count int, err error) {
 		}
 	}()
 
+	if c.IsLazy() == true {
+		sr := io.NewSectionReader(c.source, int64(c.Offset), 4+4+int64(c.Length)+4)
+
+		n, err := io.Copy(w, sr)
+		log.PanicIf(err)
+
+		return int(n), nil
+	}
+
 	if len(c.Data) != int(c.Length) {
 		log.Panicf("length of data not correct")
 	}
@@ -365,15 +549,38 @@ func (ps *PngSplitter) Split(data []byte, atEOF bool) (advance int, token []byte
 	// be then called with more.
 	for {
 		len_ := len(data)
+
+		if ps.isDone == true {
+			// Skip anything after IEND.
+			return advance + len_, nil, nil
+		}
+
 		if len_ < 8 {
+			if atEOF == true && len_ > 0 {
+				log.Panic(&TruncatedError{Offset: ps.currentOffset, Expected: 8, Actual: len_})
+			}
+
 			return advance, nil, nil
 		}
 
 		length := binary.BigEndian.Uint32(data[:4])
 		type_ := string(data[4:8])
+		index := len(ps.chunks)
+
+		// Check before we wait for (and allocate) the data.
+		err := ps.limiter.checkHeader(type_, length)
+		if err != nil {
+			log.Panic(newChunkError(ps.currentOffset, type_, index, err))
+		}
+
 		chunkSize := (8 + int(length) + 4)
 
 		if len_ < chunkSize {
+			if atEOF == true {
+				te := &TruncatedError{Offset: ps.currentOffset, Expected: chunkSize, Actual: len_}
+				log.Panic(newChunkError(ps.currentOffset, type_, index, te))
+			}
+
 			return advance, nil, nil
 		}
 
@@ -391,13 +598,26 @@ func (ps *PngSplitter) Split(data []byte, atEOF bool) (advance int, token []byte
 			Offset: ps.currentOffset,
 		}
 
+		err = ps.limiter.countChunk(type_)
+		if err == nil {
+			err = ps.limiter.checkData(c)
+		}
+
+		if err != nil {
+			log.Panic(newChunkError(c.Offset, type_, index, err))
+		}
+
 		ps.chunks = append(ps.chunks, c)
 
 		if c.CheckCrc32() == false {
+			cme := &CrcMismatchError{Expected: crc, Actual: calculateCrc32(c)}
+			ce := newChunkError(c.Offset, type_, index, cme)
+
 			ps.crcErrors = append(ps.crcErrors, type_)
+			ps.crcMismatches = append(ps.crcMismatches, ce)
 
 			if ps.doCheckCrc == true {
-				log.Panic(ErrCrcFailure)
+				log.Panic(ce)
 			}
 		}
 
@@ -405,6 +625,10 @@ func (ps *PngSplitter) Split(data []byte, atEOF bool) (advance int, token []byte
 		ps.currentOffset += chunkSize
 
 		data = data[chunkSize:]
+
+		if type_ == IENDChunkType {
+			ps.isDone = true
+		}
 	}
 
 	return advance, nil, nil
@@ -0,0 +1,344 @@
+package pngstructure
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/dsoprea/go-logging"
+)
+
+var (
+	// ErrStopStream can be returned from a `ParseStream` callback to stop
+	// early without an error.
+	ErrStopStream = errors.New("stop streaming")
+)
+
+// StreamedChunk is a chunk whose payload has not been read yet.
+type StreamedChunk struct {
+	Offset int
+	Length uint32
+	Type   string
+
+	// Data reads the payload of just this chunk. The CRC is checked when the
+	// end is reached. It is only valid until the next chunk is requested, and
+	// whatever has not been read by then is skipped.
+	Data io.Reader
+
+	payload *chunkPayloadReader
+}
+
+func (sc *StreamedChunk) String() string {
+	return fmt.Sprintf("StreamedChunk<OFFSET=(%d) LENGTH=(%d) TYPE=[%s]>", sc.Offset, sc.Length, sc.Type)
+}
+
+// Chunk reads the whole payload and returns a regular chunk. It fails if any
+// of the payload has already been read.
+func (sc *StreamedChunk) Chunk() (c *Chunk, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	data, err := ioutil.ReadAll(sc.Data)
+	log.PanicIf(err)
+
+	if len(data) != int(sc.Length) {
+		log.Panicf("payload of chunk [%s] already partially read", sc.Type)
+	}
+
+	c = &Chunk{
+		Offset: sc.Offset,
+		Length: sc.Length,
+		Type:   sc.Type,
+		Data:   data,
+		Crc:    sc.payload.crc,
+	}
+
+	return c, nil
+}
+
+// chunkPayloadReader reads the payload of one chunk and then its CRC.
+type chunkPayloadReader struct {
+	csr *ChunkStreamReader
+
+	offset    int
+	index     int
+	type_     string
+	remaining uint32
+	hash      hash.Hash32
+
+	crc    uint32
+	isDone bool
+	err    error
+}
+
+// Read reads from the payload. `io.EOF` is only returned after the CRC has
+// been read (and, if enabled, checked).
+func (cpr *chunkPayloadReader) Read(p []byte) (n int, err error) {
+	if cpr.isDone == true {
+		return 0, cpr.err
+	}
+
+	if cpr.remaining > 0 {
+		if uint32(len(p)) > cpr.remaining {
+			p = p[:cpr.remaining]
+		}
+
+		n, err = cpr.csr.r.Read(p)
+
+		cpr.hash.Write(p[:n])
+		cpr.remaining -= uint32(n)
+		cpr.csr.offset += n
+
+		if err == io.EOF && cpr.remaining > 0 {
+			te := &TruncatedError{Offset: cpr.csr.offset, Expected: int(cpr.remaining), Actual: 0}
+			err = newChunkError(cpr.offset, cpr.type_, cpr.index, te)
+		}
+
+		if err != nil && err != io.EOF {
+			cpr.isDone = true
+			cpr.err = err
+
+			return n, err
+		}
+
+		if cpr.remaining > 0 || n > 0 {
+			return n, nil
+		}
+	}
+
+	cpr.isDone = true
+	cpr.err = cpr.readCrc()
+
+	return 0, cpr.err
+}
+
+// readCrc reads the CRC that follows the payload. Returns `io.EOF` if it
+// checks out.
+func (cpr *chunkPayloadReader) readCrc() error {
+	raw := make([]byte, 4)
+
+	n, err := io.ReadFull(cpr.csr.r, raw)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		te := &TruncatedError{Offset: cpr.csr.offset, Expected: len(raw), Actual: n}
+		return newChunkError(cpr.offset, cpr.type_, cpr.index, te)
+	} else if err != nil {
+		return err
+	}
+
+	cpr.csr.offset += len(raw)
+	cpr.crc = binary.BigEndian.Uint32(raw)
+
+	if cpr.crc != cpr.hash.Sum32() {
+		cme := &CrcMismatchError{Expected: cpr.crc, Actual: cpr.hash.Sum32()}
+		ce := newChunkError(cpr.offset, cpr.type_, cpr.index, cme)
+
+		cpr.csr.crcErrors = append(cpr.csr.crcErrors, cpr.type_)
+		cpr.csr.crcMismatches = append(cpr.csr.crcMismatches, ce)
+
+		if cpr.csr.doCheckCrc == true {
+			return ce
+		}
+	}
+
+	return io.EOF
+}
+
+// ChunkStreamReader reads chunks one at a time from a stream without holding
+// more than one chunk header in memory. The payloads are read (or skipped) by
+// the caller.
+type ChunkStreamReader struct {
+	r      io.Reader
+	offset int
+	index  int
+
+	current   *chunkPayloadReader
+	isDone    bool
+	lastError error
+
+	doCheckCrc    bool
+	crcErrors     []string
+	crcMismatches []*ChunkError
+
+	limiter *chunkLimiter
+}
+
+// NewChunkStreamReader reads the PNG signature and returns a reader for the
+// chunks that follow it.
+func NewChunkStreamReader(r io.Reader) (csr *ChunkStreamReader, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	signature := make([]byte, len(PngSignature))
+
+	_, err = io.ReadFull(r, signature)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		log.Panic(ErrNotPng)
+	}
+
+	log.PanicIf(err)
+
+	if string(signature) != string(PngSignature[:]) {
+		log.Panic(ErrNotPng)
+	}
+
+	csr = &ChunkStreamReader{
+		r:             r,
+		offset:        len(PngSignature),
+		doCheckCrc:    true,
+		crcErrors:     make([]string, 0),
+		crcMismatches: make([]*ChunkError, 0),
+		limiter:       newChunkLimiter(nil),
+	}
+
+	return csr, nil
+}
+
+// DoCheckCrc determines whether a CRC mismatch is an error.
+func (csr *ChunkStreamReader) DoCheckCrc(doCheck bool) {
+	csr.doCheckCrc = doCheck
+}
+
+// CrcErrors returns the types of the chunks whose CRC did not match.
+func (csr *ChunkStreamReader) CrcErrors() []string {
+	return csr.crcErrors
+}
+
+// CrcMismatches returns where each CRC mismatch was found. Each unwraps to a
+// `*CrcMismatchError`.
+func (csr *ChunkStreamReader) CrcMismatches() []*ChunkError {
+	return csr.crcMismatches
+}
+
+// SetParseOptions sets the limits to enforce. Only the chunk lengths and
+// counts can be checked here since the payloads are read by the caller. Nil
+// means no limits besides what the specification requires.
+func (csr *ChunkStreamReader) SetParseOptions(options *ParseOptions) {
+	csr.limiter = newChunkLimiter(options)
+}
+
+// Next skips whatever is left of the previous chunk and returns the next one.
+// Returns `io.EOF` after IEND. If the stream ends before IEND, returns a
+// `*ChunkError` for the missing chunk that unwraps to a `*TruncatedError`.
+func (csr *ChunkStreamReader) Next() (sc *StreamedChunk, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+			csr.lastError = err
+		}
+	}()
+
+	if csr.lastError != nil {
+		return nil, csr.lastError
+	}
+
+	if csr.current != nil {
+		_, err := io.Copy(ioutil.Discard, csr.current)
+		log.PanicIf(err)
+
+		csr.current = nil
+	}
+
+	if csr.isDone == true {
+		return nil, io.EOF
+	}
+
+	header := make([]byte, 8)
+
+	// IEND has not been seen yet, so the stream must not end here.
+	n, err := io.ReadFull(csr.r, header)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		te := &TruncatedError{Offset: csr.offset, Expected: len(header), Actual: n}
+		log.Panic(newChunkError(csr.offset, "", csr.index, te))
+	}
+
+	log.PanicIf(err)
+
+	length := binary.BigEndian.Uint32(header[:4])
+	type_ := string(header[4:8])
+
+	err = csr.limiter.checkHeader(type_, length)
+	if err == nil {
+		err = csr.limiter.countChunk(type_)
+	}
+
+	if err != nil {
+		log.Panic(newChunkError(csr.offset, type_, csr.index, err))
+	}
+
+	sc = &StreamedChunk{
+		Offset: csr.offset,
+		Length: length,
+		Type:   type_,
+	}
+
+	csr.offset += len(header)
+
+	csr.current = &chunkPayloadReader{
+		csr:       csr,
+		offset:    sc.Offset,
+		index:     csr.index,
+		type_:     type_,
+		remaining: length,
+		hash:      crc32.NewIEEE(),
+	}
+
+	csr.current.hash.Write(header[4:8])
+
+	sc.Data = csr.current
+	sc.payload = csr.current
+
+	csr.index++
+
+	if type_ == IENDChunkType {
+		csr.isDone = true
+	}
+
+	return sc, nil
+}
+
+// ParseStream reads the chunks from a stream one at a time and passes each to
+// the callback. This needs very little memory no matter how large the image
+// is: the callback reads as much of each payload as it wants (e.g. none of
+// the IDAT data) and the rest is skipped. If the callback returns an error,
+// parsing stops and it is returned, unless it is `ErrStopStream`.
+func (pmp *PngMediaParser) ParseStream(r io.Reader, cb func(sc *StreamedChunk) error) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	csr, err := NewChunkStreamReader(r)
+	log.PanicIf(err)
+
+	csr.SetParseOptions(pmp.options)
+
+	for {
+		sc, err := csr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		err = cb(sc)
+		if err == ErrStopStream {
+			return nil
+		}
+
+		log.PanicIf(err)
+	}
+
+	return nil
+}
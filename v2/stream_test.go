@@ -0,0 +1,242 @@
+package pngstructure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func TestChunkStreamReader_Next(t *testing.T) {
+	data, err := ioutil.ReadFile(getTestBasicImageFilepath())
+	log.PanicIf(err)
+
+	expected := getTestBasicChunkSlice().Chunks()
+
+	csr, err := NewChunkStreamReader(bytes.NewReader(data))
+	log.PanicIf(err)
+
+	for i := 0; ; i++ {
+		sc, err := csr.Next()
+		if err == io.EOF {
+			if i != len(expected) {
+				t.Fatalf("chunk count not correct: (%d) != (%d)", i, len(expected))
+			}
+
+			break
+		}
+
+		log.PanicIf(err)
+
+		e := expected[i]
+		if sc.Type != e.Type || sc.Offset != e.Offset || sc.Length != e.Length {
+			t.Fatalf("chunk (%d) not correct: %s != %s", i, sc, e)
+		}
+
+		// Skip the image data and read everything else.
+		if sc.Type == IDATChunkType {
+			continue
+		}
+
+		c, err := sc.Chunk()
+		log.PanicIf(err)
+
+		if bytes.Equal(c.Data, e.Data) != true || c.Crc != e.Crc {
+			t.Fatalf("chunk (%d) data not correct: %s", i, c)
+		}
+	}
+}
+
+func TestChunkStreamReader_Next_PartialRead(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestGradientImage(40, 30))
+
+	err := cs.RechunkImageData(50)
+	log.PanicIf(err)
+
+	b := new(bytes.Buffer)
+
+	err = cs.WriteTo(b)
+	log.PanicIf(err)
+
+	csr, err := NewChunkStreamReader(b)
+	log.PanicIf(err)
+
+	types := make([]string, 0)
+	for {
+		sc, err := csr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+
+		// Only read a little of each (IEND has nothing).
+		_, err = sc.Data.Read(make([]byte, 3))
+		if err != nil && err != io.EOF {
+			log.Panic(err)
+		}
+
+		types = append(types, sc.Type)
+	}
+
+	if len(types) != len(cs.Chunks()) {
+		t.Fatalf("chunk count not correct: %v", types)
+	}
+}
+
+func TestChunkStreamReader_Next_CrcFailure(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestGradientImage(4, 4))
+
+	b := new(bytes.Buffer)
+
+	err := cs.WriteTo(b)
+	log.PanicIf(err)
+
+	// Corrupt the CRC of the IDAT, which is never read.
+	data := b.Bytes()
+	idat := cs.Index()[IDATChunkType][0]
+	data[idat.Offset+8+int(idat.Length)] ^= 0xff
+
+	pmp := NewPngMediaParser()
+
+	err = pmp.ParseStream(bytes.NewReader(data), func(sc *StreamedChunk) error {
+		return nil
+	})
+
+	if err == nil {
+		t.Fatalf("expected CRC failure")
+	} else if log.Is(err, ErrCrcFailure) != true {
+		t.Fatalf("error not correct: [%v]", err)
+	}
+
+	// Again, but without checking.
+	csr, err := NewChunkStreamReader(bytes.NewReader(data))
+	log.PanicIf(err)
+
+	csr.DoCheckCrc(false)
+
+	for {
+		_, err := csr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		log.PanicIf(err)
+	}
+
+	if len(csr.CrcErrors()) != 1 || csr.CrcErrors()[0] != IDATChunkType {
+		t.Fatalf("CRC errors not correct: %v", csr.CrcErrors())
+	}
+}
+
+func TestChunkStreamReader_Next_Truncated(t *testing.T) {
+	cs := getTestImageChunkSlice(getTestGradientImage(4, 4))
+
+	b := new(bytes.Buffer)
+
+	err := cs.WriteTo(b)
+	log.PanicIf(err)
+
+	idat := cs.Index()[IDATChunkType][0]
+
+	// In the middle of the payload, in the middle of the next header, and
+	// between chunks (before IEND).
+	sizes := []int{
+		idat.Offset + 10,
+		idat.Offset + 12 + int(idat.Length) + 3,
+		idat.Offset + 12 + int(idat.Length),
+	}
+
+	for _, size := range sizes {
+		csr, err := NewChunkStreamReader(bytes.NewReader(b.Bytes()[:size]))
+		log.PanicIf(err)
+
+		for {
+			_, err = csr.Next()
+			if err != nil {
+				break
+			}
+		}
+
+		var ce *ChunkError
+		var te *TruncatedError
+
+		if err == io.EOF {
+			t.Fatalf("expected error for truncation at (%d)", size)
+		} else if errors.As(err, &ce) != true || errors.As(err, &te) != true {
+			t.Fatalf("expected a ChunkError with a TruncatedError at (%d): [%v]", size, err)
+		}
+	}
+
+	pmp := NewPngMediaParser()
+
+	err = pmp.ParseStream(bytes.NewReader(b.Bytes()[:idat.Offset+12+int(idat.Length)]), func(sc *StreamedChunk) error {
+		return nil
+	})
+
+	if err == nil {
+		t.Fatalf("expected error for stream without IEND")
+	} else if errors.Is(err, io.ErrUnexpectedEOF) != true {
+		log.Panic(err)
+	}
+}
+
+func TestNewChunkStreamReader_NotPng(t *testing.T) {
+	_, err := NewChunkStreamReader(bytes.NewReader([]byte("not a png at all")))
+	if log.Is(err, ErrNotPng) != true {
+		t.Fatalf("expected ErrNotPng: [%v]", err)
+	}
+}
+
+func TestPngMediaParser_ParseStream_Stop(t *testing.T) {
+	data, err := ioutil.ReadFile(getTestBasicImageFilepath())
+	log.PanicIf(err)
+
+	pmp := NewPngMediaParser()
+
+	count := 0
+	err = pmp.ParseStream(bytes.NewReader(data), func(sc *StreamedChunk) error {
+		count++
+
+		if sc.Type == IDATChunkType {
+			return ErrStopStream
+		}
+
+		return nil
+	})
+
+	log.PanicIf(err)
+
+	if count == 0 || count == len(getTestBasicChunkSlice().Chunks()) {
+		t.Fatalf("did not stop at the first IDAT: (%d)", count)
+	}
+}
+
+func ExamplePngMediaParser_ParseStream() {
+	cs := getTestImageChunkSlice(getTestGradientImage(4, 4))
+
+	b := new(bytes.Buffer)
+
+	err := cs.WriteTo(b)
+	log.PanicIf(err)
+
+	pmp := NewPngMediaParser()
+
+	err = pmp.ParseStream(b, func(sc *StreamedChunk) error {
+		// The IDAT data is skipped without being read.
+		fmt.Printf("%s\n", sc.Type)
+		return nil
+	})
+
+	log.PanicIf(err)
+
+	// Output:
+	// IHDR
+	// IDAT
+	// IEND
+}
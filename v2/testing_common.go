@@ -1,9 +1,14 @@
 package pngstructure
 
 import (
+	"bytes"
 	"os"
 	"path"
 
+	"image"
+	"image/color"
+	"image/png"
+
 	"github.com/dsoprea/go-logging"
 )
 
@@ -62,3 +67,118 @@ func getTestExifImageFilepath() string {
 	assetsPath := getTestAssetsPath()
 	return path.Join(assetsPath, "exif.png")
 }
+
+// getTestBasicChunkSlice returns the parsed basic test image.
+func getTestBasicChunkSlice() *ChunkSlice {
+	filepath := getTestBasicImageFilepath()
+
+	pmp := NewPngMediaParser()
+
+	intfc, err := pmp.ParseFile(filepath)
+	log.PanicIf(err)
+
+	return intfc.(*ChunkSlice)
+}
+
+// getTestAnimationFrameImages returns the frames of the test animation: an
+// 8x8 red image, a 4x4 translucent green image and an 8x8 blue image. Each has
+// a transparent pixel so that they all encode to RGBA.
+func getTestAnimationFrameImages() []*image.NRGBA {
+	colors := []color.NRGBA{
+		{0xff, 0, 0, 0xff},
+		{0, 0xff, 0, 0x80},
+		{0, 0, 0xff, 0xff},
+	}
+
+	sizes := []int{8, 4, 8}
+
+	frames := make([]*image.NRGBA, len(colors))
+	for i, c := range colors {
+		frame := image.NewNRGBA(image.Rect(0, 0, sizes[i], sizes[i]))
+		for y := 0; y < sizes[i]; y++ {
+			for x := 0; x < sizes[i]; x++ {
+				frame.SetNRGBA(x, y, c)
+			}
+		}
+
+		frame.SetNRGBA(0, 0, color.NRGBA{})
+		frames[i] = frame
+	}
+
+	return frames
+}
+
+// getTestImageChunkSlice encodes the image and returns it parsed.
+func getTestImageChunkSlice(img image.Image) *ChunkSlice {
+	b := new(bytes.Buffer)
+
+	err := png.Encode(b, img)
+	log.PanicIf(err)
+
+	pmp := NewPngMediaParser()
+
+	intfc, err := pmp.ParseBytes(b.Bytes())
+	log.PanicIf(err)
+
+	return intfc.(*ChunkSlice)
+}
+
+// getTestAnimatedChunkSlice returns a three-frame APNG built from
+// `getTestAnimationFrameImages`. The default image is the first frame, the
+// second frame is blended over it at (2, 2) and disposed to the background,
+// and the third frame replaces everything. The delays are 100ms, 200ms and
+// 30ms.
+func getTestAnimatedChunkSlice() *ChunkSlice {
+	controls := []*ChunkFCTL{
+		{Width: 8, Height: 8, DelayNum: 1, DelayDen: 10, DisposeOp: DisposeOpNone, BlendOp: BlendOpSource},
+		{Width: 4, Height: 4, XOffset: 2, YOffset: 2, DelayNum: 20, DelayDen: 100, DisposeOp: DisposeOpBackground, BlendOp: BlendOpOver},
+		{Width: 8, Height: 8, DelayNum: 3, DelayDen: 0, DisposeOp: DisposeOpNone, BlendOp: BlendOpSource},
+	}
+
+	ce := NewChunkEncoder()
+
+	encode := func(decoded interface{}) *Chunk {
+		c, err := ce.Encode(decoded)
+		log.PanicIf(err)
+
+		return c
+	}
+
+	images := getTestAnimationFrameImages()
+	sequenceNumber := uint32(0)
+
+	var chunks []*Chunk
+	for i, img := range images {
+		frameChunks := getTestImageChunkSlice(img).Chunks()
+
+		if i == 0 {
+			chunks = []*Chunk{
+				frameChunks[0],
+				encode(&ChunkACTL{NumFrames: uint32(len(images))}),
+			}
+		}
+
+		controls[i].SequenceNumber = sequenceNumber
+		sequenceNumber++
+
+		chunks = append(chunks, encode(controls[i]))
+
+		for _, c := range frameChunks {
+			if c.Type != IDATChunkType {
+				continue
+			}
+
+			if i == 0 {
+				chunks = append(chunks, c)
+				continue
+			}
+
+			chunks = append(chunks, encode(&ChunkFDAT{SequenceNumber: sequenceNumber, Data: c.Data}))
+			sequenceNumber++
+		}
+	}
+
+	chunks = append(chunks, NewChunk(IENDChunkType, nil))
+
+	return NewChunkSlice(chunks)
+}
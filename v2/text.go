@@ -0,0 +1,210 @@
+package pngstructure
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/dsoprea/go-logging"
+)
+
+const (
+	// TextCompressionThreshold is the length (in bytes) above which
+	// `SetText` will store a value compressed.
+	TextCompressionThreshold = 1024
+
+	// maxKeywordLength is the maximum length of a text keyword, in bytes.
+	maxKeywordLength = 79
+)
+
+var (
+	// ErrInvalidKeyword indicates a keyword that violates the specification.
+	ErrInvalidKeyword = errors.New("keyword not valid")
+
+	// ErrNoText indicates that there is no text for a keyword.
+	ErrNoText = errors.New("no text for keyword")
+)
+
+// ValidateKeyword checks a text keyword against the specification: 1-79
+// printable Latin-1 characters with no leading, trailing, or consecutive
+// spaces.
+func ValidateKeyword(keyword string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	raw, err := utf8ToLatin1(keyword)
+	if err != nil {
+		log.Panicf("%w: [%s] is not latin-1", ErrInvalidKeyword, keyword)
+	}
+
+	if len(raw) < 1 || len(raw) > maxKeywordLength {
+		log.Panicf("%w: [%s] must be between 1 and %d bytes", ErrInvalidKeyword, keyword, maxKeywordLength)
+	}
+
+	for _, b := range raw {
+		if (b < 32 || b > 126) && b < 161 {
+			log.Panicf("%w: [%s] has non-printable character (0x%02x)", ErrInvalidKeyword, keyword, b)
+		}
+	}
+
+	if raw[0] == ' ' || raw[len(raw)-1] == ' ' {
+		log.Panicf("%w: [%s] has leading or trailing space", ErrInvalidKeyword, keyword)
+	} else if strings.Contains(keyword, "  ") == true {
+		log.Panicf("%w: [%s] has consecutive spaces", ErrInvalidKeyword, keyword)
+	}
+
+	return nil
+}
+
+// isTextChunk returns true for tEXt, zTXt, and iTXt chunks.
+func isTextChunk(c *Chunk) bool {
+	return c.Type == TEXtChunkType || c.Type == ZTXtChunkType || c.Type == ITXtChunkType
+}
+
+// textKeyword returns the keyword of a text chunk without decoding the rest of
+// it.
+func textKeyword(c *Chunk) (keyword string, err error) {
+	err = c.Load()
+	if err != nil {
+		return "", err
+	}
+
+	raw, _, err := splitNull(c.Data)
+	if err != nil {
+		return "", err
+	}
+
+	return latin1ToUtf8(raw), nil
+}
+
+// GetText returns the values of all tEXt, zTXt, and iTXt chunks keyed by
+// keyword. If a keyword appears more than once, the last one wins.
+func (cs *ChunkSlice) GetText() (text map[string]string, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	cd := NewChunkDecoder()
+
+	text = make(map[string]string)
+	for _, c := range cs.chunks {
+		if isTextChunk(c) != true {
+			continue
+		}
+
+		decoded, err := cd.Decode(c)
+		log.PanicIf(err)
+
+		switch t := decoded.(type) {
+		case *ChunkText:
+			text[t.Keyword] = t.Text
+		case *ChunkCompressedText:
+			text[t.Keyword] = t.Text
+		case *ChunkInternationalText:
+			text[t.Keyword] = t.Text
+		}
+	}
+
+	return text, nil
+}
+
+// SetText sets the value for the given keyword, replacing any existing text
+// chunks with that keyword. Values that can not be represented in Latin-1 are
+// stored as iTXt and values longer than `TextCompressionThreshold` are stored
+// compressed.
+func (cs *ChunkSlice) SetText(keyword, value string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = ValidateKeyword(keyword)
+	log.PanicIf(err)
+
+	doCompress := len(value) > TextCompressionThreshold
+
+	var decoded interface{}
+	if _, err := utf8ToLatin1(value); err != nil {
+		decoded = &ChunkInternationalText{
+			Keyword:           keyword,
+			Compressed:        doCompress,
+			CompressionMethod: CompressionMethodDeflate,
+			Text:              value,
+		}
+	} else if doCompress == true {
+		decoded = &ChunkCompressedText{
+			Keyword:           keyword,
+			CompressionMethod: CompressionMethodDeflate,
+			Text:              value,
+		}
+	} else {
+		decoded = &ChunkText{
+			Keyword: keyword,
+			Text:    value,
+		}
+	}
+
+	ce := NewChunkEncoder()
+
+	textChunk, err := ce.Encode(decoded)
+	log.PanicIf(err)
+
+	i, err := cs.removeText(keyword)
+	log.PanicIf(err)
+
+	if i != -1 {
+		// Keep the position of the chunk that we're replacing.
+		cs.insertChunkAt(textChunk, i)
+	} else {
+		cs.insertChunk(textChunk, IDATChunkType)
+	}
+
+	return nil
+}
+
+// DeleteText removes all text chunks with the given keyword. Returns
+// `ErrNoText` if there weren't any.
+func (cs *ChunkSlice) DeleteText(keyword string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	i, err := cs.removeText(keyword)
+	log.PanicIf(err)
+
+	if i == -1 {
+		log.Panic(ErrNoText)
+	}
+
+	return nil
+}
+
+// removeText removes all text chunks with the given keyword and returns the
+// position of the first one (or -1 if there weren't any).
+func (cs *ChunkSlice) removeText(keyword string) (first int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	first = cs.removeChunks(func(c *Chunk) bool {
+		if isTextChunk(c) != true {
+			return false
+		}
+
+		existing, err := textKeyword(c)
+		log.PanicIf(err)
+
+		return existing == keyword
+	})
+
+	return first, nil
+}
@@ -0,0 +1,192 @@
+package pngstructure
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func TestValidateKeyword(t *testing.T) {
+	valid := []string{
+		"Title",
+		"Creation Time",
+		"Café",
+		strings.Repeat("a", 79),
+	}
+
+	for _, keyword := range valid {
+		err := ValidateKeyword(keyword)
+		if err != nil {
+			t.Fatalf("keyword [%s] should be valid: %v", keyword, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		strings.Repeat("a", 80),
+		" Title",
+		"Title ",
+		"Creation  Time",
+		"Tab\tbed",
+		"Snow ☃",
+	}
+
+	for _, keyword := range invalid {
+		err := ValidateKeyword(keyword)
+		if err == nil {
+			t.Fatalf("keyword [%s] should be invalid", keyword)
+		} else if log.Is(err, ErrInvalidKeyword) != true {
+			log.Panic(err)
+		}
+	}
+}
+
+func TestChunkSlice_SetText_Form(t *testing.T) {
+	cs := NewPngChunkSlice()
+
+	err := cs.SetText("Title", "Plain")
+	log.PanicIf(err)
+
+	err = cs.SetText("Description", strings.Repeat("Long. ", 500))
+	log.PanicIf(err)
+
+	err = cs.SetText("Comment", "Snowman ☃")
+	log.PanicIf(err)
+
+	chunks := cs.Chunks()
+	if len(chunks) != 4 {
+		t.Fatalf("number of chunks not correct: (%d)", len(chunks))
+	} else if chunks[1].Type != TEXtChunkType {
+		t.Fatalf("expected tEXt: [%s]", chunks[1].Type)
+	} else if chunks[2].Type != ZTXtChunkType {
+		t.Fatalf("expected zTXt: [%s]", chunks[2].Type)
+	} else if chunks[3].Type != ITXtChunkType {
+		t.Fatalf("expected iTXt: [%s]", chunks[3].Type)
+	}
+}
+
+func TestChunkSlice_SetText_Replace(t *testing.T) {
+	cs := NewPngChunkSlice()
+
+	err := cs.SetText("Title", "First")
+	log.PanicIf(err)
+
+	err = cs.SetText("Author", "Someone")
+	log.PanicIf(err)
+
+	// Switches from tEXt to iTXt but should keep its position.
+	err = cs.SetText("Title", "Second ☃")
+	log.PanicIf(err)
+
+	chunks := cs.Chunks()
+	if len(chunks) != 3 {
+		t.Fatalf("number of chunks not correct: (%d)", len(chunks))
+	} else if chunks[1].Type != ITXtChunkType {
+		t.Fatalf("replaced chunk not in the same position")
+	}
+
+	text, err := cs.GetText()
+	log.PanicIf(err)
+
+	expected := map[string]string{
+		"Title":  "Second ☃",
+		"Author": "Someone",
+	}
+
+	if reflect.DeepEqual(text, expected) != true {
+		t.Fatalf("text not correct: %v", text)
+	}
+}
+
+func TestChunkSlice_SetText_InvalidKeyword(t *testing.T) {
+	cs := NewPngChunkSlice()
+
+	err := cs.SetText("Bad  Keyword", "value")
+	if err == nil {
+		t.Fatalf("expected error for invalid keyword")
+	} else if log.Is(err, ErrInvalidKeyword) != true {
+		log.Panic(err)
+	} else if len(cs.Chunks()) != 1 {
+		t.Fatalf("chunk should not have been added")
+	}
+}
+
+func TestChunkSlice_SetText_BeforeIdat(t *testing.T) {
+	filepath := getTestBasicImageFilepath()
+
+	pmp := NewPngMediaParser()
+
+	intfc, err := pmp.ParseFile(filepath)
+	log.PanicIf(err)
+
+	cs := intfc.(*ChunkSlice)
+
+	err = cs.SetText("Title", "Some title")
+	log.PanicIf(err)
+
+	b := new(bytes.Buffer)
+
+	err = cs.WriteTo(b)
+	log.PanicIf(err)
+
+	intfc, err = pmp.ParseBytes(b.Bytes())
+	log.PanicIf(err)
+
+	cs = intfc.(*ChunkSlice)
+
+	seenText := false
+	for _, c := range cs.Chunks() {
+		if c.Type == TEXtChunkType {
+			seenText = true
+		} else if c.Type == IDATChunkType && seenText == false {
+			t.Fatalf("text chunk not placed before IDAT")
+		}
+	}
+
+	text, err := cs.GetText()
+	log.PanicIf(err)
+
+	if text["Title"] != "Some title" {
+		t.Fatalf("text not read back correctly: %v", text)
+	}
+}
+
+func TestChunkSlice_DeleteText(t *testing.T) {
+	cs := NewPngChunkSlice()
+
+	err := cs.SetText("Title", "Some title")
+	log.PanicIf(err)
+
+	err = cs.DeleteText("Title")
+	log.PanicIf(err)
+
+	if len(cs.Chunks()) != 1 {
+		t.Fatalf("text chunk not removed")
+	}
+
+	err = cs.DeleteText("Title")
+	if err == nil {
+		t.Fatalf("expected error for missing keyword")
+	} else if log.Is(err, ErrNoText) != true {
+		log.Panic(err)
+	}
+}
+
+func ExampleChunkSlice_SetText() {
+	cs := NewPngChunkSlice()
+
+	err := cs.SetText("Title", "Some title")
+	log.PanicIf(err)
+
+	text, err := cs.GetText()
+	log.PanicIf(err)
+
+	fmt.Printf("%s\n", text["Title"])
+
+	// Output:
+	// Some title
+}
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"fmt"
 
+	"compress/zlib"
+	"io/ioutil"
+
 	"github.com/dsoprea/go-logging"
 )
 
@@ -63,3 +66,49 @@ func DumpBytesClauseToString(data []byte) string {
 
 	return b.String()
 }
+
+// inflate decompresses a zlib stream (PNG compression-method 0).
+func inflate(data []byte) (inflated []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	log.PanicIf(err)
+
+	defer zr.Close()
+
+	inflated, err = ioutil.ReadAll(zr)
+	log.PanicIf(err)
+
+	return inflated, nil
+}
+
+// deflate compresses data into a zlib stream (PNG compression-method 0).
+func deflate(data []byte) (deflated []byte, err error) {
+	return deflateLevel(data, zlib.BestCompression)
+}
+
+// deflateLevel compresses data into a zlib stream at the given level.
+func deflateLevel(data []byte, level int) (deflated []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	b := new(bytes.Buffer)
+
+	zw, err := zlib.NewWriterLevel(b, level)
+	log.PanicIf(err)
+
+	_, err = zw.Write(data)
+	log.PanicIf(err)
+
+	err = zw.Close()
+	log.PanicIf(err)
+
+	return b.Bytes(), nil
+}
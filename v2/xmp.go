@@ -0,0 +1,226 @@
+package pngstructure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"encoding/xml"
+
+	"github.com/dsoprea/go-logging"
+)
+
+const (
+	// XmpKeyword is the iTXt keyword that XMP packets are stored under.
+	XmpKeyword = "XML:com.adobe.xmp"
+
+	// Namespace URIs of the RDF syntax and some commonly-used XMP schemas.
+	XmpNamespaceRdf       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	XmpNamespaceDc        = "http://purl.org/dc/elements/1.1/"
+	XmpNamespaceXmp       = "http://ns.adobe.com/xap/1.0/"
+	XmpNamespaceXmpRights = "http://ns.adobe.com/xap/1.0/rights/"
+	XmpNamespacePhotoshop = "http://ns.adobe.com/photoshop/1.0/"
+)
+
+var (
+	// ErrNoXmp indicates that there is no XMP chunk.
+	ErrNoXmp = errors.New("no xmp data")
+)
+
+// XmpProperty is a single property from the RDF of an XMP packet.
+type XmpProperty struct {
+	Namespace string
+	Name      string
+
+	// Values has one item for simple properties and one item per `rdf:li`
+	// for arrays (rdf:Seq, rdf:Bag, and rdf:Alt).
+	Values []string
+}
+
+func (xp XmpProperty) String() string {
+	return fmt.Sprintf("XmpProperty<NS=[%s] NAME=[%s] VALUES=%v>", xp.Namespace, xp.Name, xp.Values)
+}
+
+// XmpProperties is a flat list of all properties in an XMP packet.
+type XmpProperties []XmpProperty
+
+// Get returns the values for the property with the given namespace URI and
+// name.
+func (xps XmpProperties) Get(namespace, name string) (values []string, found bool) {
+	for _, xp := range xps {
+		if xp.Namespace == namespace && xp.Name == name {
+			return xp.Values, true
+		}
+	}
+
+	return nil, false
+}
+
+// xmlNode is a generic XML element.
+type xmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []xmlNode  `xml:",any"`
+	Text     string     `xml:",chardata"`
+}
+
+func (xn xmlNode) is(namespace, name string) bool {
+	return xn.XMLName.Space == namespace && xn.XMLName.Local == name
+}
+
+// parseXmpProperties parses the RDF in the XMP packet into a flat list of
+// properties. Nested structures are flattened.
+func parseXmpProperties(packet []byte) (properties XmpProperties, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	root := xmlNode{}
+
+	err = xml.Unmarshal(packet, &root)
+	log.PanicIf(err)
+
+	properties = make(XmpProperties, 0)
+	collectXmpProperties(root, &properties)
+
+	return properties, nil
+}
+
+func collectXmpProperties(node xmlNode, properties *XmpProperties) {
+	if node.is(XmpNamespaceRdf, "Description") != true {
+		for _, child := range node.Children {
+			collectXmpProperties(child, properties)
+		}
+
+		return
+	}
+
+	// Simple properties can be expressed as attributes.
+	for _, attr := range node.Attrs {
+		if attr.Name.Space == "xmlns" || attr.Name.Space == XmpNamespaceRdf || attr.Name.Space == "" {
+			continue
+		}
+
+		xp := XmpProperty{
+			Namespace: attr.Name.Space,
+			Name:      attr.Name.Local,
+			Values:    []string{attr.Value},
+		}
+
+		*properties = append(*properties, xp)
+	}
+
+	for _, child := range node.Children {
+		xp := XmpProperty{
+			Namespace: child.XMLName.Space,
+			Name:      child.XMLName.Local,
+		}
+
+		for _, attr := range child.Attrs {
+			if attr.Name.Space == XmpNamespaceRdf && attr.Name.Local == "resource" {
+				xp.Values = []string{attr.Value}
+			}
+		}
+
+		for _, grandchild := range child.Children {
+			if grandchild.is(XmpNamespaceRdf, "Seq") == true || grandchild.is(XmpNamespaceRdf, "Bag") == true || grandchild.is(XmpNamespaceRdf, "Alt") == true {
+				xp.Values = make([]string, 0, len(grandchild.Children))
+				for _, li := range grandchild.Children {
+					if li.is(XmpNamespaceRdf, "li") == true {
+						xp.Values = append(xp.Values, strings.TrimSpace(li.Text))
+					}
+				}
+			} else {
+				// A structure. Collect its fields as their own properties.
+				collectXmpProperties(grandchild, properties)
+			}
+		}
+
+		if xp.Values == nil && len(child.Children) == 0 {
+			xp.Values = []string{strings.TrimSpace(child.Text)}
+		}
+
+		if xp.Values != nil {
+			*properties = append(*properties, xp)
+		}
+	}
+}
+
+// isXmpChunk returns true if the chunk is the iTXt chunk hosting XMP.
+func isXmpChunk(c *Chunk) bool {
+	if c.Type != ITXtChunkType {
+		return false
+	}
+
+	keyword, err := textKeyword(c)
+	return err == nil && keyword == XmpKeyword
+}
+
+// FindXmp returns the chunk that hosts the XMP data.
+func (cs *ChunkSlice) FindXmp() (chunk *Chunk, err error) {
+	for _, c := range cs.chunks {
+		if isXmpChunk(c) == true {
+			return c, nil
+		}
+	}
+
+	return nil, ErrNoXmp
+}
+
+// Xmp returns the parsed properties and the raw XMP packet.
+func (cs *ChunkSlice) Xmp() (properties XmpProperties, packet []byte, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	chunk, err := cs.FindXmp()
+	log.PanicIf(err)
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(chunk)
+	log.PanicIf(err)
+
+	cit := decoded.(*ChunkInternationalText)
+	packet = []byte(cit.Text)
+
+	properties, err = parseXmpProperties(packet)
+	log.PanicIf(err)
+
+	return properties, packet, nil
+}
+
+// SetXmp sets the XMP packet. It is stored uncompressed (which is what Adobe's
+// tools expect) and always before the image data. An existing packet is
+// replaced in place unless it comes after the image data.
+func (cs *ChunkSlice) SetXmp(packet []byte) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	// Make sure that it's well-formed.
+	_, err = parseXmpProperties(bytes.TrimSpace(packet))
+	log.PanicIf(err)
+
+	cit := &ChunkInternationalText{
+		Keyword:           XmpKeyword,
+		CompressionMethod: CompressionMethodDeflate,
+		Text:              string(packet),
+	}
+
+	ce := NewChunkEncoder()
+
+	xmpChunk, err := ce.Encode(cit)
+	log.PanicIf(err)
+
+	cs.replaceMatchingChunks(xmpChunk, isXmpChunk, IDATChunkType)
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package pngstructure
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+)
+
+const (
+	testXmpPacket = `<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:xmpRights="http://ns.adobe.com/xap/1.0/rights/"
+   xmp:Rating="4">
+   <dc:title>
+    <rdf:Alt>
+     <rdf:li xml:lang="x-default">Harbor at dusk</rdf:li>
+    </rdf:Alt>
+   </dc:title>
+   <dc:subject>
+    <rdf:Bag>
+     <rdf:li>harbor</rdf:li>
+     <rdf:li>boats</rdf:li>
+    </rdf:Bag>
+   </dc:subject>
+   <xmpRights:Marked>True</xmpRights:Marked>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+)
+
+func TestParseXmpProperties(t *testing.T) {
+	properties, err := parseXmpProperties([]byte(testXmpPacket))
+	log.PanicIf(err)
+
+	expected := XmpProperties{
+		{Namespace: XmpNamespaceXmp, Name: "Rating", Values: []string{"4"}},
+		{Namespace: XmpNamespaceDc, Name: "title", Values: []string{"Harbor at dusk"}},
+		{Namespace: XmpNamespaceDc, Name: "subject", Values: []string{"harbor", "boats"}},
+		{Namespace: XmpNamespaceXmpRights, Name: "Marked", Values: []string{"True"}},
+	}
+
+	if reflect.DeepEqual(properties, expected) != true {
+		for _, xp := range properties {
+			fmt.Printf("%s\n", xp)
+		}
+
+		t.Fatalf("properties not correct")
+	}
+}
+
+func TestXmpProperties_Get(t *testing.T) {
+	properties, err := parseXmpProperties([]byte(testXmpPacket))
+	log.PanicIf(err)
+
+	values, found := properties.Get(XmpNamespaceDc, "subject")
+	if found != true {
+		t.Fatalf("property not found")
+	} else if reflect.DeepEqual(values, []string{"harbor", "boats"}) != true {
+		t.Fatalf("values not correct: %v", values)
+	}
+
+	_, found = properties.Get(XmpNamespaceDc, "creator")
+	if found != false {
+		t.Fatalf("property should not have been found")
+	}
+}
+
+func TestChunkSlice_Xmp_Miss(t *testing.T) {
+	cs := NewPngChunkSlice()
+
+	_, _, err := cs.Xmp()
+	if err == nil {
+		t.Fatalf("expected error for missing XMP")
+	} else if log.Is(err, ErrNoXmp) != true {
+		log.Panic(err)
+	}
+}
+
+func TestChunkSlice_SetXmp(t *testing.T) {
+	filepath := getTestBasicImageFilepath()
+
+	pmp := NewPngMediaParser()
+
+	intfc, err := pmp.ParseFile(filepath)
+	log.PanicIf(err)
+
+	cs := intfc.(*ChunkSlice)
+
+	err = cs.SetXmp([]byte(testXmpPacket))
+	log.PanicIf(err)
+
+	// Set it again to make sure that it's replaced rather than duplicated.
+	err = cs.SetXmp([]byte(testXmpPacket))
+	log.PanicIf(err)
+
+	b := new(bytes.Buffer)
+
+	err = cs.WriteTo(b)
+	log.PanicIf(err)
+
+	intfc, err = pmp.ParseBytes(b.Bytes())
+	log.PanicIf(err)
+
+	cs = intfc.(*ChunkSlice)
+
+	xmpChunks := 0
+	for _, c := range cs.Chunks() {
+		if isXmpChunk(c) == true {
+			xmpChunks++
+		} else if c.Type == IDATChunkType && xmpChunks == 0 {
+			t.Fatalf("XMP chunk not placed before IDAT")
+		}
+	}
+
+	if xmpChunks != 1 {
+		t.Fatalf("expected exactly one XMP chunk: (%d)", xmpChunks)
+	}
+
+	xmpChunk, err := cs.FindXmp()
+	log.PanicIf(err)
+
+	cd := NewChunkDecoder()
+
+	decoded, err := cd.Decode(xmpChunk)
+	log.PanicIf(err)
+
+	if decoded.(*ChunkInternationalText).Compressed != false {
+		t.Fatalf("XMP should be stored uncompressed")
+	}
+
+	properties, packet, err := cs.Xmp()
+	log.PanicIf(err)
+
+	if string(packet) != testXmpPacket {
+		t.Fatalf("packet not correct")
+	}
+
+	values, found := properties.Get(XmpNamespaceXmp, "Rating")
+	if found != true || values[0] != "4" {
+		t.Fatalf("rating not correct")
+	}
+}
+
+func TestChunkSlice_SetXmp_AfterImageData(t *testing.T) {
+	filepath := getTestBasicImageFilepath()
+
+	pmp := NewPngMediaParser()
+
+	intfc, err := pmp.ParseFile(filepath)
+	log.PanicIf(err)
+
+	cs := intfc.(*ChunkSlice)
+
+	cit := &ChunkInternationalText{
+		Keyword: XmpKeyword,
+		Text:    testXmpPacket,
+	}
+
+	ce := NewChunkEncoder()
+
+	xmpChunk, err := ce.Encode(cit)
+	log.PanicIf(err)
+
+	// Put the existing packet after the image data.
+	cs.insertChunk(xmpChunk)
+
+	err = cs.SetXmp([]byte(testXmpPacket))
+	log.PanicIf(err)
+
+	xmpChunks := 0
+	for _, c := range cs.Chunks() {
+		if isXmpChunk(c) == true {
+			xmpChunks++
+		} else if c.Type == IDATChunkType && xmpChunks == 0 {
+			t.Fatalf("XMP chunk not moved before IDAT")
+		}
+	}
+
+	if xmpChunks != 1 {
+		t.Fatalf("expected exactly one XMP chunk: (%d)", xmpChunks)
+	}
+}
+
+func TestChunkSlice_SetXmp_NotWellFormed(t *testing.T) {
+	cs := NewPngChunkSlice()
+
+	err := cs.SetXmp([]byte("<x:xmpmeta"))
+	if err == nil {
+		t.Fatalf("expected error for bad XML")
+	}
+}
+
+func ExampleChunkSlice_Xmp() {
+	cs := NewPngChunkSlice()
+
+	err := cs.SetXmp([]byte(testXmpPacket))
+	log.PanicIf(err)
+
+	properties, _, err := cs.Xmp()
+	log.PanicIf(err)
+
+	values, _ := properties.Get(XmpNamespaceDc, "title")
+	fmt.Printf("%s\n", values[0])
+
+	// Output:
+	// Harbor at dusk
+}